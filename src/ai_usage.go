@@ -0,0 +1,218 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/jiaming2012/receipt-bot/src/models"
+	"github.com/jiaming2012/receipt-bot/src/services"
+)
+
+const aiUsageMonthLayout = "2006-01"
+
+var ErrAIBudgetExceeded = errors.New("monthly AI budget exceeded")
+
+// aiBudgetPausedReason starts the Reason of the pending purchase left for a
+// receipt that wasn't read because of the budget. Those receipts are read
+// again by the next ingest run with budget to spare.
+const aiBudgetPausedReason = "AI parsing paused"
+
+func isAIBudgetPaused(pp *models.BaserowPendingPurchase) bool {
+	return strings.HasPrefix(pp.Reason, aiBudgetPausedReason)
+}
+
+// aiUsageTracker records the model calls made for a tenant's receipts in its
+// AIUsage table and enforces the tenant's monthly budget. A nil tracker
+// records nothing and never runs out of budget.
+type aiUsageTracker struct {
+	baserowClient *models.BaserowClient
+	budget        float64
+	now           func() time.Time
+
+	mu    sync.Mutex
+	month string
+	spent float64
+}
+
+func newAIUsageTracker(baserowClient *models.BaserowClient, budget float64) *aiUsageTracker {
+	return &aiUsageTracker{
+		baserowClient: baserowClient,
+		budget:        budget,
+		now:           time.Now,
+	}
+}
+
+// enabled reports whether the tenant has an AIUsage table to record to.
+func (t *aiUsageTracker) enabled() bool {
+	if t == nil {
+		return false
+	}
+
+	_, err := t.baserowClient.TableIDByName(models.BaserowAIUsageTableName)
+	return err == nil
+}
+
+// Check returns ErrAIBudgetExceeded once this month's spend, including the
+// pending calls that have been made but not recorded yet, has reached the
+// budget, or if a pending call's model has no price.
+func (t *aiUsageTracker) Check(ctx context.Context, pending []services.Usage) error {
+	if t == nil || t.budget <= 0 {
+		return nil
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	month := t.now().UTC().Format(aiUsageMonthLayout)
+	if t.month != month {
+		rows, err := models.ListRows[*models.BaserowAIUsage](ctx, t.baserowClient,
+			models.WithFilter("Month", "equal", month),
+			models.WithInclude("Cost"),
+		)
+		if err != nil {
+			return fmt.Errorf("aiUsageTracker.Check: failed to list AI usage: %w", err)
+		}
+
+		t.month = month
+		t.spent = 0
+		for _, row := range rows {
+			t.spent += row.Cost
+		}
+	}
+
+	spent := t.spent
+	for _, call := range pending {
+		cost, known := call.Cost()
+		if !known {
+			// an unpriced model would spend the budget unnoticed
+			return fmt.Errorf("%w: no price for %s", ErrAIBudgetExceeded, call.Parser)
+		}
+		spent += cost
+	}
+
+	if spent >= t.budget {
+		return fmt.Errorf("%w: spent $%.2f of $%.2f in %s", ErrAIBudgetExceeded, spent, t.budget, month)
+	}
+
+	return nil
+}
+
+// Record writes a row for each model call made while reading a transaction's
+// receipt and adds their cost to the month's spend.
+func (t *aiUsageTracker) Record(ctx context.Context, bankTxID string, calls []services.Usage) error {
+	if len(calls) == 0 || !t.enabled() {
+		return nil
+	}
+
+	now := t.now().UTC()
+	month := now.Format(aiUsageMonthLayout)
+
+	var rows []models.BaserowData
+	var cost float64
+	for _, call := range calls {
+		callCost, _ := call.Cost()
+		rows = append(rows, &models.BaserowAIUsage{
+			BankTxID:      bankTxID,
+			Date:          now.Format(time.DateOnly),
+			Month:         month,
+			Parser:        call.Parser,
+			PromptVersion: call.PromptVersion,
+			InputTokens:   call.InputTokens,
+			OutputTokens:  call.OutputTokens,
+			Cost:          callCost,
+		})
+		cost += callCost
+	}
+
+	if err := t.baserowClient.CreateRows(ctx, rows); err != nil {
+		return fmt.Errorf("aiUsageTracker.Record: failed to create AI usage rows: %w", err)
+	}
+
+	t.mu.Lock()
+	if t.month == month {
+		t.spent += cost
+	}
+	t.mu.Unlock()
+
+	return nil
+}
+
+// run_ai_usage_report prints the AI spend per month and parser. An empty
+// month reports every month in the AIUsage table.
+func run_ai_usage_report(ctx context.Context, baserowClient *models.BaserowClient, month string, budget float64, out io.Writer) error {
+	var opts []models.ListRowsOption
+	if month != "" {
+		opts = append(opts, models.WithFilter("Month", "equal", month))
+	}
+
+	rows, err := models.ListRows[*models.BaserowAIUsage](ctx, baserowClient, opts...)
+	if err != nil {
+		return fmt.Errorf("run_ai_usage_report: %w", err)
+	}
+
+	type key struct{ month, parser string }
+	type total struct {
+		calls, inputTokens, outputTokens int
+		cost                             float64
+	}
+
+	totals := make(map[key]*total)
+	monthly := make(map[string]float64)
+	for _, row := range rows {
+		k := key{row.Month, row.Parser}
+		if totals[k] == nil {
+			totals[k] = &total{}
+		}
+
+		totals[k].calls++
+		totals[k].inputTokens += row.InputTokens
+		totals[k].outputTokens += row.OutputTokens
+		totals[k].cost += row.Cost
+		monthly[row.Month] += row.Cost
+	}
+
+	keys := make([]key, 0, len(totals))
+	for k := range totals {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].month != keys[j].month {
+			return keys[i].month < keys[j].month
+		}
+		return keys[i].parser < keys[j].parser
+	})
+
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "MONTH\tPARSER\tCALLS\tINPUT TOKENS\tOUTPUT TOKENS\tCOST")
+	for _, k := range keys {
+		t := totals[k]
+		fmt.Fprintf(w, "%s\t%s\t%d\t%d\t%d\t$%.4f\n", k.month, k.parser, t.calls, t.inputTokens, t.outputTokens, t.cost)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	months := make([]string, 0, len(monthly))
+	for m := range monthly {
+		months = append(months, m)
+	}
+	sort.Strings(months)
+
+	fmt.Fprintln(out)
+	for _, m := range months {
+		if budget > 0 {
+			fmt.Fprintf(out, "%s: $%.2f of $%.2f budget (%.0f%%)\n", m, monthly[m], budget, 100*monthly[m]/budget)
+		} else {
+			fmt.Fprintf(out, "%s: $%.2f\n", m, monthly[m])
+		}
+	}
+
+	return nil
+}
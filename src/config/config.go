@@ -0,0 +1,599 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"google.golang.org/genai"
+	"gopkg.in/yaml.v2"
+
+	"github.com/jiaming2012/receipt-bot/src/models"
+	"github.com/jiaming2012/receipt-bot/src/parsecache"
+	"github.com/jiaming2012/receipt-bot/src/prompts"
+	"github.com/jiaming2012/receipt-bot/src/services"
+)
+
+const (
+	DefaultTenantName     = "default"
+	DefaultBaserowBaseURL = "https://api.baserow.io"
+	DefaultBaserowKeyEnv  = "BASEROW_API_KEY"
+	DefaultBankKeyEnv     = "BANK_API_KEY"
+	DefaultWebhookKeyEnv  = "MERCURY_WEBHOOK_SECRET"
+
+	ParserGemini = "gemini"
+	ParserOpenAI = "openai"
+	ParserStub   = "stub"
+)
+
+// DefaultBaserowTableIDs are the table IDs of the original production
+// database, used when running from the environment without a config file.
+var DefaultBaserowTableIDs = map[string]string{
+	models.BaserowItemTableName:              "786113",
+	models.BaserowTagTableName:               "786134",
+	models.BaserowPurchaseItemTableName:      "786129",
+	models.BaserowPurchaseItemGroupTableName: "786135",
+	models.BaserowVendorTableName:            "786130",
+	models.BaserowPurchaseEventTableName:     "786138",
+	models.BaserowPendingPurchasesTableName:  "788804",
+	models.BaserowPurchaseTableName:          "786116",
+}
+
+type Config struct {
+	DefaultTenant string       `yaml:"default_tenant"`
+	Tenants       []*Tenant    `yaml:"tenants"`
+	Parser        ParserConfig `yaml:"parser"`
+}
+
+// ParserConfig selects the backend that reads receipts.
+type ParserConfig struct {
+	// Backend is "gemini" (the default), "openai" for any OpenAI-compatible
+	// server, or "stub" for canned receipts.
+	Backend string `yaml:"backend"`
+	Model   string `yaml:"model"`
+	// BaseURL is the OpenAI-compatible server, e.g. http://localhost:11434/v1
+	// for Ollama.
+	BaseURL   string `yaml:"base_url"`
+	APIKeyEnv string `yaml:"api_key_env"`
+	// StubFile holds the stub backend's receipts.
+	StubFile string `yaml:"stub_file"`
+	// DisableResponseSchema stops Gemini from being asked for structured
+	// output, for models that don't support it.
+	DisableResponseSchema bool `yaml:"disable_response_schema"`
+	// MaxAttempts is how many times a receipt that fails validation is
+	// parsed before it is left for review. Defaults to
+	// services.DefaultMaxParseAttempts; 1 turns re-prompting off.
+	MaxAttempts int `yaml:"max_attempts"`
+	// EscalationModel, if set, is used for the last attempt, e.g.
+	// gemini-2.5-pro.
+	EscalationModel string `yaml:"escalation_model"`
+	// CacheDir holds parsed receipts so reruns don't call the model again.
+	// Defaults to parsecache.DefaultDir.
+	CacheDir     string `yaml:"cache_dir"`
+	DisableCache bool   `yaml:"disable_cache"`
+	// PromptsDir holds prompt templates that add to or replace the built-in
+	// ones, named like the files in src/prompts.
+	PromptsDir string `yaml:"prompts_dir"`
+	// Prices add to or override services.ModelPrices, keyed by model.
+	Prices map[string]ModelPrice `yaml:"prices"`
+}
+
+// ModelPrice is a model's price in US dollars per million tokens.
+type ModelPrice struct {
+	InputPerMillion  float64 `yaml:"input_per_million"`
+	OutputPerMillion float64 `yaml:"output_per_million"`
+}
+
+// Tenant is one business with its own Baserow database and bank account.
+type Tenant struct {
+	Name    string        `yaml:"name"`
+	Baserow BaserowConfig `yaml:"baserow"`
+	Mercury MercuryConfig `yaml:"mercury"`
+	// AIMonthlyBudgetUSD, if set, pauses AI parsing for the rest of the month
+	// once the estimated spend in the AIUsage table reaches it. Receipts are
+	// then left for review in PendingPurchases.
+	AIMonthlyBudgetUSD float64 `yaml:"ai_monthly_budget_usd"`
+}
+
+type BaserowConfig struct {
+	BaseURL string `yaml:"base_url"`
+	// APIKeyEnv names the environment variable holding the database token, so
+	// secrets stay out of the config file.
+	APIKeyEnv string            `yaml:"api_key_env"`
+	Tables    map[string]string `yaml:"tables"`
+}
+
+type MercuryConfig struct {
+	BaseURL   string         `yaml:"base_url"`
+	APIKeyEnv string         `yaml:"api_key_env"`
+	Accounts  AccountsFilter `yaml:"accounts"`
+	// WebhookSecretEnv names the environment variable holding the secret
+	// Mercury signs webhook events with.
+	WebhookSecretEnv string `yaml:"webhook_secret_env"`
+}
+
+// AccountsFilter selects the bank accounts to fetch transactions from, by
+// account ID or name. Without an include list every account is fetched.
+type AccountsFilter struct {
+	Include []string `yaml:"include"`
+	Exclude []string `yaml:"exclude"`
+}
+
+// Load reads the tenants from the YAML file at path. If path is empty a single
+// tenant is built from the environment: BASEROW_BASE_URL and MERCURY_BASE_URL
+// override the base URLs and BASEROW_TABLE_<NAME> (e.g. BASEROW_TABLE_PURCHASE_EVENT) overrides
+// individual table IDs.
+func Load(path string) (*Config, error) {
+	if path == "" {
+		cfg, err := fromEnv()
+		if err != nil {
+			return nil, fmt.Errorf("config.Load: %w", err)
+		}
+		return cfg, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("config.Load: failed to read %s: %w", path, err)
+	}
+
+	var cfg Config
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("config.Load: failed to parse %s: %w", path, err)
+	}
+
+	if err := cfg.validate(); err != nil {
+		return nil, fmt.Errorf("config.Load: %s: %w", path, err)
+	}
+
+	return &cfg, nil
+}
+
+func fromEnv() (*Config, error) {
+	tables := make(map[string]string)
+	for _, name := range models.BaserowTableNames {
+		if id, ok := DefaultBaserowTableIDs[name]; ok {
+			tables[name] = id
+		}
+		if override := os.Getenv(tableEnvVar(name)); override != "" {
+			tables[name] = override
+		}
+	}
+
+	tenant := &Tenant{
+		Name: DefaultTenantName,
+		Baserow: BaserowConfig{
+			BaseURL: os.Getenv("BASEROW_BASE_URL"),
+			Tables:  tables,
+		},
+		Mercury: MercuryConfig{
+			BaseURL: os.Getenv("MERCURY_BASE_URL"),
+		},
+	}
+	tenant.applyDefaults()
+
+	if v := os.Getenv("AI_MONTHLY_BUDGET_USD"); v != "" {
+		budget, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return nil, fmt.Errorf("AI_MONTHLY_BUDGET_USD: %w", err)
+		}
+		tenant.AIMonthlyBudgetUSD = budget
+	}
+
+	parser := ParserConfig{
+		Backend:         os.Getenv("RECEIPT_PARSER"),
+		Model:           os.Getenv("RECEIPT_PARSER_MODEL"),
+		BaseURL:         os.Getenv("RECEIPT_PARSER_BASE_URL"),
+		StubFile:        os.Getenv("RECEIPT_PARSER_STUB_FILE"),
+		EscalationModel: os.Getenv("RECEIPT_PARSER_ESCALATION_MODEL"),
+		CacheDir:        os.Getenv("PARSE_CACHE_DIR"),
+		PromptsDir:      os.Getenv("PROMPTS_DIR"),
+
+		DisableResponseSchema: os.Getenv("RECEIPT_PARSER_DISABLE_SCHEMA") == "true",
+		DisableCache:          os.Getenv("RECEIPT_PARSER_DISABLE_CACHE") == "true",
+	}
+
+	if v := os.Getenv("RECEIPT_PARSER_MAX_ATTEMPTS"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return nil, fmt.Errorf("RECEIPT_PARSER_MAX_ATTEMPTS: %w", err)
+		}
+		parser.MaxAttempts = n
+	}
+
+	if err := parser.applyDefaults(); err != nil {
+		return nil, err
+	}
+
+	cfg := &Config{
+		DefaultTenant: DefaultTenantName,
+		Tenants:       []*Tenant{tenant},
+		Parser:        parser,
+	}
+
+	return cfg, cfg.checkModelPrices()
+}
+
+func (p *ParserConfig) applyDefaults() error {
+	if p.Backend == "" {
+		p.Backend = ParserGemini
+	}
+
+	if p.APIKeyEnv == "" {
+		switch p.Backend {
+		case ParserGemini:
+			p.APIKeyEnv = "AI_API_KEY"
+		case ParserOpenAI:
+			p.APIKeyEnv = "OPENAI_API_KEY"
+		}
+	}
+
+	if p.CacheDir == "" {
+		p.CacheDir = parsecache.DefaultDir
+	}
+
+	// the prices are used wherever usage is costed, so they are set globally
+	for model, price := range p.Prices {
+		if price.InputPerMillion < 0 || price.OutputPerMillion < 0 {
+			return fmt.Errorf("parser: prices of %s must not be negative", model)
+		}
+
+		services.ModelPrices[model] = services.ModelPrice{InputPerMillion: price.InputPerMillion, OutputPerMillion: price.OutputPerMillion}
+	}
+
+	if p.MaxAttempts == 0 {
+		p.MaxAttempts = services.DefaultMaxParseAttempts
+	} else if p.MaxAttempts < 0 {
+		return fmt.Errorf("parser: max_attempts must be at least 1, got %d", p.MaxAttempts)
+	}
+
+	switch p.Backend {
+	case ParserGemini, ParserOpenAI:
+	case ParserStub:
+		if p.StubFile == "" {
+			return fmt.Errorf("parser: the stub backend needs a stub_file")
+		}
+
+		if p.EscalationModel != "" {
+			return fmt.Errorf("parser: the stub backend has no model to escalate from")
+		}
+	default:
+		return fmt.Errorf("parser: unknown backend %q, expected one of: %s, %s, %s", p.Backend, ParserGemini, ParserOpenAI, ParserStub)
+	}
+
+	return nil
+}
+
+// NewReceiptParser builds the configured receipt parser.
+func (c *Config) NewReceiptParser(ctx context.Context) (services.ReceiptParser, error) {
+	switch c.Parser.Backend {
+	case ParserOpenAI:
+		// local servers usually don't need a key
+		return services.NewOpenAIParser(c.Parser.BaseURL, os.Getenv(c.Parser.APIKeyEnv), c.Parser.Model), nil
+
+	case ParserStub:
+		return services.LoadStubParser(c.Parser.StubFile)
+
+	default:
+		apiKey, err := requireEnv(c.Parser.APIKeyEnv)
+		if err != nil {
+			return nil, err
+		}
+
+		client, err := genai.NewClient(ctx, &genai.ClientConfig{
+			APIKey: apiKey,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("Failed to initiate AI Client: %w", err)
+		}
+
+		parser := services.NewGeminiParser(client, c.Parser.Model)
+		parser.ResponseSchema = !c.Parser.DisableResponseSchema
+
+		return parser, nil
+	}
+}
+
+// NewReceiptReader builds a receipt reader around the configured parser,
+// escalating to the configured escalation model on the last attempt. Model
+// answers are cached unless the cache is disabled.
+func (c *Config) NewReceiptReader(ctx context.Context) (*services.ReceiptReader, error) {
+	parser, err := c.NewReceiptParser(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var escalation services.ReceiptParser
+	if model := c.Parser.EscalationModel; model != "" {
+		switch p := parser.(type) {
+		case *services.GeminiParser:
+			e := *p
+			e.Model = model
+			escalation = &e
+		case *services.OpenAIParser:
+			e := *p
+			e.Model = model
+			escalation = &e
+		}
+	}
+
+	// stub answers cost nothing to recompute
+	if !c.Parser.DisableCache && c.Parser.Backend != ParserStub {
+		cache := parsecache.NewStore(c.Parser.CacheDir)
+
+		parser = parsecache.Wrap(parser, cache)
+		if escalation != nil {
+			escalation = parsecache.Wrap(escalation, cache)
+		}
+	}
+
+	opts := []services.ReceiptReaderOption{services.WithMaxParseAttempts(c.Parser.MaxAttempts)}
+	if c.Parser.PromptsDir != "" {
+		templates, err := services.LoadPromptTemplates(prompts.FS, os.DirFS(c.Parser.PromptsDir))
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, services.WithPromptTemplates(templates))
+	}
+
+	if escalation != nil {
+		opts = append(opts, services.WithEscalation(escalation))
+	}
+
+	return services.NewReceiptReader(parser, opts...), nil
+}
+
+// tableEnvVar converts a table name such as "PurchaseEvent" to
+// BASEROW_TABLE_PURCHASE_EVENT.
+func tableEnvVar(tableName string) string {
+	isUpper := func(r byte) bool { return r >= 'A' && r <= 'Z' }
+
+	// split words at case changes, keeping acronyms together: AIUsage
+	// becomes AI_USAGE
+	var b strings.Builder
+	for i := 0; i < len(tableName); i++ {
+		c := tableName[i]
+		if i > 0 && isUpper(c) {
+			prevLower := !isUpper(tableName[i-1])
+			nextLower := i+1 < len(tableName) && !isUpper(tableName[i+1])
+			if prevLower || nextLower {
+				b.WriteByte('_')
+			}
+		}
+		b.WriteByte(c)
+	}
+
+	return "BASEROW_TABLE_" + strings.ToUpper(b.String())
+}
+
+func (c *Config) validate() error {
+	if len(c.Tenants) == 0 {
+		return fmt.Errorf("no tenants configured")
+	}
+
+	seen := make(map[string]bool)
+	for _, t := range c.Tenants {
+		if t.Name == "" {
+			return fmt.Errorf("tenant without a name")
+		}
+
+		if seen[t.Name] {
+			return fmt.Errorf("duplicate tenant %q", t.Name)
+		}
+		seen[t.Name] = true
+
+		if t.AIMonthlyBudgetUSD < 0 {
+			return fmt.Errorf("tenant %q: ai_monthly_budget_usd must not be negative", t.Name)
+		}
+
+		t.applyDefaults()
+
+		for tableName := range t.Baserow.Tables {
+			if !isKnownTable(tableName) {
+				return fmt.Errorf("tenant %q: unknown table %q, expected one of: %s", t.Name, tableName, strings.Join(models.BaserowTableNames, ", "))
+			}
+		}
+	}
+
+	if c.DefaultTenant == "" {
+		c.DefaultTenant = c.Tenants[0].Name
+	}
+
+	if err := c.Parser.applyDefaults(); err != nil {
+		return err
+	}
+
+	if !seen[c.DefaultTenant] {
+		return fmt.Errorf("default tenant %q is not configured", c.DefaultTenant)
+	}
+
+	return c.checkModelPrices()
+}
+
+// checkModelPrices refuses models without a price when a tenant has an AI
+// budget, as their calls would be counted as free.
+func (c *Config) checkModelPrices() error {
+	if c.Parser.Backend == ParserStub {
+		return nil
+	}
+
+	model := c.Parser.Model
+	if model == "" && c.Parser.Backend == ParserGemini {
+		model = services.DefaultGeminiModel
+	}
+
+	for _, t := range c.Tenants {
+		if t.AIMonthlyBudgetUSD <= 0 {
+			continue
+		}
+
+		for _, m := range []string{model, c.Parser.EscalationModel} {
+			if _, ok := services.ModelPrices[m]; m != "" && !ok {
+				return fmt.Errorf("tenant %q: ai_monthly_budget_usd needs a price for model %q; add it to parser.prices", t.Name, m)
+			}
+		}
+	}
+
+	return nil
+}
+
+func (t *Tenant) applyDefaults() {
+	if t.Baserow.BaseURL == "" {
+		t.Baserow.BaseURL = DefaultBaserowBaseURL
+	}
+
+	if t.Baserow.APIKeyEnv == "" {
+		t.Baserow.APIKeyEnv = DefaultBaserowKeyEnv
+	}
+
+	if t.Mercury.BaseURL == "" {
+		t.Mercury.BaseURL = services.DefaultMercuryBaseURL
+	}
+
+	if t.Mercury.APIKeyEnv == "" {
+		t.Mercury.APIKeyEnv = DefaultBankKeyEnv
+	}
+
+	if t.Mercury.WebhookSecretEnv == "" {
+		t.Mercury.WebhookSecretEnv = DefaultWebhookKeyEnv
+	}
+}
+
+func isKnownTable(name string) bool {
+	for _, known := range models.BaserowTableNames {
+		if name == known {
+			return true
+		}
+	}
+	return false
+}
+
+// Tenant returns the named tenant, or the default tenant if name is empty.
+func (c *Config) Tenant(name string) (*Tenant, error) {
+	if name == "" {
+		name = c.DefaultTenant
+	}
+
+	for _, t := range c.Tenants {
+		if t.Name == name {
+			return t, nil
+		}
+	}
+
+	return nil, fmt.Errorf("unknown tenant %q", name)
+}
+
+func (t *Tenant) BaserowAPIKey() (string, error) {
+	return requireEnv(t.Baserow.APIKeyEnv)
+}
+
+func (t *Tenant) BankAPIKey() (string, error) {
+	return requireEnv(t.Mercury.APIKeyEnv)
+}
+
+// WebhookSecret returns the tenant's Mercury webhook secret, or "" if webhooks
+// are not set up for it.
+func (t *Tenant) WebhookSecret() string {
+	return os.Getenv(t.Mercury.WebhookSecretEnv)
+}
+
+// NewBaserowClient builds a client for the tenant's Baserow database.
+func (t *Tenant) NewBaserowClient(opts ...models.BaserowClientOption) (*models.BaserowClient, error) {
+	apiKey, err := t.BaserowAPIKey()
+	if err != nil {
+		return nil, fmt.Errorf("tenant %q: %w", t.Name, err)
+	}
+
+	opts = append([]models.BaserowClientOption{models.WithTableIDs(t.Baserow.Tables)}, opts...)
+
+	return models.NewBaserowClient(t.Baserow.BaseURL, apiKey, opts...), nil
+}
+
+// NewMercuryClient builds a client for the tenant's bank accounts.
+func (t *Tenant) NewMercuryClient(opts ...services.MercuryClientOption) (*services.MercuryClient, error) {
+	apiKey, err := t.BankAPIKey()
+	if err != nil {
+		return nil, fmt.Errorf("tenant %q: %w", t.Name, err)
+	}
+
+	opts = append([]services.MercuryClientOption{
+		services.WithMercuryBaseURL(t.Mercury.BaseURL),
+		services.WithMercuryAccounts(t.Mercury.Accounts.Include, t.Mercury.Accounts.Exclude),
+	}, opts...)
+
+	return services.NewMercuryClient(apiKey, opts...), nil
+}
+
+func requireEnv(name string) (string, error) {
+	value := os.Getenv(name)
+	if value == "" {
+		return "", fmt.Errorf("%s environment variable is not set", name)
+	}
+	return value, nil
+}
+
+// SaveTableIDs writes the tenant's table IDs into the YAML file at path,
+// keeping the rest of the file as it is. Comments are not preserved.
+func SaveTableIDs(path, tenantName string, tableIDs map[string]string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("config.SaveTableIDs: failed to read %s: %w", path, err)
+	}
+
+	var doc yaml.MapSlice
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return fmt.Errorf("config.SaveTableIDs: failed to parse %s: %w", path, err)
+	}
+
+	tables := yaml.MapSlice{}
+	for _, name := range models.BaserowTableNames {
+		if id, ok := tableIDs[name]; ok {
+			tables = append(tables, yaml.MapItem{Key: name, Value: id})
+		}
+	}
+
+	tenants, _ := lookup(doc, "tenants").([]interface{})
+	for i, t := range tenants {
+		tenant, ok := t.(yaml.MapSlice)
+		if !ok || lookup(tenant, "name") != tenantName {
+			continue
+		}
+
+		baserow, _ := lookup(tenant, "baserow").(yaml.MapSlice)
+		tenants[i] = set(tenant, "baserow", set(baserow, "tables", tables))
+
+		out, err := yaml.Marshal(set(doc, "tenants", tenants))
+		if err != nil {
+			return fmt.Errorf("config.SaveTableIDs: %w", err)
+		}
+
+		if err := os.WriteFile(path, out, 0o644); err != nil {
+			return fmt.Errorf("config.SaveTableIDs: failed to write %s: %w", path, err)
+		}
+
+		return nil
+	}
+
+	return fmt.Errorf("config.SaveTableIDs: tenant %q not found in %s", tenantName, path)
+}
+
+func lookup(m yaml.MapSlice, key string) interface{} {
+	for _, item := range m {
+		if item.Key == key {
+			return item.Value
+		}
+	}
+	return nil
+}
+
+func set(m yaml.MapSlice, key string, value interface{}) yaml.MapSlice {
+	for i, item := range m {
+		if item.Key == key {
+			m[i].Value = value
+			return m
+		}
+	}
+	return append(m, yaml.MapItem{Key: key, Value: value})
+}
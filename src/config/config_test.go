@@ -0,0 +1,45 @@
+package config_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jiaming2012/receipt-bot/src/config"
+	"github.com/jiaming2012/receipt-bot/src/services"
+)
+
+func writeConfig(t *testing.T, yaml string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(yaml), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadRefusesUnpricedModelsWithABudget(t *testing.T) {
+	const tenant = `
+tenants:
+  - name: main
+    ai_monthly_budget_usd: 20
+`
+	_, err := config.Load(writeConfig(t, "parser:\n  backend: openai\n  model: llava\n"+tenant))
+	if err == nil || !strings.Contains(err.Error(), `"llava"`) {
+		t.Fatalf("expected the unpriced model to be refused, got %v", err)
+	}
+
+	t.Cleanup(func() { delete(services.ModelPrices, "llava") })
+
+	priced := "parser:\n  backend: openai\n  model: llava\n  prices:\n    llava: {input_per_million: 0.05, output_per_million: 0.2}\n"
+	if _, err := config.Load(writeConfig(t, priced+tenant)); err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+
+	cost, known := services.Usage{Parser: "openai/llava", InputTokens: 1_000_000, OutputTokens: 1_000_000}.Cost()
+	if !known || cost != 0.25 {
+		t.Errorf("expected the configured price to be used, got $%v (known %v)", cost, known)
+	}
+}
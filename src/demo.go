@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// maxDemoJobs is how many /demo runs are kept for their status to be read.
+const maxDemoJobs = 20
+
+const (
+	demoJobRunning = "running"
+	demoJobDone    = "done"
+	demoJobFailed  = "failed"
+)
+
+// demoJob is an ingest run started by GET /demo, which can take longer than a
+// client or a graceful shutdown waits for a response.
+type demoJob struct {
+	ID     string `json:"id"`
+	Status string `json:"status"`
+	IngestResponse
+}
+
+// handleDemo starts an ingest run in the background and returns its job, whose
+// status is then read from GET /demo/{id}. Only one run, from /demo or a
+// webhook, writes to Baserow at a time.
+func (s *Server) handleDemo(w http.ResponseWriter, r *http.Request) {
+	tenant, err := s.tenant(r)
+	if err != nil {
+		writeJSON(w, http.StatusNotFound, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	days, err := parseDays(r, defaultIngestDays)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	if !s.ingestMu.TryLock() {
+		writeJSON(w, http.StatusConflict, ErrorResponse{Error: "ingestion already in progress"})
+		return
+	}
+
+	end := time.Now()
+	start := end.AddDate(0, 0, -days)
+
+	job := s.addDemoJob(IngestResponse{
+		Tenant: tenant.Name,
+		Start:  start.Format(time.DateOnly),
+		End:    end.Format(time.DateOnly),
+	})
+
+	s.jobs.Add(1)
+	go func() {
+		defer s.jobs.Done()
+		defer s.ingestMu.Unlock()
+
+		result, err := run_ingest_receipts(s.jobsCtx, s.reader, tenant.AIUsage, tenant.BaserowClient, tenant.BankClient, start, end)
+		if err != nil {
+			log.Errorf("Failed to ingest receipts: %v", err)
+		}
+
+		s.finishDemoJob(job.ID, result, err)
+	}()
+
+	w.Header().Set("Location", "/demo/"+job.ID)
+	writeJSON(w, http.StatusAccepted, job)
+}
+
+func (s *Server) handleDemoStatus(w http.ResponseWriter, r *http.Request) {
+	s.demoMu.Lock()
+	job, ok := s.demoJobs[r.PathValue("id")]
+	var resp demoJob
+	if ok {
+		resp = *job
+	}
+	s.demoMu.Unlock()
+
+	if !ok {
+		writeJSON(w, http.StatusNotFound, ErrorResponse{Error: "unknown job"})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// addDemoJob records a running job, forgetting the oldest once there are
+// more than maxDemoJobs, and returns a copy of it.
+func (s *Server) addDemoJob(resp IngestResponse) demoJob {
+	s.demoMu.Lock()
+	defer s.demoMu.Unlock()
+
+	s.demoSeq++
+	job := &demoJob{ID: strconv.Itoa(s.demoSeq), Status: demoJobRunning, IngestResponse: resp}
+
+	s.demoJobs[job.ID] = job
+	s.demoOrder = append(s.demoOrder, job.ID)
+	if len(s.demoOrder) > maxDemoJobs {
+		delete(s.demoJobs, s.demoOrder[0])
+		s.demoOrder = s.demoOrder[1:]
+	}
+
+	return *job
+}
+
+func (s *Server) finishDemoJob(id string, result *IngestResult, err error) {
+	s.demoMu.Lock()
+	defer s.demoMu.Unlock()
+
+	job, ok := s.demoJobs[id]
+	if !ok {
+		return
+	}
+
+	job.Result = result
+	job.Status = demoJobDone
+	if err != nil {
+		job.Status = demoJobFailed
+		job.Error = err.Error()
+	}
+}
+
+// waitForJobs waits for the running /demo jobs to finish. Once ctx is done
+// they are cancelled, and it returns when they have stopped.
+func (s *Server) waitForJobs(ctx context.Context) {
+	done := make(chan struct{})
+	go func() {
+		s.jobs.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return
+	case <-ctx.Done():
+	}
+
+	log.Warn("Cancelling the running ingest")
+	s.cancelJobs()
+	<-done
+}
@@ -0,0 +1,450 @@
+// Package eval scores a receipt reader against golden receipts: receipt files
+// paired with the hand-verified receipt they should parse to.
+package eval
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/antzucaro/matchr"
+
+	"github.com/jiaming2012/receipt-bot/src/models"
+	"github.com/jiaming2012/receipt-bot/src/services"
+)
+
+const (
+	// ExpectedFile holds a case's hand-verified models.Receipt.
+	ExpectedFile = "expected.json"
+	// TransactionFile optionally holds the case's models.MercuryTransaction,
+	// e.g. for its bank description. Without one the transaction amount is
+	// the expected total.
+	TransactionFile = "transaction.json"
+)
+
+// Case is one golden receipt: a directory holding ExpectedFile, an optional
+// TransactionFile and the receipt files, read in name order.
+type Case struct {
+	Name        string
+	Files       []string
+	Expected    models.Receipt
+	Transaction *models.MercuryTransaction
+}
+
+// LoadCases reads every case directory in dir.
+func LoadCases(dir string) ([]*Case, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("LoadCases: %w", err)
+	}
+
+	var cases []*Case
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+
+		c, err := loadCase(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("LoadCases: %s: %w", entry.Name(), err)
+		}
+
+		cases = append(cases, c)
+	}
+
+	if len(cases) == 0 {
+		return nil, fmt.Errorf("LoadCases: no cases in %s", dir)
+	}
+
+	return cases, nil
+}
+
+func loadCase(dir string) (*Case, error) {
+	c := &Case{Name: filepath.Base(dir)}
+
+	if err := readJSON(filepath.Join(dir, ExpectedFile), &c.Expected); err != nil {
+		return nil, err
+	}
+
+	var tx models.MercuryTransaction
+	if err := readJSON(filepath.Join(dir, TransactionFile), &tx); err == nil {
+		c.Transaction = &tx
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, entry := range entries {
+		if entry.IsDir() || entry.Name() == ExpectedFile || entry.Name() == TransactionFile {
+			continue
+		}
+		c.Files = append(c.Files, filepath.Join(dir, entry.Name()))
+	}
+
+	if len(c.Files) == 0 {
+		return nil, fmt.Errorf("no receipt files")
+	}
+
+	return c, nil
+}
+
+func readJSON(path string, v interface{}) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("failed to parse %s: %w", filepath.Base(path), err)
+	}
+
+	return nil
+}
+
+// Scores compares a parsed receipt with the expected one. Expected lines are
+// matched to parsed lines by name; a line's price and quantity only count if
+// its name matched.
+type Scores struct {
+	Vendor            bool `json:"vendor"`
+	Total             bool `json:"total"`
+	Tax               bool `json:"tax"`
+	LineCount         bool `json:"line_count"`
+	ExpectedLines     int  `json:"expected_lines"`
+	MatchedNames      int  `json:"matched_names"`
+	MatchedPrices     int  `json:"matched_prices"`
+	MatchedQuantities int  `json:"matched_quantities"`
+}
+
+// Score compares got with expected.
+func Score(expected, got models.Receipt) Scores {
+	s := Scores{
+		Vendor:        normalize(expected.Summary.Vendor) == normalize(got.Summary.Vendor),
+		Total:         sameAmount(expected.Summary.Total, got.Summary.Total),
+		Tax:           sameAmount(expected.Summary.Tax, got.Summary.Tax),
+		LineCount:     len(expected.Items) == len(got.Items),
+		ExpectedLines: len(expected.Items),
+	}
+
+	used := make([]bool, len(got.Items))
+	for _, want := range expected.Items {
+		i := matchLine(want, got.Items, used)
+		if i < 0 {
+			continue
+		}
+
+		used[i] = true
+		s.MatchedNames++
+		if sameAmount(want.Price, got.Items[i].Price) {
+			s.MatchedPrices++
+		}
+		if want.Quantity == got.Items[i].Quantity {
+			s.MatchedQuantities++
+		}
+	}
+
+	return s
+}
+
+// matchLine returns the index of the unused line with the same name as want,
+// falling back to the closest name by Jaro-Winkler, or -1.
+func matchLine(want models.ReceiptItem, lines []models.ReceiptItem, used []bool) int {
+	name := normalize(want.Name)
+
+	best, bestScore := -1, 0.0
+	for i, line := range lines {
+		if used[i] {
+			continue
+		}
+
+		if normalize(line.Name) == name {
+			return i
+		}
+
+		if score := matchr.JaroWinkler(name, normalize(line.Name), true); score > bestScore {
+			best, bestScore = i, score
+		}
+	}
+
+	if bestScore >= 0.85 {
+		return best
+	}
+
+	return -1
+}
+
+func normalize(s string) string {
+	return strings.Join(strings.Fields(strings.ToLower(s)), " ")
+}
+
+func sameAmount(a, b float64) bool {
+	return math.Abs(a-b) < 0.005
+}
+
+// CaseResult is how the reader did on one case.
+type CaseResult struct {
+	Name          string          `json:"name"`
+	PromptVersion string          `json:"prompt_version,omitempty"`
+	Error         string          `json:"error,omitempty"`
+	Valid         bool            `json:"valid"`
+	Attempts      int             `json:"attempts"`
+	LatencyMS     int64           `json:"latency_ms"`
+	InputTokens   int             `json:"input_tokens"`
+	OutputTokens  int             `json:"output_tokens"`
+	CostUSD       float64         `json:"cost_usd"`
+	Scores        Scores          `json:"scores"`
+	Got           *models.Receipt `json:"got,omitempty"`
+}
+
+// Summary aggregates the case results. Failed cases count as wrong in every
+// accuracy. Item accuracies are over all expected lines.
+type Summary struct {
+	Cases                int     `json:"cases"`
+	Errors               int     `json:"errors"`
+	VendorAccuracy       float64 `json:"vendor_accuracy"`
+	TotalAccuracy        float64 `json:"total_accuracy"`
+	TaxAccuracy          float64 `json:"tax_accuracy"`
+	LineCountAccuracy    float64 `json:"line_count_accuracy"`
+	ItemNameAccuracy     float64 `json:"item_name_accuracy"`
+	ItemPriceAccuracy    float64 `json:"item_price_accuracy"`
+	ItemQuantityAccuracy float64 `json:"item_quantity_accuracy"`
+	ValidationPassRate   float64 `json:"validation_pass_rate"`
+	MeanAttempts         float64 `json:"mean_attempts"`
+	MeanLatencyMS        int64   `json:"mean_latency_ms"`
+	MaxLatencyMS         int64   `json:"max_latency_ms"`
+	InputTokens          int     `json:"input_tokens"`
+	OutputTokens         int     `json:"output_tokens"`
+	CostUSD              float64 `json:"cost_usd"`
+}
+
+// Report is the result of one eval run, written as JSON so runs can be
+// compared.
+type Report struct {
+	Parser      string        `json:"parser"`
+	Escalation  string        `json:"escalation,omitempty"`
+	MaxAttempts int           `json:"max_attempts"`
+	StartedAt   time.Time     `json:"started_at"`
+	Summary     Summary       `json:"summary"`
+	Cases       []*CaseResult `json:"cases"`
+}
+
+// Run reads every case with reader, one at a time, and scores the results.
+func Run(ctx context.Context, reader *services.ReceiptReader, cases []*Case) *Report {
+	report := &Report{
+		Parser:      reader.Parser.Name(),
+		MaxAttempts: reader.MaxAttempts,
+		StartedAt:   time.Now().UTC(),
+	}
+
+	if reader.Escalation != nil {
+		report.Escalation = reader.Escalation.Name()
+	}
+
+	for _, c := range cases {
+		report.Cases = append(report.Cases, runCase(ctx, reader, c))
+	}
+
+	report.Summary = summarize(report.Cases)
+
+	return report
+}
+
+func runCase(ctx context.Context, reader *services.ReceiptReader, c *Case) *CaseResult {
+	result := &CaseResult{Name: c.Name, Scores: Scores{ExpectedLines: len(c.Expected.Items)}}
+
+	tx := &models.MercuryTransaction{ID: c.Name, Amount: -c.Expected.Summary.Total}
+	if c.Transaction != nil {
+		tx = c.Transaction
+	}
+
+	var files []*services.ReceiptFile
+	for _, path := range c.Files {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			result.Error = err.Error()
+			return result
+		}
+
+		attachment := &models.MercuryTransactionAttachment{FileName: filepath.Base(path)}
+		file, err := services.PrepareReceiptFile(ctx, attachment, data, "")
+		if err != nil {
+			result.Error = err.Error()
+			return result
+		}
+
+		files = append(files, file)
+	}
+
+	recorder := &services.UsageRecorder{}
+	start := time.Now()
+
+	read, err := reader.ReadFiles(services.WithUsageRecorder(ctx, recorder), tx, files)
+
+	result.LatencyMS = time.Since(start).Milliseconds()
+	for _, call := range recorder.Calls() {
+		result.InputTokens += call.InputTokens
+		result.OutputTokens += call.OutputTokens
+		cost, _ := call.Cost()
+		result.CostUSD += cost
+	}
+
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	} else if errors.Is(read.Invalid, services.ErrParseFailed) {
+		result.Error = read.Invalid.Error()
+		return result
+	}
+
+	got := models.Receipt{Items: read.Items, Summary: read.Summary}
+
+	result.PromptVersion = read.PromptVersion
+	result.Valid = read.Invalid == nil
+	result.Attempts = len(read.Attempts)
+	result.Scores = Score(c.Expected, got)
+	result.Got = &got
+
+	return result
+}
+
+func summarize(cases []*CaseResult) Summary {
+	s := Summary{Cases: len(cases)}
+	if len(cases) == 0 {
+		return s
+	}
+
+	var vendor, total, tax, lineCount, valid, attempts int
+	var lines, names, prices, quantities int
+	var latency int64
+	for _, c := range cases {
+		if c.Error != "" {
+			s.Errors++
+		}
+
+		vendor += boolInt(c.Scores.Vendor)
+		total += boolInt(c.Scores.Total)
+		tax += boolInt(c.Scores.Tax)
+		lineCount += boolInt(c.Scores.LineCount)
+		valid += boolInt(c.Valid)
+		attempts += c.Attempts
+
+		lines += c.Scores.ExpectedLines
+		names += c.Scores.MatchedNames
+		prices += c.Scores.MatchedPrices
+		quantities += c.Scores.MatchedQuantities
+
+		latency += c.LatencyMS
+		s.MaxLatencyMS = max(s.MaxLatencyMS, c.LatencyMS)
+		s.InputTokens += c.InputTokens
+		s.OutputTokens += c.OutputTokens
+		s.CostUSD += c.CostUSD
+	}
+
+	n := float64(len(cases))
+	s.VendorAccuracy = float64(vendor) / n
+	s.TotalAccuracy = float64(total) / n
+	s.TaxAccuracy = float64(tax) / n
+	s.LineCountAccuracy = float64(lineCount) / n
+	s.ValidationPassRate = float64(valid) / n
+	s.MeanAttempts = float64(attempts) / n
+	s.MeanLatencyMS = latency / int64(len(cases))
+
+	if lines > 0 {
+		s.ItemNameAccuracy = float64(names) / float64(lines)
+		s.ItemPriceAccuracy = float64(prices) / float64(lines)
+		s.ItemQuantityAccuracy = float64(quantities) / float64(lines)
+	}
+
+	return s
+}
+
+func boolInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// LoadReport reads a report written by a previous run.
+func LoadReport(path string) (*Report, error) {
+	var report Report
+	if err := readJSON(path, &report); err != nil {
+		return nil, fmt.Errorf("LoadReport: %w", err)
+	}
+	return &report, nil
+}
+
+// Comparison lines up two reports' summaries and lists the cases whose
+// validation result differs.
+type Comparison struct {
+	Metrics []MetricComparison `json:"metrics"`
+	// Fixed passed validation in B but not A; Broken the other way round.
+	Fixed  []string `json:"fixed,omitempty"`
+	Broken []string `json:"broken,omitempty"`
+}
+
+type MetricComparison struct {
+	Name  string  `json:"name"`
+	A     float64 `json:"a"`
+	B     float64 `json:"b"`
+	Delta float64 `json:"delta"`
+}
+
+func Compare(a, b *Report) *Comparison {
+	c := &Comparison{}
+
+	metrics := []struct {
+		name string
+		get  func(Summary) float64
+	}{
+		{"vendor_accuracy", func(s Summary) float64 { return s.VendorAccuracy }},
+		{"total_accuracy", func(s Summary) float64 { return s.TotalAccuracy }},
+		{"tax_accuracy", func(s Summary) float64 { return s.TaxAccuracy }},
+		{"line_count_accuracy", func(s Summary) float64 { return s.LineCountAccuracy }},
+		{"item_name_accuracy", func(s Summary) float64 { return s.ItemNameAccuracy }},
+		{"item_price_accuracy", func(s Summary) float64 { return s.ItemPriceAccuracy }},
+		{"item_quantity_accuracy", func(s Summary) float64 { return s.ItemQuantityAccuracy }},
+		{"validation_pass_rate", func(s Summary) float64 { return s.ValidationPassRate }},
+		{"mean_attempts", func(s Summary) float64 { return s.MeanAttempts }},
+		{"mean_latency_ms", func(s Summary) float64 { return float64(s.MeanLatencyMS) }},
+		{"cost_usd", func(s Summary) float64 { return s.CostUSD }},
+	}
+
+	for _, m := range metrics {
+		va, vb := m.get(a.Summary), m.get(b.Summary)
+		c.Metrics = append(c.Metrics, MetricComparison{Name: m.name, A: va, B: vb, Delta: vb - va})
+	}
+
+	validA := make(map[string]bool)
+	for _, r := range a.Cases {
+		validA[r.Name] = r.Valid
+	}
+
+	for _, r := range b.Cases {
+		wasValid, ok := validA[r.Name]
+		if !ok {
+			continue
+		}
+
+		if r.Valid && !wasValid {
+			c.Fixed = append(c.Fixed, r.Name)
+		} else if !r.Valid && wasValid {
+			c.Broken = append(c.Broken, r.Name)
+		}
+	}
+
+	sort.Strings(c.Fixed)
+	sort.Strings(c.Broken)
+
+	return c
+}
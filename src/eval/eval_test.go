@@ -0,0 +1,109 @@
+package eval_test
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jiaming2012/receipt-bot/src/eval"
+	"github.com/jiaming2012/receipt-bot/src/models"
+	"github.com/jiaming2012/receipt-bot/src/services"
+)
+
+var corn = models.Receipt{
+	Items: []models.ReceiptItem{
+		{Name: "Sweet Corn", Quantity: 2, Price: 4.5},
+		{Name: "Limes", Quantity: 1, Price: 1},
+	},
+	Summary: models.ReceiptSummary{Vendor: "Farmers Market", Total: 10, TotalUnits: 3},
+}
+
+// writeCase writes a golden receipt whose photo is data.
+func writeCase(t *testing.T, dir, name string, data []byte, expected models.Receipt) {
+	caseDir := filepath.Join(dir, name)
+	if err := os.MkdirAll(caseDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(filepath.Join(caseDir, "receipt.jpg"), data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	out, _ := json.Marshal(expected)
+	if err := os.WriteFile(filepath.Join(caseDir, eval.ExpectedFile), out, 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRunScoresEachField(t *testing.T) {
+	dir := t.TempDir()
+
+	good := []byte("\xff\xd8\xff\xe0\x00\x10JFIF\x00good")
+	bad := []byte("\xff\xd8\xff\xe0\x00\x10JFIF\x00bad")
+	writeCase(t, dir, "good", good, corn)
+	writeCase(t, dir, "bad", bad, corn)
+
+	// the bad answer misreads the price of the corn and the vendor
+	misread := models.Receipt{
+		Items: []models.ReceiptItem{
+			{Name: "sweet  corn", Quantity: 2, Price: 5.4},
+			{Name: "Limes", Quantity: 1, Price: 1},
+		},
+		Summary: models.ReceiptSummary{Vendor: "Farmer's Mkt", Total: 10, TotalUnits: 3},
+	}
+
+	parser := &services.StubParser{Receipts: map[string]models.Receipt{
+		services.StubReceiptKey([]*services.ReceiptFile{{Data: good}}): corn,
+		services.StubReceiptKey([]*services.ReceiptFile{{Data: bad}}):  misread,
+	}}
+
+	cases, err := eval.LoadCases(dir)
+	if err != nil {
+		t.Fatalf("LoadCases: %v", err)
+	}
+
+	report := eval.Run(context.Background(), services.NewReceiptReader(parser, services.WithMaxParseAttempts(2)), cases)
+
+	s := report.Summary
+	if s.Cases != 2 || s.Errors != 0 {
+		t.Fatalf("expected 2 cases without errors, got %+v", s)
+	}
+
+	checks := map[string][2]float64{
+		"vendor":     {s.VendorAccuracy, 0.5},
+		"total":      {s.TotalAccuracy, 1},
+		"line count": {s.LineCountAccuracy, 1},
+		"names":      {s.ItemNameAccuracy, 1},
+		"prices":     {s.ItemPriceAccuracy, 0.75},
+		"quantities": {s.ItemQuantityAccuracy, 1},
+		"validation": {s.ValidationPassRate, 0.5},
+		"attempts":   {s.MeanAttempts, 1.5},
+	}
+	for name, c := range checks {
+		if c[0] != c[1] {
+			t.Errorf("%s: expected %v, got %v", name, c[1], c[0])
+		}
+	}
+
+	if report.Cases[0].PromptVersion != "default.v1" {
+		t.Errorf("expected the prompt version to be reported, got %q", report.Cases[0].PromptVersion)
+	}
+}
+
+func TestCompareListsFixedAndBrokenCases(t *testing.T) {
+	a := &eval.Report{
+		Summary: eval.Summary{ValidationPassRate: 0.5},
+		Cases:   []*eval.CaseResult{{Name: "sysco", Valid: false}, {Name: "depot", Valid: true}},
+	}
+	b := &eval.Report{
+		Summary: eval.Summary{ValidationPassRate: 0.5},
+		Cases:   []*eval.CaseResult{{Name: "sysco", Valid: true}, {Name: "depot", Valid: false}},
+	}
+
+	c := eval.Compare(a, b)
+	if len(c.Fixed) != 1 || c.Fixed[0] != "sysco" || len(c.Broken) != 1 || c.Broken[0] != "depot" {
+		t.Errorf("unexpected comparison: %+v", c)
+	}
+}
@@ -0,0 +1,1378 @@
+// Package fakes provides in-memory stand-ins for the external services the
+// pipeline talks to, for use in tests.
+package fakes
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/jiaming2012/receipt-bot/src/models"
+	"github.com/jiaming2012/receipt-bot/src/schema"
+)
+
+const (
+	FakeBaserowDatabaseID = 1
+	FakeBaserowToken      = "fake-database-token"
+	FakeBaserowJWT        = "fake-jwt"
+
+	fakeBaserowDefaultPageSize = 100
+	fakeBaserowMaxPageSize     = 200
+)
+
+// Baserow is an httptest server implementing the subset of the Baserow REST
+// API used by models.BaserowClient: row list, create, update, delete and batch
+// endpoints, and the table and field endpoints used for provisioning.
+//
+// Like Baserow it stores numbers as decimal strings rounded to the field's
+// decimal places, accepts link-row values as row IDs or primary field values,
+// returns link-row fields as [{"id", "value"}] and keeps both sides of a
+// related link in sync.
+type Baserow struct {
+	Server *httptest.Server
+
+	t  testing.TB
+	mu sync.Mutex
+
+	tables      map[int]*fakeTable
+	fields      map[int]*fakeField
+	nextTableID int
+	nextFieldID int
+
+	requests []string
+	failures []int // status codes returned by the next requests
+}
+
+type fakeTable struct {
+	ID        int
+	Name      string
+	Fields    []*fakeField
+	Rows      []*fakeRow // ordered by ID
+	NextRowID int
+}
+
+type fakeField struct {
+	ID             int
+	TableID        int
+	Name           string
+	Type           string
+	Primary        bool
+	DecimalPlaces  int
+	LinkTableID    int
+	RelatedFieldID int
+}
+
+type fakeRow struct {
+	ID     int
+	Values map[int]interface{} // field ID -> string, bool, []int or nil
+}
+
+// apiError is written as Baserow's {"error": ..., "detail": ...} error body.
+type apiError struct {
+	Status int         `json:"-"`
+	Code   string      `json:"error"`
+	Detail interface{} `json:"detail"`
+}
+
+func (e *apiError) Error() string {
+	return fmt.Sprintf("%d %s: %v", e.Status, e.Code, e.Detail)
+}
+
+func validationError(field, format string, args ...interface{}) *apiError {
+	return &apiError{
+		Status: http.StatusBadRequest,
+		Code:   "ERROR_REQUEST_BODY_VALIDATION",
+		Detail: map[string]interface{}{
+			field: []map[string]string{{"error": fmt.Sprintf(format, args...), "code": "invalid"}},
+		},
+	}
+}
+
+func rowNotFound(id int) *apiError {
+	return &apiError{Status: http.StatusNotFound, Code: "ERROR_ROW_DOES_NOT_EXIST", Detail: fmt.Sprintf("The row %d does not exist.", id)}
+}
+
+// NewEmptyBaserow starts a fake Baserow with an empty database. The server is
+// closed when the test ends.
+func NewEmptyBaserow(t testing.TB) *Baserow {
+	t.Helper()
+
+	f := &Baserow{
+		t:           t,
+		tables:      make(map[int]*fakeTable),
+		fields:      make(map[int]*fakeField),
+		nextTableID: 1000,
+		nextFieldID: 5000,
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /api/user/token-auth/", f.handleTokenAuth)
+	mux.HandleFunc("POST /api/database/tables/database/{database}/", f.requireJWT(f.handleCreateTable))
+	mux.HandleFunc("GET /api/database/fields/table/{table}/", f.handleListFields)
+	mux.HandleFunc("POST /api/database/fields/table/{table}/", f.requireJWT(f.handleCreateField))
+	mux.HandleFunc("PATCH /api/database/fields/{field}/", f.requireJWT(f.handleUpdateField))
+	mux.HandleFunc("GET /api/database/rows/table/{table}/", f.handleListRows)
+	mux.HandleFunc("POST /api/database/rows/table/{table}/", f.handleCreateRow)
+	mux.HandleFunc("PATCH /api/database/rows/table/{table}/{row}/", f.handleUpdateRow)
+	mux.HandleFunc("DELETE /api/database/rows/table/{table}/{row}/", f.handleDeleteRow)
+	mux.HandleFunc("POST /api/database/rows/table/{table}/batch/", f.handleBatchCreate)
+	mux.HandleFunc("PATCH /api/database/rows/table/{table}/batch/", f.handleBatchUpdate)
+	mux.HandleFunc("POST /api/database/rows/table/{table}/batch-delete/", f.handleBatchDelete)
+
+	f.Server = httptest.NewServer(f.middleware(mux))
+	t.Cleanup(f.Server.Close)
+
+	return f
+}
+
+// NewBaserow starts a fake Baserow whose database has been provisioned with
+// every table the models use.
+func NewBaserow(t testing.TB) *Baserow {
+	t.Helper()
+
+	f := NewEmptyBaserow(t)
+
+	client := models.NewBaserowClient(f.Server.URL, "", models.WithJWT(FakeBaserowJWT))
+	if _, err := schema.Provision(context.Background(), client, FakeBaserowDatabaseID); err != nil {
+		t.Fatalf("fakes.NewBaserow: failed to provision tables: %v", err)
+	}
+
+	// provisioning requests are not interesting to tests
+	f.mu.Lock()
+	f.requests = nil
+	f.mu.Unlock()
+
+	return f
+}
+
+// Client returns a client for the fake database that retries without waiting.
+func (f *Baserow) Client(opts ...models.BaserowClientOption) *models.BaserowClient {
+	opts = append([]models.BaserowClientOption{
+		models.WithTableIDs(f.TableIDs()),
+		models.WithRetryPolicy(2, time.Millisecond, time.Millisecond),
+	}, opts...)
+
+	return models.NewBaserowClient(f.Server.URL, FakeBaserowToken, opts...)
+}
+
+// TableIDs returns the ID of each table, keyed by table name.
+func (f *Baserow) TableIDs() map[string]string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	out := make(map[string]string)
+	for _, table := range f.tables {
+		out[table.Name] = strconv.Itoa(table.ID)
+	}
+	return out
+}
+
+// Requests returns "METHOD /path" for every request received so far.
+func (f *Baserow) Requests() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return append([]string(nil), f.requests...)
+}
+
+// FailNext makes the next len(statuses) requests fail with the given status
+// codes, in order, without being processed.
+func (f *Baserow) FailNext(statuses ...int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.failures = append(f.failures, statuses...)
+}
+
+// Seed creates rows in the named table and returns their IDs. Values are
+// given by field name, as they would be sent to the API.
+func (f *Baserow) Seed(tableName string, rows ...map[string]interface{}) []int {
+	f.t.Helper()
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	table := f.tableByName(tableName)
+	if table == nil {
+		f.t.Fatalf("fakes.Baserow.Seed: unknown table %s", tableName)
+	}
+
+	var ids []int
+	for i, values := range rows {
+		raw, err := json.Marshal(values)
+		if err != nil {
+			f.t.Fatalf("fakes.Baserow.Seed: %s row %d: %v", tableName, i, err)
+		}
+
+		row, apiErr := f.createRow(table, raw)
+		if apiErr != nil {
+			f.t.Fatalf("fakes.Baserow.Seed: %s row %d: %v", tableName, i, apiErr)
+		}
+		ids = append(ids, row.ID)
+	}
+
+	return ids
+}
+
+// SeedFile seeds the tables from a YAML file mapping table names to lists of
+// rows. Tables are seeded in models.BaserowTableNames order so that link-row
+// fields can refer to rows of earlier tables by their primary field value.
+func (f *Baserow) SeedFile(path string) {
+	f.t.Helper()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		f.t.Fatalf("fakes.Baserow.SeedFile: %v", err)
+	}
+
+	var fixtures map[string][]map[string]interface{}
+	if err := yaml.Unmarshal(data, &fixtures); err != nil {
+		f.t.Fatalf("fakes.Baserow.SeedFile: failed to parse %s: %v", path, err)
+	}
+
+	for name := range fixtures {
+		if f.TableIDs()[name] == "" {
+			f.t.Fatalf("fakes.Baserow.SeedFile: %s: unknown table %s", path, name)
+		}
+	}
+
+	for _, name := range models.BaserowTableNames {
+		if rows, ok := fixtures[name]; ok {
+			f.Seed(name, rows...)
+		}
+	}
+}
+
+// Rows returns the rows of the named table as the API renders them with
+// user_field_names=true.
+func (f *Baserow) Rows(tableName string) []map[string]interface{} {
+	f.t.Helper()
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	table := f.tableByName(tableName)
+	if table == nil {
+		f.t.Fatalf("fakes.Baserow.Rows: unknown table %s", tableName)
+	}
+
+	var out []map[string]interface{}
+	for _, row := range table.Rows {
+		out = append(out, f.renderRow(table, row, true, nil))
+	}
+	return out
+}
+
+func (f *Baserow) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		f.requests = append(f.requests, r.Method+" "+r.URL.Path)
+
+		var status int
+		if len(f.failures) > 0 {
+			status, f.failures = f.failures[0], f.failures[1:]
+		}
+		f.mu.Unlock()
+
+		if status != 0 {
+			writeAPIError(w, &apiError{Status: status, Code: "ERROR_INJECTED", Detail: "injected failure"})
+			return
+		}
+
+		if r.URL.Path != "/api/user/token-auth/" {
+			scheme, token, _ := strings.Cut(r.Header.Get("Authorization"), " ")
+			if (scheme != "Token" && scheme != "JWT") || token == "" {
+				writeAPIError(w, &apiError{Status: http.StatusUnauthorized, Code: "ERROR_INVALID_TOKEN", Detail: "missing or malformed Authorization header"})
+				return
+			}
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// requireJWT rejects database tokens, which Baserow does not accept for
+// creating tables and fields.
+func (f *Baserow) requireJWT(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.Header.Get("Authorization"), "JWT ") {
+			writeAPIError(w, &apiError{Status: http.StatusUnauthorized, Code: "ERROR_INVALID_ACCESS_TOKEN", Detail: "a user JWT is required"})
+			return
+		}
+		next(w, r)
+	}
+}
+
+func (f *Baserow) handleTokenAuth(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Email    string `json:"email"`
+		Password string `json:"password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.Email == "" || body.Password == "" {
+		writeAPIError(w, &apiError{Status: http.StatusUnauthorized, Code: "ERROR_INVALID_CREDENTIALS", Detail: "email and password are required"})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]string{"access_token": FakeBaserowJWT, "token": FakeBaserowJWT})
+}
+
+func (f *Baserow) handleCreateTable(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Name           string     `json:"name"`
+		Data           [][]string `json:"data"`
+		FirstRowHeader bool       `json:"first_row_header"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.Name == "" {
+		writeAPIError(w, validationError("name", "a table name is required"))
+		return
+	}
+
+	primary := "Name"
+	if body.FirstRowHeader && len(body.Data) > 0 && len(body.Data[0]) > 0 {
+		primary = body.Data[0][0]
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.nextTableID++
+	table := &fakeTable{ID: f.nextTableID, Name: body.Name}
+	f.tables[table.ID] = table
+	f.addField(table, &fakeField{Name: primary, Type: "text", Primary: true})
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"id":          table.ID,
+		"name":        table.Name,
+		"order":       len(f.tables),
+		"database_id": FakeBaserowDatabaseID,
+	})
+}
+
+func (f *Baserow) handleListFields(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	table, apiErr := f.tableFromPath(r)
+	if apiErr != nil {
+		writeAPIError(w, apiErr)
+		return
+	}
+
+	out := make([]map[string]interface{}, 0, len(table.Fields))
+	for _, field := range table.Fields {
+		out = append(out, renderField(field))
+	}
+
+	writeJSON(w, http.StatusOK, out)
+}
+
+func (f *Baserow) handleCreateField(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Name                string `json:"name"`
+		Type                string `json:"type"`
+		NumberDecimalPlaces int    `json:"number_decimal_places"`
+		LinkRowTableID      int    `json:"link_row_table_id"`
+		HasRelatedField     *bool  `json:"has_related_field"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeAPIError(w, validationError("body", "invalid JSON: %v", err))
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	table, apiErr := f.tableFromPath(r)
+	if apiErr != nil {
+		writeAPIError(w, apiErr)
+		return
+	}
+
+	if body.Name == "" || body.Type == "" {
+		writeAPIError(w, validationError("name", "name and type are required"))
+		return
+	}
+
+	if fieldByName(table, body.Name) != nil {
+		writeAPIError(w, &apiError{Status: http.StatusBadRequest, Code: "ERROR_FIELD_WITH_SAME_NAME_ALREADY_EXISTS", Detail: fmt.Sprintf("field %q already exists", body.Name)})
+		return
+	}
+
+	field := &fakeField{Name: body.Name, Type: body.Type, DecimalPlaces: body.NumberDecimalPlaces}
+
+	var related []map[string]interface{}
+	if body.Type == "link_row" {
+		target, ok := f.tables[body.LinkRowTableID]
+		if !ok {
+			writeAPIError(w, validationError("link_row_table_id", "table %d does not exist", body.LinkRowTableID))
+			return
+		}
+		field.LinkTableID = target.ID
+
+		f.addField(table, field)
+
+		// Baserow creates the reverse field unless told not to, named after
+		// the source table
+		if (body.HasRelatedField == nil || *body.HasRelatedField) && target.ID != table.ID {
+			name := table.Name
+			for i := 2; fieldByName(target, name) != nil; i++ {
+				name = fmt.Sprintf("%s - %s %d", table.Name, body.Name, i)
+			}
+
+			reverse := &fakeField{Name: name, Type: "link_row", LinkTableID: table.ID, RelatedFieldID: field.ID}
+			f.addField(target, reverse)
+			field.RelatedFieldID = reverse.ID
+			related = append(related, renderField(reverse))
+		}
+	} else {
+		f.addField(table, field)
+	}
+
+	out := renderField(field)
+	out["related_fields"] = related
+	writeJSON(w, http.StatusOK, out)
+}
+
+func (f *Baserow) handleUpdateField(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Name string `json:"name"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeAPIError(w, validationError("body", "invalid JSON: %v", err))
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	id, _ := strconv.Atoi(r.PathValue("field"))
+	field, ok := f.fields[id]
+	if !ok {
+		writeAPIError(w, &apiError{Status: http.StatusNotFound, Code: "ERROR_FIELD_DOES_NOT_EXIST", Detail: fmt.Sprintf("field %d does not exist", id)})
+		return
+	}
+
+	if body.Name != "" && body.Name != field.Name {
+		if fieldByName(f.tables[field.TableID], body.Name) != nil {
+			writeAPIError(w, &apiError{Status: http.StatusBadRequest, Code: "ERROR_FIELD_WITH_SAME_NAME_ALREADY_EXISTS", Detail: fmt.Sprintf("field %q already exists", body.Name)})
+			return
+		}
+		field.Name = body.Name
+	}
+
+	writeJSON(w, http.StatusOK, renderField(field))
+}
+
+func (f *Baserow) handleListRows(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	table, apiErr := f.tableFromPath(r)
+	if apiErr != nil {
+		writeAPIError(w, apiErr)
+		return
+	}
+
+	q := r.URL.Query()
+	userFieldNames := q.Get("user_field_names") == "true"
+
+	rows, apiErr := f.filterRows(table, q, userFieldNames)
+	if apiErr != nil {
+		writeAPIError(w, apiErr)
+		return
+	}
+
+	if apiErr := f.sortRows(table, rows, q.Get("order_by"), userFieldNames); apiErr != nil {
+		writeAPIError(w, apiErr)
+		return
+	}
+
+	size := fakeBaserowDefaultPageSize
+	if s := q.Get("size"); s != "" {
+		size, _ = strconv.Atoi(s)
+	}
+	if size < 1 || size > fakeBaserowMaxPageSize {
+		writeAPIError(w, &apiError{Status: http.StatusBadRequest, Code: "ERROR_QUERY_PARAMETER_VALIDATION", Detail: fmt.Sprintf("size must be between 1 and %d", fakeBaserowMaxPageSize)})
+		return
+	}
+
+	page := 1
+	if p := q.Get("page"); p != "" {
+		page, _ = strconv.Atoi(p)
+	}
+	start := (page - 1) * size
+	if page < 1 || (start >= len(rows) && page != 1) {
+		writeAPIError(w, &apiError{Status: http.StatusNotFound, Code: "ERROR_INVALID_PAGE", Detail: fmt.Sprintf("page %d does not exist", page)})
+		return
+	}
+	end := min(start+size, len(rows))
+
+	fieldSet, apiErr := includedFields(table, q, userFieldNames)
+	if apiErr != nil {
+		writeAPIError(w, apiErr)
+		return
+	}
+
+	results := make([]map[string]interface{}, 0, end-start)
+	for _, row := range rows[start:end] {
+		results = append(results, f.renderRow(table, row, userFieldNames, fieldSet))
+	}
+
+	var next, previous interface{}
+	if end < len(rows) {
+		next = f.pageURL(r, page+1)
+	}
+	if page > 1 {
+		previous = f.pageURL(r, page-1)
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"count":    len(rows),
+		"next":     next,
+		"previous": previous,
+		"results":  results,
+	})
+}
+
+func (f *Baserow) handleCreateRow(w http.ResponseWriter, r *http.Request) {
+	raw, apiErr := readBody(r)
+	if apiErr != nil {
+		writeAPIError(w, apiErr)
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	table, apiErr := f.tableFromPath(r)
+	if apiErr != nil {
+		writeAPIError(w, apiErr)
+		return
+	}
+
+	row, apiErr := f.createRow(table, raw)
+	if apiErr != nil {
+		writeAPIError(w, apiErr)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, f.renderRow(table, row, userFieldNames(r), nil))
+}
+
+func (f *Baserow) handleUpdateRow(w http.ResponseWriter, r *http.Request) {
+	raw, apiErr := readBody(r)
+	if apiErr != nil {
+		writeAPIError(w, apiErr)
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	table, apiErr := f.tableFromPath(r)
+	if apiErr != nil {
+		writeAPIError(w, apiErr)
+		return
+	}
+
+	id, _ := strconv.Atoi(r.PathValue("row"))
+	row := findRow(table, id)
+	if row == nil {
+		writeAPIError(w, rowNotFound(id))
+		return
+	}
+
+	values, apiErr := f.parseValues(table, raw, userFieldNames(r))
+	if apiErr != nil {
+		writeAPIError(w, apiErr)
+		return
+	}
+
+	f.setValues(table, row, values)
+
+	writeJSON(w, http.StatusOK, f.renderRow(table, row, userFieldNames(r), nil))
+}
+
+func (f *Baserow) handleDeleteRow(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	table, apiErr := f.tableFromPath(r)
+	if apiErr != nil {
+		writeAPIError(w, apiErr)
+		return
+	}
+
+	id, _ := strconv.Atoi(r.PathValue("row"))
+	if findRow(table, id) == nil {
+		writeAPIError(w, rowNotFound(id))
+		return
+	}
+
+	f.deleteRow(table, id)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Batch endpoints validate every item before writing any, so a single bad
+// item rejects the whole request, as in Baserow.
+
+func (f *Baserow) handleBatchCreate(w http.ResponseWriter, r *http.Request) {
+	items, apiErr := readBatchItems(r)
+	if apiErr != nil {
+		writeAPIError(w, apiErr)
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	table, apiErr := f.tableFromPath(r)
+	if apiErr != nil {
+		writeAPIError(w, apiErr)
+		return
+	}
+
+	parsed := make([]map[int]interface{}, len(items))
+	for i, item := range items {
+		if parsed[i], apiErr = f.parseValues(table, item, userFieldNames(r)); apiErr != nil {
+			writeAPIError(w, apiErr)
+			return
+		}
+	}
+
+	out := make([]map[string]interface{}, 0, len(items))
+	for _, values := range parsed {
+		row := f.insertRow(table)
+		f.setValues(table, row, values)
+		out = append(out, f.renderRow(table, row, userFieldNames(r), nil))
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{"items": out})
+}
+
+func (f *Baserow) handleBatchUpdate(w http.ResponseWriter, r *http.Request) {
+	items, apiErr := readBatchItems(r)
+	if apiErr != nil {
+		writeAPIError(w, apiErr)
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	table, apiErr := f.tableFromPath(r)
+	if apiErr != nil {
+		writeAPIError(w, apiErr)
+		return
+	}
+
+	rows := make([]*fakeRow, len(items))
+	parsed := make([]map[int]interface{}, len(items))
+	for i, item := range items {
+		var ref struct {
+			ID int `json:"id"`
+		}
+		if err := json.Unmarshal(item, &ref); err != nil || ref.ID == 0 {
+			writeAPIError(w, validationError("id", "item %d has no row id", i))
+			return
+		}
+
+		if rows[i] = findRow(table, ref.ID); rows[i] == nil {
+			writeAPIError(w, rowNotFound(ref.ID))
+			return
+		}
+
+		if parsed[i], apiErr = f.parseValues(table, item, userFieldNames(r)); apiErr != nil {
+			writeAPIError(w, apiErr)
+			return
+		}
+	}
+
+	out := make([]map[string]interface{}, 0, len(items))
+	for i, row := range rows {
+		f.setValues(table, row, parsed[i])
+		out = append(out, f.renderRow(table, row, userFieldNames(r), nil))
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{"items": out})
+}
+
+func (f *Baserow) handleBatchDelete(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Items []int `json:"items"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeAPIError(w, validationError("items", "invalid JSON: %v", err))
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	table, apiErr := f.tableFromPath(r)
+	if apiErr != nil {
+		writeAPIError(w, apiErr)
+		return
+	}
+
+	for _, id := range body.Items {
+		if findRow(table, id) == nil {
+			writeAPIError(w, rowNotFound(id))
+			return
+		}
+	}
+
+	for _, id := range body.Items {
+		f.deleteRow(table, id)
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (f *Baserow) tableFromPath(r *http.Request) (*fakeTable, *apiError) {
+	id, _ := strconv.Atoi(r.PathValue("table"))
+	table, ok := f.tables[id]
+	if !ok {
+		return nil, &apiError{Status: http.StatusNotFound, Code: "ERROR_TABLE_DOES_NOT_EXIST", Detail: fmt.Sprintf("The table %s does not exist.", r.PathValue("table"))}
+	}
+	return table, nil
+}
+
+func (f *Baserow) tableByName(name string) *fakeTable {
+	for _, table := range f.tables {
+		if table.Name == name {
+			return table
+		}
+	}
+	return nil
+}
+
+func (f *Baserow) addField(table *fakeTable, field *fakeField) {
+	f.nextFieldID++
+	field.ID = f.nextFieldID
+	field.TableID = table.ID
+	f.fields[field.ID] = field
+	table.Fields = append(table.Fields, field)
+}
+
+func (f *Baserow) insertRow(table *fakeTable) *fakeRow {
+	table.NextRowID++
+	row := &fakeRow{ID: table.NextRowID, Values: make(map[int]interface{})}
+	table.Rows = append(table.Rows, row)
+	return row
+}
+
+func (f *Baserow) createRow(table *fakeTable, raw []byte) (*fakeRow, *apiError) {
+	values, apiErr := f.parseValues(table, raw, true)
+	if apiErr != nil {
+		return nil, apiErr
+	}
+
+	row := f.insertRow(table)
+	f.setValues(table, row, values)
+	return row, nil
+}
+
+// setValues writes parsed values to row, updating the reverse side of any
+// related link-row field.
+func (f *Baserow) setValues(table *fakeTable, row *fakeRow, values map[int]interface{}) {
+	for fieldID, value := range values {
+		row.Values[fieldID] = value
+
+		field := f.fields[fieldID]
+		if field.Type != "link_row" || field.RelatedFieldID == 0 {
+			continue
+		}
+
+		linked := make(map[int]bool)
+		for _, id := range value.([]int) {
+			linked[id] = true
+		}
+
+		target := f.tables[field.LinkTableID]
+		for _, other := range target.Rows {
+			ids, _ := other.Values[field.RelatedFieldID].([]int)
+			ids = removeID(ids, row.ID)
+			if linked[other.ID] {
+				ids = append(ids, row.ID)
+				sort.Ints(ids)
+			}
+			other.Values[field.RelatedFieldID] = ids
+		}
+	}
+}
+
+// deleteRow removes the row and any links to it.
+func (f *Baserow) deleteRow(table *fakeTable, id int) {
+	for i, row := range table.Rows {
+		if row.ID == id {
+			table.Rows = append(table.Rows[:i], table.Rows[i+1:]...)
+			break
+		}
+	}
+
+	for _, field := range f.fields {
+		if field.Type != "link_row" || field.LinkTableID != table.ID {
+			continue
+		}
+
+		for _, row := range f.tables[field.TableID].Rows {
+			if ids, ok := row.Values[field.ID].([]int); ok {
+				row.Values[field.ID] = removeID(ids, id)
+			}
+		}
+	}
+}
+
+// parseValues converts a JSON row body into stored values keyed by field ID.
+// Unknown keys are ignored, as Baserow does.
+func (f *Baserow) parseValues(table *fakeTable, raw []byte, userFieldNames bool) (map[int]interface{}, *apiError) {
+	var body map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &body); err != nil {
+		return nil, validationError("body", "invalid JSON: %v", err)
+	}
+
+	values := make(map[int]interface{})
+	for key, value := range body {
+		field := lookupField(table, key, userFieldNames)
+		if field == nil {
+			continue
+		}
+
+		parsed, apiErr := f.parseValue(field, key, value)
+		if apiErr != nil {
+			return nil, apiErr
+		}
+		values[field.ID] = parsed
+	}
+
+	return values, nil
+}
+
+func (f *Baserow) parseValue(field *fakeField, key string, raw json.RawMessage) (interface{}, *apiError) {
+	var value interface{}
+	decoder := json.NewDecoder(strings.NewReader(string(raw)))
+	decoder.UseNumber()
+	if err := decoder.Decode(&value); err != nil {
+		return nil, validationError(key, "invalid JSON: %v", err)
+	}
+
+	switch field.Type {
+	case "number":
+		var s string
+		switch v := value.(type) {
+		case nil:
+			return nil, nil
+		case json.Number:
+			s = v.String()
+		case string:
+			s = strings.TrimSpace(v)
+		default:
+			return nil, validationError(key, "A valid number is required.")
+		}
+
+		if s == "" {
+			return nil, nil
+		}
+
+		n, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return nil, validationError(key, "A valid number is required.")
+		}
+		return strconv.FormatFloat(n, 'f', field.DecimalPlaces, 64), nil
+
+	case "boolean":
+		switch v := value.(type) {
+		case nil:
+			return false, nil
+		case bool:
+			return v, nil
+		default:
+			return nil, validationError(key, "Must be a valid boolean.")
+		}
+
+	case "link_row":
+		return f.parseLinks(field, key, value)
+
+	default:
+		switch v := value.(type) {
+		case nil:
+			return nil, nil
+		case string:
+			return v, nil
+		default:
+			return nil, validationError(key, "Not a valid string.")
+		}
+	}
+}
+
+// parseLinks accepts a list of row IDs, primary field values or {"id": ...}
+// objects. Like Baserow, it rejects a single ID outside a list.
+func (f *Baserow) parseLinks(field *fakeField, key string, value interface{}) ([]int, *apiError) {
+	if value == nil {
+		return []int{}, nil
+	}
+
+	items, ok := value.([]interface{})
+	if !ok {
+		return nil, validationError(key, "Expected a list of items.")
+	}
+
+	target := f.tables[field.LinkTableID]
+
+	ids := []int{}
+	for _, item := range items {
+		if obj, ok := item.(map[string]interface{}); ok {
+			item = obj["id"]
+		}
+
+		var row *fakeRow
+		switch v := item.(type) {
+		case json.Number:
+			id, _ := strconv.Atoi(v.String())
+			row = findRow(target, id)
+		case string:
+			row = f.findRowByPrimary(target, v)
+		}
+
+		if row == nil {
+			return nil, validationError(key, "The provided value %v does not match a row in table %s.", item, target.Name)
+		}
+
+		if !containsID(ids, row.ID) {
+			ids = append(ids, row.ID)
+		}
+	}
+
+	sort.Ints(ids)
+	return ids, nil
+}
+
+func (f *Baserow) findRowByPrimary(table *fakeTable, value string) *fakeRow {
+	for _, row := range table.Rows {
+		if f.primaryText(table, row) == value {
+			return row
+		}
+	}
+	return nil
+}
+
+func (f *Baserow) primaryText(table *fakeTable, row *fakeRow) string {
+	for _, field := range table.Fields {
+		if field.Primary {
+			return f.textValue(field, row.Values[field.ID])
+		}
+	}
+	return ""
+}
+
+// textValue renders a stored value as text for filtering, sorting and the
+// "value" of link-row items.
+func (f *Baserow) textValue(field *fakeField, value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case bool:
+		if v {
+			return "1"
+		}
+		return "0"
+	case []int:
+		target := f.tables[field.LinkTableID]
+		var parts []string
+		for _, id := range v {
+			if row := findRow(target, id); row != nil {
+				parts = append(parts, f.primaryText(target, row))
+			}
+		}
+		return strings.Join(parts, ", ")
+	}
+	return fmt.Sprint(value)
+}
+
+func (f *Baserow) renderRow(table *fakeTable, row *fakeRow, userFieldNames bool, fieldSet map[int]bool) map[string]interface{} {
+	out := map[string]interface{}{
+		"id":    row.ID,
+		"order": fmt.Sprintf("%d.00000000000000000000", row.ID),
+	}
+
+	for _, field := range table.Fields {
+		if fieldSet != nil && !fieldSet[field.ID] {
+			continue
+		}
+
+		key := field.Name
+		if !userFieldNames {
+			key = fmt.Sprintf("field_%d", field.ID)
+		}
+
+		switch field.Type {
+		case "link_row":
+			ids, _ := row.Values[field.ID].([]int)
+			target := f.tables[field.LinkTableID]
+			items := make([]map[string]interface{}, 0, len(ids))
+			for _, id := range ids {
+				if linked := findRow(target, id); linked != nil {
+					items = append(items, map[string]interface{}{"id": id, "value": f.primaryText(target, linked)})
+				}
+			}
+			out[key] = items
+		case "boolean":
+			v, _ := row.Values[field.ID].(bool)
+			out[key] = v
+		default:
+			out[key] = row.Values[field.ID]
+		}
+	}
+
+	return out
+}
+
+// filterRows applies filter__<field>__<type>, filter_type and search.
+func (f *Baserow) filterRows(table *fakeTable, q url.Values, userFieldNames bool) ([]*fakeRow, *apiError) {
+	type condition struct {
+		field      *fakeField
+		filterType string
+		value      string
+	}
+
+	var conditions []condition
+	for key, values := range q {
+		if !strings.HasPrefix(key, "filter__") {
+			continue
+		}
+
+		rest := strings.TrimPrefix(key, "filter__")
+		i := strings.LastIndex(rest, "__")
+		if i < 0 {
+			return nil, &apiError{Status: http.StatusBadRequest, Code: "ERROR_FILTER_FIELD_NOT_FOUND", Detail: fmt.Sprintf("malformed filter %s", key)}
+		}
+
+		field := lookupField(table, rest[:i], userFieldNames)
+		if field == nil {
+			return nil, &apiError{Status: http.StatusBadRequest, Code: "ERROR_FILTER_FIELD_NOT_FOUND", Detail: fmt.Sprintf("The field %s was not found.", rest[:i])}
+		}
+
+		for _, value := range values {
+			conditions = append(conditions, condition{field: field, filterType: rest[i+2:], value: value})
+		}
+	}
+
+	or := strings.EqualFold(q.Get("filter_type"), "OR")
+	search := strings.ToLower(q.Get("search"))
+
+	var out []*fakeRow
+	for _, row := range table.Rows {
+		matched := !or || len(conditions) == 0
+		for _, c := range conditions {
+			ok, apiErr := f.matches(c.field, row, c.filterType, c.value)
+			if apiErr != nil {
+				return nil, apiErr
+			}
+
+			if or && ok {
+				matched = true
+				break
+			}
+			if !or && !ok {
+				matched = false
+				break
+			}
+		}
+
+		if matched && search != "" {
+			matched = false
+			for _, field := range table.Fields {
+				if strings.Contains(strings.ToLower(f.textValue(field, row.Values[field.ID])), search) {
+					matched = true
+					break
+				}
+			}
+		}
+
+		if matched {
+			out = append(out, row)
+		}
+	}
+
+	return out, nil
+}
+
+func (f *Baserow) matches(field *fakeField, row *fakeRow, filterType, value string) (bool, *apiError) {
+	text := f.textValue(field, row.Values[field.ID])
+
+	switch filterType {
+	case "equal":
+		if field.Type == "number" && text != "" && value != "" {
+			a, _ := strconv.ParseFloat(text, 64)
+			b, err := strconv.ParseFloat(value, 64)
+			return err == nil && a == b, nil
+		}
+		return text == value, nil
+	case "not_equal":
+		ok, apiErr := f.matches(field, row, "equal", value)
+		return !ok, apiErr
+	case "contains":
+		return strings.Contains(strings.ToLower(text), strings.ToLower(value)), nil
+	case "contains_not":
+		return !strings.Contains(strings.ToLower(text), strings.ToLower(value)), nil
+	case "empty":
+		return isEmpty(row.Values[field.ID]), nil
+	case "not_empty":
+		return !isEmpty(row.Values[field.ID]), nil
+	case "boolean":
+		v, _ := row.Values[field.ID].(bool)
+		want := value == "1" || strings.EqualFold(value, "true")
+		return v == want, nil
+	case "higher_than", "lower_than":
+		a, errA := strconv.ParseFloat(text, 64)
+		b, errB := strconv.ParseFloat(value, 64)
+		if errA != nil || errB != nil {
+			return false, nil
+		}
+		if filterType == "higher_than" {
+			return a > b, nil
+		}
+		return a < b, nil
+	case "link_row_has":
+		id, _ := strconv.Atoi(value)
+		ids, _ := row.Values[field.ID].([]int)
+		return containsID(ids, id), nil
+	}
+
+	return false, &apiError{Status: http.StatusBadRequest, Code: "ERROR_VIEW_FILTER_TYPE_DOES_NOT_EXIST", Detail: fmt.Sprintf("The view filter type %s doesn't exist.", filterType)}
+}
+
+func (f *Baserow) sortRows(table *fakeTable, rows []*fakeRow, orderBy string, userFieldNames bool) *apiError {
+	if orderBy == "" {
+		return nil
+	}
+
+	type key struct {
+		field *fakeField
+		desc  bool
+	}
+
+	var keys []key
+	for _, name := range strings.Split(orderBy, ",") {
+		desc := strings.HasPrefix(name, "-")
+		name = strings.TrimLeft(name, "+-")
+
+		field := lookupField(table, name, userFieldNames)
+		if field == nil {
+			return &apiError{Status: http.StatusBadRequest, Code: "ERROR_ORDER_BY_FIELD_NOT_FOUND", Detail: fmt.Sprintf("The field %s was not found.", name)}
+		}
+		keys = append(keys, key{field: field, desc: desc})
+	}
+
+	sort.SliceStable(rows, func(i, j int) bool {
+		for _, k := range keys {
+			a := f.textValue(k.field, rows[i].Values[k.field.ID])
+			b := f.textValue(k.field, rows[j].Values[k.field.ID])
+			if a == b {
+				continue
+			}
+
+			var less bool
+			if k.field.Type == "number" {
+				x, _ := strconv.ParseFloat(a, 64)
+				y, _ := strconv.ParseFloat(b, 64)
+				less = x < y
+			} else {
+				less = a < b
+			}
+
+			if k.desc {
+				return !less
+			}
+			return less
+		}
+		return rows[i].ID < rows[j].ID
+	})
+
+	return nil
+}
+
+func (f *Baserow) pageURL(r *http.Request, page int) string {
+	q := r.URL.Query()
+	q.Set("page", strconv.Itoa(page))
+	return fmt.Sprintf("%s%s?%s", f.Server.URL, r.URL.Path, q.Encode())
+}
+
+// includedFields returns the fields selected by include/exclude, or nil for
+// all fields.
+func includedFields(table *fakeTable, q url.Values, userFieldNames bool) (map[int]bool, *apiError) {
+	include, exclude := q.Get("include"), q.Get("exclude")
+	if include == "" && exclude == "" {
+		return nil, nil
+	}
+
+	set := make(map[int]bool)
+	if include == "" {
+		for _, field := range table.Fields {
+			set[field.ID] = true
+		}
+	}
+
+	for _, name := range splitNames(include) {
+		if field := lookupField(table, name, userFieldNames); field != nil {
+			set[field.ID] = true
+		}
+	}
+
+	for _, name := range splitNames(exclude) {
+		if field := lookupField(table, name, userFieldNames); field != nil {
+			delete(set, field.ID)
+		}
+	}
+
+	return set, nil
+}
+
+func splitNames(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, ",")
+}
+
+func lookupField(table *fakeTable, key string, userFieldNames bool) *fakeField {
+	if !userFieldNames {
+		id, err := strconv.Atoi(strings.TrimPrefix(key, "field_"))
+		if err != nil {
+			return nil
+		}
+		for _, field := range table.Fields {
+			if field.ID == id {
+				return field
+			}
+		}
+		return nil
+	}
+
+	return fieldByName(table, key)
+}
+
+func fieldByName(table *fakeTable, name string) *fakeField {
+	for _, field := range table.Fields {
+		if field.Name == name {
+			return field
+		}
+	}
+	return nil
+}
+
+func findRow(table *fakeTable, id int) *fakeRow {
+	for _, row := range table.Rows {
+		if row.ID == id {
+			return row
+		}
+	}
+	return nil
+}
+
+func renderField(field *fakeField) map[string]interface{} {
+	out := map[string]interface{}{
+		"id":       field.ID,
+		"table_id": field.TableID,
+		"name":     field.Name,
+		"type":     field.Type,
+		"primary":  field.Primary,
+	}
+
+	switch field.Type {
+	case "number":
+		out["number_decimal_places"] = field.DecimalPlaces
+	case "link_row":
+		out["link_row_table_id"] = field.LinkTableID
+		if field.RelatedFieldID != 0 {
+			out["link_row_related_field_id"] = field.RelatedFieldID
+		}
+	}
+
+	return out
+}
+
+func isEmpty(value interface{}) bool {
+	switch v := value.(type) {
+	case nil:
+		return true
+	case string:
+		return v == ""
+	case []int:
+		return len(v) == 0
+	case bool:
+		return !v
+	}
+	return false
+}
+
+func containsID(ids []int, id int) bool {
+	for _, v := range ids {
+		if v == id {
+			return true
+		}
+	}
+	return false
+}
+
+func removeID(ids []int, id int) []int {
+	out := ids[:0:0]
+	for _, v := range ids {
+		if v != id {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+func userFieldNames(r *http.Request) bool {
+	return r.URL.Query().Get("user_field_names") == "true"
+}
+
+func readBody(r *http.Request) ([]byte, *apiError) {
+	var raw json.RawMessage
+	if err := json.NewDecoder(r.Body).Decode(&raw); err != nil {
+		return nil, validationError("body", "invalid JSON: %v", err)
+	}
+	return raw, nil
+}
+
+func readBatchItems(r *http.Request) ([]json.RawMessage, *apiError) {
+	var body struct {
+		Items []json.RawMessage `json:"items"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		return nil, validationError("items", "invalid JSON: %v", err)
+	}
+
+	if len(body.Items) == 0 || len(body.Items) > models.BaserowMaxBatchSize {
+		return nil, validationError("items", "Ensure this field has between 1 and %d elements.", models.BaserowMaxBatchSize)
+	}
+
+	return body.Items, nil
+}
+
+func writeAPIError(w http.ResponseWriter, apiErr *apiError) {
+	writeJSON(w, apiErr.Status, apiErr)
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
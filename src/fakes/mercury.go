@@ -0,0 +1,306 @@
+package fakes
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jiaming2012/receipt-bot/src/models"
+	"github.com/jiaming2012/receipt-bot/src/services"
+)
+
+const (
+	FakeMercuryToken = "fake-mercury-token"
+
+	// FakeMercuryAccountID is the account the fake starts with, unless the
+	// fixture directory has an accounts.json.
+	FakeMercuryAccountID = "fake-checking"
+)
+
+// Mercury is an httptest server replaying Mercury transactions and their
+// attachments from a fixture directory, in the layout written by
+// services.MercuryClient.RecordTransactions:
+//
+//	<dir>/accounts.json MercuryListAccountsResponse
+//	<dir>/*.json        MercuryListAllTransactionsResponse pages
+//	<dir>/attachments/  attachment files
+//
+// Transactions without an accountId belong to the first account. Attachment
+// URLs that are not absolute are resolved against the fixture directory and
+// served by the fake.
+type Mercury struct {
+	Server *httptest.Server
+
+	// OffsetOnly stops the fake from returning nextPage cursors, so clients
+	// have to page by offset.
+	OffsetOnly bool
+
+	t   testing.TB
+	dir string
+	mu  sync.Mutex
+
+	accounts     []*models.MercuryAccount
+	transactions []*models.MercuryTransaction
+	requests     []string
+}
+
+// NewMercury starts a fake Mercury serving the fixtures in dir. An empty dir
+// starts it without transactions. The server is closed when the test ends.
+func NewMercury(t testing.TB, dir string) *Mercury {
+	t.Helper()
+
+	m := &Mercury{t: t, dir: dir}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /accounts", m.requireToken(m.handleAccounts))
+	mux.HandleFunc("GET /account/{id}/transactions", m.requireToken(m.handleTransactions))
+	mux.HandleFunc("GET /account/{id}/transaction/{txid}", m.requireToken(m.handleTransaction))
+	mux.HandleFunc("GET /attachments/{name}", m.handleAttachment)
+
+	m.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		m.mu.Lock()
+		m.requests = append(m.requests, r.Method+" "+r.URL.Path)
+		m.mu.Unlock()
+
+		mux.ServeHTTP(w, r)
+	}))
+	t.Cleanup(m.Server.Close)
+
+	if dir != "" {
+		m.loadFixtures()
+	}
+
+	if len(m.accounts) == 0 {
+		m.AddAccount(&models.MercuryAccount{ID: FakeMercuryAccountID, Name: "Checking", Kind: "checking", Status: "active"})
+	}
+
+	return m
+}
+
+// Client returns a client for the fake.
+func (m *Mercury) Client() *services.MercuryClient {
+	return services.NewMercuryClient(FakeMercuryToken, services.WithMercuryBaseURL(m.Server.URL))
+}
+
+// AddAccount adds an account to those served by the fake.
+func (m *Mercury) AddAccount(account *models.MercuryAccount) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.accounts = append(m.accounts, account)
+}
+
+// AddTransactions adds transactions to those served by the fake.
+func (m *Mercury) AddTransactions(txs ...*models.MercuryTransaction) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, tx := range txs {
+		m.resolveAttachmentURLs(tx)
+		m.transactions = append(m.transactions, tx)
+	}
+}
+
+// Requests returns "METHOD /path" for every request received so far.
+func (m *Mercury) Requests() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return append([]string(nil), m.requests...)
+}
+
+func (m *Mercury) loadFixtures() {
+	m.t.Helper()
+
+	paths, err := filepath.Glob(filepath.Join(m.dir, "*.json"))
+	if err != nil {
+		m.t.Fatalf("fakes.NewMercury: %v", err)
+	}
+	sort.Strings(paths)
+
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			m.t.Fatalf("fakes.NewMercury: %v", err)
+		}
+
+		if filepath.Base(path) == "accounts.json" {
+			var accounts models.MercuryListAccountsResponse
+			if err := json.Unmarshal(data, &accounts); err != nil {
+				m.t.Fatalf("fakes.NewMercury: failed to parse %s: %v", path, err)
+			}
+
+			m.accounts = append(m.accounts, accounts.Accounts...)
+			continue
+		}
+
+		var page models.MercuryListAllTransactionsResponse
+		if err := json.Unmarshal(data, &page); err != nil {
+			m.t.Fatalf("fakes.NewMercury: failed to parse %s: %v", path, err)
+		}
+
+		m.AddTransactions(page.Transactions...)
+	}
+}
+
+func (m *Mercury) resolveAttachmentURLs(tx *models.MercuryTransaction) {
+	for _, attachment := range tx.Attachments {
+		if strings.HasPrefix(attachment.URL, "attachments/") {
+			attachment.URL = m.Server.URL + "/" + attachment.URL
+		}
+	}
+}
+
+func (m *Mercury) requireToken(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer "+FakeMercuryToken {
+			writeJSON(w, http.StatusUnauthorized, map[string]string{"errors": "invalid API token"})
+			return
+		}
+		next(w, r)
+	}
+}
+
+func (m *Mercury) handleAccounts(w http.ResponseWriter, r *http.Request) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	writeJSON(w, http.StatusOK, models.MercuryListAccountsResponse{Accounts: m.accounts})
+}
+
+// handleTransactions returns the account's transactions created between the
+// start and end dates, inclusive, newest first, paged by limit and either offset or the
+// start_after cursor returned as nextPage.
+func (m *Mercury) handleTransactions(w http.ResponseWriter, r *http.Request) {
+	start, end, err := dateRange(r)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"errors": err.Error()})
+		return
+	}
+
+	q := r.URL.Query()
+
+	limit := services.MercuryMaxPageSize
+	if l := q.Get("limit"); l != "" {
+		limit, err = strconv.Atoi(l)
+		if err != nil || limit < 1 || limit > services.MercuryMaxPageSize {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"errors": fmt.Sprintf("limit must be between 1 and %d", services.MercuryMaxPageSize)})
+			return
+		}
+	}
+
+	offset, _ := strconv.Atoi(q.Get("offset"))
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	accountID := r.PathValue("id")
+	if !slices.ContainsFunc(m.accounts, func(a *models.MercuryAccount) bool { return a.ID == accountID }) {
+		writeJSON(w, http.StatusNotFound, map[string]string{"errors": fmt.Sprintf("account %s not found", accountID)})
+		return
+	}
+
+	var txs []*models.MercuryTransaction
+	for _, tx := range m.transactions {
+		if m.ownerLocked(tx) != accountID {
+			continue
+		}
+
+		createdAt, err := time.Parse(time.RFC3339, tx.CreatedAt)
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"errors": fmt.Sprintf("transaction %s: %v", tx.ID, err)})
+			return
+		}
+
+		day := createdAt.Format(time.DateOnly)
+		if (start == "" || day >= start) && (end == "" || day <= end) {
+			txs = append(txs, tx)
+		}
+	}
+
+	sort.SliceStable(txs, func(i, j int) bool {
+		return txs[i].CreatedAt > txs[j].CreatedAt
+	})
+
+	if cursor := q.Get("start_after"); cursor != "" {
+		found := false
+		for i, tx := range txs {
+			if tx.ID == cursor {
+				offset, found = i+1, true
+				break
+			}
+		}
+
+		if !found {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"errors": fmt.Sprintf("unknown cursor %q", cursor)})
+			return
+		}
+	}
+
+	offset = min(offset, len(txs))
+	last := min(offset+limit, len(txs))
+
+	resp := models.MercuryListAllTransactionsResponse{Total: len(txs), Transactions: txs[offset:last]}
+	if last < len(txs) && !m.OffsetOnly {
+		resp.Page.NextPage = txs[last-1].ID
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (m *Mercury) handleTransaction(w http.ResponseWriter, r *http.Request) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	accountID, txID := r.PathValue("id"), r.PathValue("txid")
+	for _, tx := range m.transactions {
+		if tx.ID == txID && m.ownerLocked(tx) == accountID {
+			writeJSON(w, http.StatusOK, tx)
+			return
+		}
+	}
+
+	writeJSON(w, http.StatusNotFound, map[string]string{"errors": fmt.Sprintf("transaction %s not found", txID)})
+}
+
+// ownerLocked returns the account tx belongs to. m.mu must be held.
+func (m *Mercury) ownerLocked(tx *models.MercuryTransaction) string {
+	if tx.AccountID == "" && len(m.accounts) > 0 {
+		return m.accounts[0].ID
+	}
+	return tx.AccountID
+}
+
+func (m *Mercury) handleAttachment(w http.ResponseWriter, r *http.Request) {
+	name := filepath.Base(r.PathValue("name"))
+	if m.dir == "" {
+		http.NotFound(w, r)
+		return
+	}
+
+	http.ServeFile(w, r, filepath.Join(m.dir, "attachments", name))
+}
+
+func dateRange(r *http.Request) (string, string, error) {
+	start, end := r.URL.Query().Get("start"), r.URL.Query().Get("end")
+	for _, d := range []string{start, end} {
+		if d == "" {
+			continue
+		}
+		if _, err := time.Parse(time.DateOnly, d); err != nil {
+			return "", "", fmt.Errorf("invalid date %q, expected YYYY-MM-DD", d)
+		}
+	}
+
+	return start, end, nil
+}
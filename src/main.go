@@ -2,17 +2,27 @@ package main
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
+	"io"
 	"os"
+	"slices"
 	"strings"
+	"text/tabwriter"
 	"time"
 
 	log "github.com/sirupsen/logrus"
-	"google.golang.org/genai"
 	"gopkg.in/yaml.v2"
 
+	"github.com/jiaming2012/receipt-bot/src/config"
+	"github.com/jiaming2012/receipt-bot/src/eval"
 	"github.com/jiaming2012/receipt-bot/src/models"
+	"github.com/jiaming2012/receipt-bot/src/parsecache"
+	"github.com/jiaming2012/receipt-bot/src/schema"
 	"github.com/jiaming2012/receipt-bot/src/services"
+	"github.com/jiaming2012/receipt-bot/src/syncstate"
 )
 
 type PurchaseItemYAML struct {
@@ -57,35 +67,32 @@ func run_apply_purchase_item_groups_fixtures(ctx context.Context, client *models
 
 	// Fetch existing tags from Baserow
 	existingTagsMap := make(map[string]*models.BaserowTagTable)
-	tagRows, err := models.ListRows[*models.BaserowTagTable](client)
+	tagRows, err := models.ListRows[*models.BaserowTagTable](ctx, client)
 	for _, tagRow := range tagRows {
 		existingTagsMap[tagRow.TagName] = tagRow
 	}
 
 	// Identify and add new tags
-	newTagsToAdd := []models.BaserowTagTable{}
+	newTagsToAdd := []models.BaserowData{}
 	for _, group := range groups {
 		for _, tag := range group.Tags {
 			if _, exists := existingTagsMap[tag]; !exists {
-				newTagsToAdd = append(newTagsToAdd, models.BaserowTagTable{
-					TagName: tag,
-				})
-				existingTagsMap[tag] = &models.BaserowTagTable{
+				newTag := &models.BaserowTagTable{
 					TagName: tag,
 				}
+				newTagsToAdd = append(newTagsToAdd, newTag)
+				existingTagsMap[tag] = newTag
 			}
 		}
 	}
 
-	for _, tag := range newTagsToAdd {
-		if err := client.CreateRow(&tag); err != nil {
-			return fmt.Errorf("Failed to create tag row: %w", err)
-		}
+	if err := client.CreateRows(ctx, newTagsToAdd); err != nil {
+		return fmt.Errorf("Failed to create tag rows: %w", err)
 	}
 
 	// Fetch existing purchase items from Baserow
 	existingPurchaseItemsMap := make(map[string]*models.BaserowPurchaseItemTable)
-	purchaseItemRows, err := models.ListRows[*models.BaserowPurchaseItemTable](client)
+	purchaseItemRows, err := models.ListRows[*models.BaserowPurchaseItemTable](ctx, client)
 	if err != nil {
 		return fmt.Errorf("Failed to list purchase item rows: %w", err)
 	}
@@ -95,7 +102,7 @@ func run_apply_purchase_item_groups_fixtures(ctx context.Context, client *models
 	}
 
 	// Identify and add new purchase items
-	newPurchaseItemsToAdd := []models.BaserowPurchaseItemTable{}
+	newPurchaseItemsToAdd := []models.BaserowData{}
 	for _, group := range groups {
 		for _, item := range group.PurchaseItems {
 			// Remove % signs from description for matching
@@ -105,25 +112,22 @@ func run_apply_purchase_item_groups_fixtures(ctx context.Context, client *models
 			}
 
 			if _, exists := existingPurchaseItemsMap[description]; !exists {
-				newPurchaseItemsToAdd = append(newPurchaseItemsToAdd, models.BaserowPurchaseItemTable{
-					Description: description,
-				})
-				existingPurchaseItemsMap[description] = &models.BaserowPurchaseItemTable{
+				newPurchaseItem := &models.BaserowPurchaseItemTable{
 					Description: description,
 				}
+				newPurchaseItemsToAdd = append(newPurchaseItemsToAdd, newPurchaseItem)
+				existingPurchaseItemsMap[description] = newPurchaseItem
 			}
 		}
 	}
 
-	for _, item := range newPurchaseItemsToAdd {
-		if err := client.CreateRow(&item); err != nil {
-			return fmt.Errorf("Failed to create purchase item row: %w", err)
-		}
+	if err := client.CreateRows(ctx, newPurchaseItemsToAdd); err != nil {
+		return fmt.Errorf("Failed to create purchase item rows: %w", err)
 	}
 
 	// Fetch existing purchase item groups from Baserow
 	existingPurchaseItemGroupsMap := make(map[string]interface{})
-	purchaseItemGroupRows, err := models.ListRows[*models.BaserowPurchaseItemGroupTable](client)
+	purchaseItemGroupRows, err := models.ListRows[*models.BaserowPurchaseItemGroupTable](ctx, client)
 	if err != nil {
 		return fmt.Errorf("Failed to list purchase item group rows: %w", err)
 	}
@@ -180,10 +184,13 @@ func run_apply_purchase_item_groups_fixtures(ctx context.Context, client *models
 		}
 	}
 
-	for _, group := range newPurchaseItemGroupsToAdd {
-		if err := client.CreateRow(&group); err != nil {
-			return fmt.Errorf("Failed to create purchase item group row: %w", err)
-		}
+	var newPurchaseItemGroupRows []models.BaserowData
+	for i := range newPurchaseItemGroupsToAdd {
+		newPurchaseItemGroupRows = append(newPurchaseItemGroupRows, &newPurchaseItemGroupsToAdd[i])
+	}
+
+	if err := client.CreateRows(ctx, newPurchaseItemGroupRows); err != nil {
+		return fmt.Errorf("Failed to create purchase item group rows: %w", err)
 	}
 
 	return nil
@@ -208,14 +215,19 @@ func DeriveProcessedPendingPurchase(pendingPurchases []*models.BaserowPendingPur
 }
 
 func remove_processed_pending_purchases(ctx context.Context, baserowClient *models.BaserowClient) error {
-	pendingPurchasesToDelete, err := models.ListRows[*models.BaserowPendingPurchase](baserowClient)
+	// only pending purchases already linked to a purchase or purchase event can be removed
+	pendingPurchasesToDelete, err := models.ListRows[*models.BaserowPendingPurchase](ctx, baserowClient,
+		models.WithFilterType("OR"),
+		models.WithFilter("Purchase", "not_empty", ""),
+		models.WithFilter("PurchaseEvent", "not_empty", ""),
+	)
 	if err != nil {
 		return fmt.Errorf("Failed to list pending purchases for deletion: %w", err)
 	}
 
-	currentPurchaseEvents, err := models.ListRows[*models.BaserowPurchaseEventTable](baserowClient)
+	currentPurchaseEvents, err := models.ListRows[*models.BaserowPurchaseEventTable](ctx, baserowClient)
 	if err != nil {
-		log.Fatal(fmt.Errorf("Failed to list purchase events: %w", err))
+		return fmt.Errorf("Failed to list purchase events: %w", err)
 	}
 
 	currentPurchaseEventsMap := make(map[string]*models.BaserowPurchaseEventTable)
@@ -223,7 +235,9 @@ func remove_processed_pending_purchases(ctx context.Context, baserowClient *mode
 		currentPurchaseEventsMap[pe.BankTxID] = pe
 	}
 
-	currentPurchases, err := models.ListRows[*models.BaserowPurchaseTable](baserowClient)
+	currentPurchases, err := models.ListRows[*models.BaserowPurchaseTable](ctx, baserowClient,
+		models.WithFilter("PendingPurchases", "not_empty", ""),
+	)
 	if err != nil {
 		return fmt.Errorf("Failed to list current purchases for deletion: %w", err)
 	}
@@ -233,76 +247,72 @@ func remove_processed_pending_purchases(ctx context.Context, baserowClient *mode
 		return fmt.Errorf("Failed to derive processed pending purchases for deletion: %w", err)
 	}
 
-	for i := len(processedPendingPurchases) - 1; i >= 0; i-- {
-		pp := processedPendingPurchases[i]
-		if err := baserowClient.DeleteRow(pp); err != nil {
-			return fmt.Errorf("Failed to delete processed pending purchase ID %d: %w", pp.ID, err)
-		}
+	var rowsToDelete []models.BaserowData
+	for _, pp := range processedPendingPurchases {
+		rowsToDelete = append(rowsToDelete, pp)
 	}
 
-	return nil
-}
-
-func main() {
-	ctx := context.Background()
-
-	AiApiKey := os.Getenv("AI_API_KEY")
-	if AiApiKey == "" {
-		log.Fatal("AI_API_KEY environment variable is not set")
-	}
-
-	bankApiKey := os.Getenv("BANK_API_KEY")
-	if bankApiKey == "" {
-		log.Fatal("BANK_API_KEY environment variable is not set")
-	}
+	if err := baserowClient.DeleteRows(ctx, rowsToDelete); err != nil {
+		var batchErr *models.BatchError
+		if !errors.As(err, &batchErr) {
+			return fmt.Errorf("Failed to delete processed pending purchases: %w", err)
+		}
 
-	aiClient, err := genai.NewClient(ctx, &genai.ClientConfig{
-		APIKey: AiApiKey,
-	})
+		for _, f := range batchErr.Failures {
+			// already removed, e.g. by a concurrent run or by hand
+			if errors.Is(f.Err, models.ErrNotFound) {
+				log.Warnf("Processed pending purchase ID %s was already deleted", f.Row.GetRowID())
+				continue
+			}
 
-	if err != nil {
-		log.Fatal(fmt.Errorf("Failed to initiate AI Client"))
+			return fmt.Errorf("Failed to delete processed pending purchase ID %s: %w", f.Row.GetRowID(), f.Err)
+		}
 	}
 
-	// if err := demo(ctx, client); err != nil {
-	// 	log.Fatal(err)
-	// }
-
-	end := time.Now()
-	start := end.AddDate(0, 0, -14) // 1 week ago
+	return nil
+}
 
-	// if err := run_parse_receipt_with_genai(ctx, client); err != nil {
-	// 	log.Fatal(fmt.Errorf("Failed to parse receipt: %w", err))
-	// }
+type IngestResult struct {
+	PurchaseEventsCreated   int                          `json:"purchase_events_created"`
+	PurchasesCreated        int                          `json:"purchases_created"`
+	PendingPurchasesCreated int                          `json:"pending_purchases_created"`
+	InvalidTransactions     []*models.MercuryTransaction `json:"invalid_transactions"`
 
-	baserowApiKey := os.Getenv("BASEROW_API_KEY")
-	if baserowApiKey == "" {
-		log.Fatal("BASEROW_API_KEY environment variable is not set")
-	}
+	// ValidTransactions are the fetched transactions with a receipt, used to
+	// advance the sync state.
+	ValidTransactions []*models.MercuryTransaction `json:"-"`
+}
 
-	baserowClient := models.NewBaserowClient("https://api.baserow.io", baserowApiKey)
+func run_ingest_receipts(ctx context.Context, reader *services.ReceiptReader, aiUsage *aiUsageTracker, baserowClient *models.BaserowClient, bankClient *services.MercuryClient, start, end time.Time) (*IngestResult, error) {
+	result := &IngestResult{}
 
 	// fetch existing purchase events
-	purchaseEvents, err := models.ListRows[*models.BaserowPurchaseEventTable](baserowClient)
+	purchaseEvents, err := models.ListRows[*models.BaserowPurchaseEventTable](ctx, baserowClient,
+		models.WithInclude("Bank Tx ID", "PendingPurchase"),
+	)
 	if err != nil {
-		log.Fatal(fmt.Errorf("Failed to list purchase events: %w", err))
+		return nil, fmt.Errorf("Failed to list purchase events: %w", err)
 	}
 
-	existingPurchaseEventsMap := make(map[string]interface{})
+	existingPurchaseEventsMap := make(map[string]*models.BaserowPurchaseEventTable)
 	parsedReceiptsMap := make(map[string]interface{})
 	pendingPurchaseIDToPurchaseEventMap := make(map[int]*models.BaserowPurchaseEventTable)
 	for _, pe := range purchaseEvents {
 		existingPurchaseEventsMap[pe.BankTxID] = pe
 		parsedReceiptsMap[pe.BankTxID] = true
 		if pe.PendingPurchaseID != nil {
-			pendingPurchaseIDToPurchaseEventMap[*pe.PendingPurchaseID] = pe
+			pendingPurchaseIDToPurchaseEventMap[int(*pe.PendingPurchaseID)] = pe
 		}
 	}
 
 	// fetch existing purchases
-	purchases, err := models.ListRows[*models.BaserowPurchaseTable](baserowClient)
+	// only purchases created from a pending purchase are needed here
+	purchases, err := models.ListRows[*models.BaserowPurchaseTable](ctx, baserowClient,
+		models.WithFilter("PendingPurchases", "not_empty", ""),
+		models.WithInclude("PendingPurchases"),
+	)
 	if err != nil {
-		log.Fatal(fmt.Errorf("Failed to list purchases: %w", err))
+		return nil, fmt.Errorf("Failed to list purchases: %w", err)
 	}
 
 	pendingPurchaseIDToPurchaseMap := make(map[int]*models.BaserowPurchaseTable)
@@ -313,9 +323,9 @@ func main() {
 	}
 
 	// add pending purchase events to parsed receipts
-	pendingPurchases, err := models.ListRows[*models.BaserowPendingPurchase](baserowClient)
+	pendingPurchases, err := models.ListRows[*models.BaserowPendingPurchase](ctx, baserowClient)
 	if err != nil {
-		log.Fatal(fmt.Errorf("Failed to list pending purchases: %w", err))
+		return nil, fmt.Errorf("Failed to list pending purchases: %w", err)
 	}
 
 	// remove processed pending purchases from pendingPurchases
@@ -330,12 +340,23 @@ func main() {
 
 	groupedPendingPurchases, err := services.GroupPendingPurchasesByBankTxID(pendingPurchases)
 	if err != nil {
-		log.Fatalf("Failed to group pending purchases by bank tx ID: %v", err)
+		return nil, fmt.Errorf("Failed to group pending purchases by bank tx ID: %w", err)
+	}
+
+	// receipts paused by the AI budget or a failed download are read again
+	// once there is budget to spare; their paused rows are deleted after the
+	// new rows are written
+	pausedTxs, pausedRows := paused_receipts(ctx, aiUsage, bankClient, groupedPendingPurchases)
+	for _, tx := range pausedTxs {
+		delete(groupedPendingPurchases, tx.ID)
 	}
 
 	for bankTxID := range groupedPendingPurchases {
 		parsedReceiptsMap[bankTxID] = true
 	}
+	for _, tx := range pausedTxs {
+		parsedReceiptsMap[tx.ID] = true
+	}
 
 	var newPurchaseRequests []models.CreateBaserowPurchaseRequest
 
@@ -343,15 +364,17 @@ func main() {
 	for _, pp := range groupedPendingPurchases {
 		purchaseReq, err := models.NewCreateBaserowPurchaseRequestFromPendingPurchases(pp)
 		if err != nil {
-			log.Fatalf("Invalid pending purchase for bank tx ID %s: %v", pp[0].BankTxID, err)
+			// e.g. an unsupported receipt whose items haven't been entered yet
+			log.Warnf("Skipping incomplete pending purchase for bank tx ID %s: %v", pp[0].BankTxID, err)
+			continue
 		}
 
 		if err := services.ValidateReceiptData(purchaseReq.ReceiptItems, purchaseReq.ReceiptSummary, purchaseReq.BankTransaction); err != nil {
 			for _, item := range pp {
 				if len(item.Reason) > 0 {
 					if !strings.Contains(item.Reason, err.Error()) {
-						if err := baserowClient.UpdateRow(item, fmt.Sprintf(`{"Reason": "%s"}`, err.Error())); err != nil {
-							log.Fatalf("Failed to update pending purchase reason: %v", err)
+						if err := baserowClient.UpdateRow(ctx, item, models.BaserowFields{"Reason": err.Error()}); err != nil {
+							return nil, fmt.Errorf("Failed to update pending purchase reason: %w", err)
 						}
 					}
 				}
@@ -364,55 +387,245 @@ func main() {
 	}
 
 	// fetch new receipts from bank
-	validTx, invalidTx, err := services.FetchReceipts(context.Background(), bankApiKey, start, end)
+	validTx, invalidTx, fetchErr := bankClient.FetchReceipts(ctx, start, end)
+	result.InvalidTransactions = invalidTx
+	result.ValidTransactions = validTx
+
+	var newPendingPurchases []models.BaserowData
+	var replacedPausedRows []models.BaserowData
+	for _, mercuryTx := range pausedTxs {
+		req, pendingPurchases, err := parse_transaction(ctx, reader, aiUsage, mercuryTx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, err
+			}
+
+			// the paused row is kept, so it is read again next run
+			log.Errorf("Failed to read paused receipt for tx ID %s: %v", mercuryTx.ID, err)
+			continue
+		}
+
+		// still out of budget, or the attachments still can't be fetched:
+		// keep the paused row rather than replacing it
+		if len(pendingPurchases) == 1 {
+			if pp := pendingPurchases[0].(*models.BaserowPendingPurchase); isAIBudgetPaused(pp) {
+				break
+			} else if isAttachmentRetry(pp) {
+				continue
+			}
+		}
+
+		if req != nil {
+			newPurchaseRequests = append(newPurchaseRequests, *req)
+		}
+		newPendingPurchases = append(newPendingPurchases, pendingPurchases...)
+		replacedPausedRows = append(replacedPausedRows, pausedRows[mercuryTx.ID]...)
+	}
+
 	if len(validTx) > 0 {
 		missingPurchaseEvents := getMissingItems(parsedReceiptsMap, validTx, func(tx *models.MercuryTransaction) string {
 			return tx.ID
 		})
 
 		for _, mercuryTx := range missingPurchaseEvents {
-			if len(mercuryTx.Attachments) > 1 {
-				log.Fatalf("Expected 0 or 1 attachment for tx ID %s, got %d", mercuryTx.ID, len(mercuryTx.Attachments))
-			} else if len(mercuryTx.Attachments) == 1 {
-				attachment := mercuryTx.Attachments[0]
-
-				items, summary, err := services.ParseReceipt(ctx, aiClient, attachment.URL)
-				if err != nil {
-					log.Fatalf("Failed to parse receipt: %v, from %+v", err, mercuryTx)
+			req, pendingPurchases, err := parse_transaction(ctx, reader, aiUsage, mercuryTx)
+			if err != nil {
+				if ctx.Err() != nil {
+					return nil, err
 				}
 
-				if err := services.ValidateReceiptData(items, summary, mercuryTx); err != nil {
-					log.Errorf("Invalid receipt data: %v, from %+v", err, mercuryTx)
+				// nothing is written for the transaction, so it is read
+				// again next run
+				log.Errorf("Failed to read receipt for tx ID %s: %v", mercuryTx.ID, err)
+				continue
+			}
+
+			if req != nil {
+				newPurchaseRequests = append(newPurchaseRequests, *req)
+			}
+			newPendingPurchases = append(newPendingPurchases, pendingPurchases...)
+		}
+	}
 
-					log.Info("Storing invalid transaction for review in PendingPurchases table")
-					pendingPurchases, err := models.NewBaserowPendingPurchases(summary, items, mercuryTx, err)
-					if err != nil {
-						log.Fatalf("Failed to create Baserow pending purchases: %v", err)
-					}
+	if err := baserowClient.CreateRows(ctx, newPendingPurchases); err != nil {
+		return result, fmt.Errorf("Failed to create pending purchase rows: %w", err)
+	}
+	result.PendingPurchasesCreated = len(newPendingPurchases)
 
-					for _, pp := range pendingPurchases {
-						if err := baserowClient.CreateRow(pp); err != nil {
-							log.Fatalf("Failed to create pending purchase row: %v", err)
-						}
-					}
+	if err := write_purchase_requests(ctx, baserowClient, newPurchaseRequests, existingPurchaseEventsMap, result); err != nil {
+		return result, err
+	}
 
-					continue
-				}
+	if err := baserowClient.DeleteRows(ctx, replacedPausedRows); err != nil {
+		return result, fmt.Errorf("Failed to delete pending purchases paused by the AI budget: %w", err)
+	}
 
-				req, err := models.NewCreateBaserowPurchaseRequest(summary, items, mercuryTx, nil)
-				if err != nil {
-					log.Fatalf("Failed to create Baserow purchase request: %v", err)
-				}
+	// remove processed pending purchases
+	if err := remove_processed_pending_purchases(ctx, baserowClient); err != nil {
+		return result, fmt.Errorf("Failed to remove processed pending purchases: %w", err)
+	}
 
-				newPurchaseRequests = append(newPurchaseRequests, req)
-			}
+	if fetchErr != nil {
+		return result, fmt.Errorf("Failed to fetch receipts: %w", fetchErr)
+	}
+
+	return result, nil
+}
+
+// attachmentRetryReason starts the Reason of the pending purchase left for a
+// receipt whose attachments couldn't be downloaded or converted, e.g. because
+// the download timed out. Like receipts paused by the AI budget, they are read
+// again by the next ingest run.
+const attachmentRetryReason = "Receipt attachment failed"
+
+func isAttachmentRetry(pp *models.BaserowPendingPurchase) bool {
+	return strings.HasPrefix(pp.Reason, attachmentRetryReason)
+}
+
+func isPaused(pp *models.BaserowPendingPurchase) bool {
+	return isAIBudgetPaused(pp) || isAttachmentRetry(pp)
+}
+
+// paused_receipts returns the transactions of the receipts left in
+// PendingPurchases because of the AI budget or a failed attachment, with
+// their pending purchases keyed by bank tx ID, once the budget allows them to
+// be read again.
+func paused_receipts(ctx context.Context, aiUsage *aiUsageTracker, bankClient *services.MercuryClient, groupedPendingPurchases map[string][]*models.BaserowPendingPurchase) ([]*models.MercuryTransaction, map[string][]models.BaserowData) {
+	var txs []*models.MercuryTransaction
+	rows := make(map[string][]models.BaserowData)
+	for bankTxID, pp := range groupedPendingPurchases {
+		if !slices.ContainsFunc(pp, isPaused) {
+			continue
+		}
+
+		if err := aiUsage.Check(ctx, nil); err != nil {
+			log.Infof("Not retrying paused receipts: %v", err)
+			return nil, nil
+		}
+
+		// the transaction may be older than the window being ingested
+		tx, err := bankClient.Transaction(ctx, "", bankTxID)
+		if err != nil {
+			log.Warnf("Failed to fetch paused transaction %s: %v", bankTxID, err)
+			continue
+		}
+
+		txs = append(txs, tx)
+		for _, row := range pp {
+			rows[bankTxID] = append(rows[bankTxID], row)
+		}
+	}
+
+	return txs, rows
+}
+
+// parse_transaction reads the receipt attached to a bank transaction, which
+// may be split over several images. A receipt that passes validation becomes a
+// purchase request; one that still fails after the reader's attempts becomes
+// pending purchases for review, as does a receipt the parser or attachments
+// fail on unless ctx is done. A receipt whose attachments can't be fetched,
+// and any receipt once the monthly AI budget is spent, become a paused
+// pending purchase that is read again next run.
+// Transactions without an attachment produce neither.
+func parse_transaction(ctx context.Context, reader *services.ReceiptReader, aiUsage *aiUsageTracker, mercuryTx *models.MercuryTransaction) (*models.CreateBaserowPurchaseRequest, []models.BaserowData, error) {
+	if len(mercuryTx.Attachments) == 0 {
+		return nil, nil, nil
+	}
+
+	// don't download the attachments when the budget is already spent
+	budgetErr := aiUsage.Check(ctx, nil)
+
+	var receipt *services.ReadResult
+	err := budgetErr
+	if err == nil {
+		// the reader checks the budget again before every model call
+		usage := &services.UsageRecorder{Check: func(calls []services.Usage) error {
+			budgetErr = aiUsage.Check(ctx, calls)
+			return budgetErr
+		}}
+		receipt, err = reader.Read(services.WithUsageRecorder(ctx, usage), mercuryTx)
+
+		// calls that were made are paid for even if the read failed
+		if recordErr := aiUsage.Record(ctx, mercuryTx.ID, usage.Calls()); recordErr != nil {
+			return nil, nil, recordErr
+		}
+	}
+
+	if errors.Is(err, ErrAIBudgetExceeded) {
+		log.Warnf("Pausing AI parsing for tx ID %s, storing it in PendingPurchases table until there is budget: %v", mercuryTx.ID, budgetErr)
+
+		pendingPurchases, err := models.NewBaserowPendingPurchases(models.ReceiptSummary{}, nil, mercuryTx, fmt.Errorf("%s: %w", aiBudgetPausedReason, budgetErr))
+		if err != nil {
+			return nil, nil, fmt.Errorf("Failed to create Baserow pending purchases: %w", err)
+		}
+
+		return nil, []models.BaserowData{pendingPurchases[0]}, nil
+	} else if errors.Is(err, services.ErrAttachmentFailed) && ctx.Err() == nil {
+		log.Warnf("Could not fetch receipt for tx ID %s, storing it in PendingPurchases table until the next run: %v", mercuryTx.ID, err)
+
+		pendingPurchases, err := models.NewBaserowPendingPurchases(models.ReceiptSummary{}, nil, mercuryTx, fmt.Errorf("%s: %w", attachmentRetryReason, err))
+		if err != nil {
+			return nil, nil, fmt.Errorf("Failed to create Baserow pending purchases: %w", err)
+		}
+
+		return nil, []models.BaserowData{pendingPurchases[0]}, nil
+	} else if err != nil && ctx.Err() == nil {
+		// e.g. ErrUnsupportedAttachment
+		log.Warnf("Could not read receipt for tx ID %s, storing it for review in PendingPurchases table: %v", mercuryTx.ID, err)
+
+		pendingPurchases, err := models.NewBaserowPendingPurchases(models.ReceiptSummary{}, nil, mercuryTx, err)
+		if err != nil {
+			return nil, nil, fmt.Errorf("Failed to create Baserow pending purchases: %w", err)
 		}
+
+		return nil, []models.BaserowData{pendingPurchases[0]}, nil
+	} else if err != nil {
+		return nil, nil, fmt.Errorf("Failed to parse receipt: %w, from %+v", err, mercuryTx)
+	}
+
+	if receipt.Invalid != nil {
+		log.Errorf("Invalid receipt data after %d attempts: %v, from %+v", len(receipt.Attempts), receipt.Invalid, mercuryTx)
+
+		log.Info("Storing invalid transaction for review in PendingPurchases table")
+		pendingPurchases, err := models.NewBaserowPendingPurchases(receipt.Summary, receipt.Items, mercuryTx, receipt.Invalid)
+		if err != nil {
+			return nil, nil, fmt.Errorf("Failed to create Baserow pending purchases: %w", err)
+		}
+
+		pendingPurchases[0].ParseAttempts = receipt.AttemptLog()
+		pendingPurchases[0].PromptVersion = receipt.PromptVersion
+
+		var rows []models.BaserowData
+		for _, pp := range pendingPurchases {
+			rows = append(rows, pp)
+		}
+
+		return nil, rows, nil
+	}
+
+	req, err := models.NewCreateBaserowPurchaseRequest(receipt.Summary, receipt.Items, mercuryTx, nil)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Failed to create Baserow purchase request: %w", err)
+	}
+
+	req.ParseAttempts = receipt.AttemptLog()
+	req.PromptVersion = receipt.PromptVersion
+
+	return &req, nil, nil
+}
+
+// write_purchase_requests creates the vendors, purchase events, purchase items
+// and purchases for the purchase requests, skipping requests whose bank
+// transaction already has a purchase event in existingPurchaseEventsMap.
+func write_purchase_requests(ctx context.Context, baserowClient *models.BaserowClient, newPurchaseRequests []models.CreateBaserowPurchaseRequest, existingPurchaseEventsMap map[string]*models.BaserowPurchaseEventTable, result *IngestResult) error {
+	if len(newPurchaseRequests) == 0 {
+		return nil
 	}
 
 	// fetch existing vendors
-	exisitingVendors, err := models.ListRows[*models.BaserowVendorTable](baserowClient)
+	exisitingVendors, err := models.ListRows[*models.BaserowVendorTable](ctx, baserowClient)
 	if err != nil {
-		log.Fatal(fmt.Errorf("Failed to list existing vendors: %w", err))
+		return fmt.Errorf("Failed to list existing vendors: %w", err)
 	}
 
 	existingVendorsMap := make(map[string]*models.BaserowVendorTable)
@@ -421,9 +634,9 @@ func main() {
 	}
 
 	// fetch existing purchase items
-	existingPurchaseItems, err := models.ListRows[*models.BaserowPurchaseItemTable](baserowClient)
+	existingPurchaseItems, err := models.ListRows[*models.BaserowPurchaseItemTable](ctx, baserowClient)
 	if err != nil {
-		log.Fatal(fmt.Errorf("Failed to list existing purchase items: %w", err))
+		return fmt.Errorf("Failed to list existing purchase items: %w", err)
 	}
 
 	existingPurchaseItemMap := make(map[string]*models.BaserowPurchaseItemTable)
@@ -431,17 +644,18 @@ func main() {
 		existingPurchaseItemMap[pi.Description] = pi
 	}
 
-	// process new purchase requests
-	for _, pr := range newPurchaseRequests {
+	// derive vendors, creating any that don't exist yet
+	var newVendors []models.BaserowData
+	for i := range newPurchaseRequests {
+		pr := &newPurchaseRequests[i]
+
 		vendorPk, isNew := services.DerivePurchaseItem(pr.ReceiptSummary.Vendor, existingVendorsMap)
 		if isNew {
 			newVendor := &models.BaserowVendorTable{
 				Name: vendorPk,
 			}
 
-			if err := baserowClient.CreateRow(newVendor); err != nil {
-				log.Fatal(fmt.Errorf("Failed to create new vendor: %w", err))
-			}
+			newVendors = append(newVendors, newVendor)
 
 			// update vendor map
 			existingVendorsMap[vendorPk] = newVendor
@@ -449,78 +663,580 @@ func main() {
 
 		// update receipt summary vendor to use primary key
 		pr.ReceiptSummary.Vendor = vendorPk
+	}
+
+	if err := baserowClient.CreateRows(ctx, newVendors); err != nil {
+		return fmt.Errorf("Failed to create new vendors: %w", err)
+	}
 
-		// process purchase event
-		var purchaseEventID string
-		if _, exists := existingPurchaseEventsMap[pr.BankTransaction.ID]; !exists {
-			purchaseEvent := models.NewPurchaseEvent(pr)
+	// create purchase events
+	var newPurchaseEvents []models.BaserowData
+	for _, pr := range newPurchaseRequests {
+		if _, exists := existingPurchaseEventsMap[pr.BankTransaction.ID]; exists {
+			continue
+		}
 
-			if err := baserowClient.CreateRow(purchaseEvent); err != nil {
-				log.Fatal(fmt.Errorf("Failed to create purchase event: %w", err))
-			}
+		purchaseEvent := models.NewPurchaseEvent(pr)
+		newPurchaseEvents = append(newPurchaseEvents, purchaseEvent)
 
-			// update purchase events map
-			existingPurchaseEventsMap[pr.BankTransaction.ID] = *purchaseEvent
+		// update purchase events map
+		existingPurchaseEventsMap[pr.BankTransaction.ID] = purchaseEvent
+	}
 
-			purchaseEventID = purchaseEvent.BankTxID
-		} else {
-			purchaseEventID = existingPurchaseEventsMap[pr.BankTransaction.ID].(*models.BaserowPurchaseEventTable).BankTxID
-		}
+	if err := baserowClient.CreateRows(ctx, newPurchaseEvents); err != nil {
+		return fmt.Errorf("Failed to create purchase events: %w", err)
+	}
+	result.PurchaseEventsCreated += len(newPurchaseEvents)
+
+	// derive purchase items and build purchases
+	var newPurchaseItems []models.BaserowData
+	var newPurchases []models.BaserowData
+	for _, pr := range newPurchaseRequests {
+		purchaseEventID := existingPurchaseEventsMap[pr.BankTransaction.ID].BankTxID
 
 		for _, item := range pr.ReceiptItems {
 			purchaseItemID, isNew := services.DerivePurchaseItem(item.Name, existingPurchaseItemMap)
 			if isNew {
 				purchaseItem := models.NewBaserowPurchaseItemTable(purchaseItemID)
-
-				if err := baserowClient.CreateRow(&purchaseItem); err != nil {
-					log.Fatal(fmt.Errorf("Failed to create purchase item: %w", err))
-				}
+				newPurchaseItems = append(newPurchaseItems, &purchaseItem)
 
 				// update purchase item map
 				existingPurchaseItemMap[purchaseItem.Description] = &purchaseItem
 			}
 
-			purchase := models.NewBaserowPurchaseTable(item, purchaseItemID, purchaseEventID)
+			newPurchases = append(newPurchases, models.NewBaserowPurchaseTable(item, purchaseItemID, purchaseEventID))
+		}
+	}
+
+	if err := baserowClient.CreateRows(ctx, newPurchaseItems); err != nil {
+		return fmt.Errorf("Failed to create purchase items: %w", err)
+	}
+
+	if err := baserowClient.CreateRows(ctx, newPurchases); err != nil {
+		return fmt.Errorf("Failed to create purchases: %w", err)
+	}
+	result.PurchasesCreated += len(newPurchases)
+
+	return nil
+}
+
+// run_sync_receipts ingests the transactions created since each of the
+// tenant's accounts was last synced, then records how far it got in store.
+// Accounts that were never synced start from fallback. A non-zero since
+// overrides the stored cursors, e.g. to backfill.
+func run_sync_receipts(ctx context.Context, reader *services.ReceiptReader, tenant *TenantClients, store *syncstate.Store, since, fallback, end time.Time) (*IngestResult, error) {
+	accounts, err := tenant.BankClient.Accounts(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("run_sync_receipts: %w", err)
+	}
+
+	cursors, err := store.Cursors(tenant.Name)
+	if err != nil {
+		return nil, fmt.Errorf("run_sync_receipts: %w", err)
+	}
+
+	start := since
+	if start.IsZero() {
+		start = syncstate.Start(accounts, cursors, fallback)
+	}
+
+	log.Infof("Syncing tenant %s from %s", tenant.Name, start.Format(time.DateOnly))
+
+	result, err := run_ingest_receipts(ctx, reader, tenant.AIUsage, tenant.BaserowClient, tenant.BankClient, start, end)
+
+	// transactions missing a receipt don't fail the sync; the cursor stops
+	// short of them so they are fetched again next time
+	if err != nil && !errors.Is(err, services.ErrMissingReceipts) {
+		return result, err
+	}
+
+	next, advanceErr := syncstate.Advance(cursors, result.ValidTransactions, result.InvalidTransactions)
+	if advanceErr != nil {
+		return result, fmt.Errorf("run_sync_receipts: %w", advanceErr)
+	}
+
+	if saveErr := store.Save(tenant.Name, accounts, next); saveErr != nil {
+		return result, fmt.Errorf("run_sync_receipts: %w", saveErr)
+	}
+
+	return result, err
+}
+
+// TenantClients holds the API clients for one configured tenant.
+type TenantClients struct {
+	Name          string
+	BaserowClient *models.BaserowClient
+	BankClient    *services.MercuryClient
+	// WebhookSecret verifies Mercury webhook events; webhooks are rejected
+	// when it is empty.
+	WebhookSecret string
+	// AIUsage records the tenant's model calls and enforces its AI budget.
+	AIUsage *aiUsageTracker
+}
+
+func NewTenantClients(tenant *config.Tenant) (*TenantClients, error) {
+	baserowClient, err := tenant.NewBaserowClient()
+	if err != nil {
+		return nil, err
+	}
+
+	bankClient, err := tenant.NewMercuryClient()
+	if err != nil {
+		return nil, err
+	}
+
+	aiUsage := newAIUsageTracker(baserowClient, tenant.AIMonthlyBudgetUSD)
+	if tenant.AIMonthlyBudgetUSD > 0 && !aiUsage.enabled() {
+		return nil, fmt.Errorf("tenant %q: ai_monthly_budget_usd needs the %s table to be configured", tenant.Name, models.BaserowAIUsageTableName)
+	}
+
+	return &TenantClients{
+		Name:          tenant.Name,
+		BaserowClient: baserowClient,
+		BankClient:    bankClient,
+		WebhookSecret: tenant.WebhookSecret(),
+		AIUsage:       aiUsage,
+	}, nil
+}
+
+func loadTenant(cfg *config.Config, name string) *TenantClients {
+	tenant, err := cfg.Tenant(name)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	clients, err := NewTenantClients(tenant)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	return clients
+}
+
+// verifySchema checks the tenant's Baserow tables against the models so that
+// renamed or retyped fields are caught before the pipeline writes anything.
+func verifySchema(ctx context.Context, tenant *TenantClients) error {
+	report, err := schema.Verify(ctx, tenant.BaserowClient)
+	if err != nil {
+		return fmt.Errorf("tenant %q: %w", tenant.Name, err)
+	}
+
+	if !report.OK() {
+		return fmt.Errorf("tenant %q: Baserow schema does not match the models (run verify-schema for details):\n%s", tenant.Name, report)
+	}
+
+	for _, p := range report.Problems {
+		log.Warnf("tenant %q: %s", tenant.Name, p)
+	}
 
-			if err := baserowClient.CreateRow(purchase); err != nil {
-				log.Fatal(fmt.Errorf("Failed to create purchase: %w", err))
+	return nil
+}
+
+// run_provision_schema creates the tenant's missing tables and fields in the
+// given database. Creating tables needs a user session rather than a database
+// token, so it logs in with BASEROW_EMAIL and BASEROW_PASSWORD.
+func run_provision_schema(ctx context.Context, tenant *config.Tenant, databaseID int) (*schema.ProvisionResult, error) {
+	email := os.Getenv("BASEROW_EMAIL")
+	password := os.Getenv("BASEROW_PASSWORD")
+	if email == "" || password == "" {
+		return nil, fmt.Errorf("BASEROW_EMAIL and BASEROW_PASSWORD environment variables must be set")
+	}
+
+	token, err := models.BaserowTokenAuth(ctx, tenant.Baserow.BaseURL, email, password)
+	if err != nil {
+		return nil, fmt.Errorf("run_provision_schema: failed to log in to Baserow: %w", err)
+	}
+
+	client := models.NewBaserowClient(tenant.Baserow.BaseURL, "", models.WithJWT(token), models.WithTableIDs(tenant.Baserow.Tables))
+
+	result, err := schema.Provision(ctx, client, databaseID)
+	if err != nil {
+		return result, fmt.Errorf("run_provision_schema: tenant %q: %w", tenant.Name, err)
+	}
+
+	return result, nil
+}
+
+// run_cache inspects and invalidates the parse cache. Entries are matched by
+// a prefix of their key or of the SHA-256 of their receipt files.
+func run_cache(store *parsecache.Store, args []string, out io.Writer) error {
+	if len(args) == 0 {
+		return fmt.Errorf("run_cache: expected a subcommand: list, show, delete or clear")
+	}
+
+	switch args[0] {
+	case "list":
+		entries, err := store.List()
+		if err != nil {
+			return fmt.Errorf("run_cache: %w", err)
+		}
+
+		w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "KEY\tFILES\tPARSER\tPROMPT\tCORRECTED\tCREATED\tVENDOR\tTOTAL")
+		for _, e := range entries {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%t\t%s\t%s\t%.2f\n", shortHash(e.Key), shortHash(e.FilesSHA256), e.Parser, e.PromptVersion, e.Corrected, e.CreatedAt.Format(time.RFC3339), e.Receipt.Summary.Vendor, e.Receipt.Summary.Total)
+		}
+		return w.Flush()
+
+	case "show", "delete":
+		if len(args) < 2 {
+			return fmt.Errorf("run_cache: %s needs at least one key or file hash", args[0])
+		}
+
+		var matches []*parsecache.Entry
+		for _, prefix := range args[1:] {
+			entries, err := store.Find(prefix)
+			if err != nil {
+				return fmt.Errorf("run_cache: %w", err)
+			}
+
+			if len(entries) == 0 {
+				return fmt.Errorf("run_cache: no cache entry matches %q", prefix)
 			}
+
+			matches = append(matches, entries...)
+		}
+
+		if args[0] == "show" {
+			enc := json.NewEncoder(out)
+			enc.SetIndent("", "  ")
+			return enc.Encode(matches)
+		}
+
+		if err := store.Delete(matches...); err != nil {
+			return fmt.Errorf("run_cache: %w", err)
+		}
+
+		fmt.Fprintf(out, "Deleted %d cache entries\n", len(matches))
+		return nil
+
+	case "clear":
+		entries, err := store.List()
+		if err != nil {
+			return fmt.Errorf("run_cache: %w", err)
+		}
+
+		if err := store.Delete(entries...); err != nil {
+			return fmt.Errorf("run_cache: %w", err)
 		}
+
+		fmt.Fprintf(out, "Deleted %d cache entries\n", len(entries))
+		return nil
+
+	default:
+		return fmt.Errorf("run_cache: unknown subcommand %q, expected one of: list, show, delete, clear", args[0])
 	}
+}
 
-	// remove processed pending purchases
-	if err := remove_processed_pending_purchases(ctx, baserowClient); err != nil {
-		log.Fatal(fmt.Errorf("Failed to remove processed pending purchases: %w", err))
+// shortHash abbreviates a hash for display, leaving short values as they are.
+func shortHash(hash string) string {
+	if len(hash) < 12 {
+		return hash
 	}
+	return hash[:12]
+}
 
+// run_eval_compare prints the metrics of two eval reports side by side, e.g.
+// for two models or prompt versions run over the same golden receipts.
+func run_eval_compare(pathA, pathB string, out io.Writer) error {
+	a, err := eval.LoadReport(pathA)
 	if err != nil {
-		if len(invalidTx) > 0 {
-			log.Errorf("Next invalid transactions: %+v", invalidTx)
-		}
+		return fmt.Errorf("run_eval_compare: %w", err)
+	}
 
-		log.Fatal(fmt.Errorf("Failed to fetch receipts: %w", err))
+	b, err := eval.LoadReport(pathB)
+	if err != nil {
+		return fmt.Errorf("run_eval_compare: %w", err)
 	}
 
-	// newRow := BaserowItemTable{
-	// 	Name: "Test Item from Go Client",
-	// }
+	comparison := eval.Compare(a, b)
+
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(w, "METRIC\tA (%s)\tB (%s)\tDELTA\n", a.Parser, b.Parser)
+	for _, m := range comparison.Metrics {
+		fmt.Fprintf(w, "%s\t%.4g\t%.4g\t%+.4g\n", m.Name, m.A, m.B, m.Delta)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	if len(comparison.Fixed) > 0 {
+		fmt.Fprintf(out, "\nPass in B only: %s\n", strings.Join(comparison.Fixed, ", "))
+	}
+	if len(comparison.Broken) > 0 {
+		fmt.Fprintf(out, "\nPass in A only: %s\n", strings.Join(comparison.Broken, ", "))
+	}
+
+	return nil
+}
+
+func main() {
+	ctx := context.Background()
+
+	cfg, err := config.Load(os.Getenv("CONFIG_FILE"))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	cmd := "serve"
+	var args []string
+	if len(os.Args) > 1 {
+		cmd = os.Args[1]
+		args = os.Args[2:]
+	}
+
+	fs := flag.NewFlagSet(cmd, flag.ExitOnError)
+	tenantName := fs.String("tenant", os.Getenv("TENANT"), "tenant to run against (defaults to the config's default tenant)")
+	skipSchemaCheck := fs.Bool("skip-schema-check", false, "skip verifying the Baserow schema on startup")
+
+	switch cmd {
+	case "serve":
+		fs.Parse(args)
+
+		username := os.Getenv("BASIC_AUTH_USERNAME")
+		password := os.Getenv("BASIC_AUTH_PASSWORD")
+		if username == "" || password == "" {
+			log.Fatal("BASIC_AUTH_USERNAME and BASIC_AUTH_PASSWORD environment variables must be set")
+		}
+
+		port := os.Getenv("PORT")
+		if port == "" {
+			port = "8080"
+		}
+
+		reader, err := cfg.NewReceiptReader(ctx)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		tenants := make(map[string]*TenantClients)
+		for _, t := range cfg.Tenants {
+			tenants[t.Name] = loadTenant(cfg, t.Name)
+
+			if !*skipSchemaCheck {
+				if err := verifySchema(ctx, tenants[t.Name]); err != nil {
+					log.Fatal(err)
+				}
+			}
+		}
+
+		defaultTenant, err := cfg.Tenant(*tenantName)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		server := NewServer(reader, tenants, defaultTenant.Name, username, password)
+		if err := server.ListenAndServe(ctx, ":"+port); err != nil {
+			log.Fatal(fmt.Errorf("Server failed: %w", err))
+		}
+
+	case "ingest":
+		days := fs.Int("days", defaultIngestDays, "number of days of bank transactions to ingest for accounts that have never been synced")
+		sinceFlag := fs.String("since", "", "ingest transactions since this date (YYYY-MM-DD) instead of the last sync, e.g. to backfill")
+		fs.Parse(args)
+
+		var since time.Time
+		if *sinceFlag != "" {
+			since, err = time.Parse(time.DateOnly, *sinceFlag)
+			if err != nil {
+				log.Fatalf("invalid -since %q: expected YYYY-MM-DD", *sinceFlag)
+			}
+		}
+
+		statePath := os.Getenv("SYNC_STATE_FILE")
+		if statePath == "" {
+			statePath = syncstate.DefaultPath
+		}
+
+		tenant := loadTenant(cfg, *tenantName)
+
+		if !*skipSchemaCheck {
+			if err := verifySchema(ctx, tenant); err != nil {
+				log.Fatal(err)
+			}
+		}
+
+		reader, err := cfg.NewReceiptReader(ctx)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		end := time.Now()
+		fallback := end.AddDate(0, 0, -*days)
+
+		result, err := run_sync_receipts(ctx, reader, tenant, syncstate.NewStore(statePath), since, fallback, end)
+		if err != nil {
+			if result != nil && len(result.InvalidTransactions) > 0 {
+				log.Errorf("Next invalid transactions: %+v", result.InvalidTransactions)
+			}
+
+			log.Fatal(err)
+		}
+
+		log.Infof("Ingested receipts for tenant %s: %+v", tenant.Name, *result)
+
+	case "apply-fixtures":
+		fs.Parse(args)
+
+		tenant := loadTenant(cfg, *tenantName)
+
+		if err := run_apply_purchase_item_groups_fixtures(ctx, tenant.BaserowClient); err != nil {
+			log.Fatal(fmt.Errorf("Failed to apply purchase item groups fixtures: %w", err))
+		}
+
+	case "verify-schema":
+		fs.Parse(args)
+
+		tenant := loadTenant(cfg, *tenantName)
+
+		report, err := schema.Verify(ctx, tenant.BaserowClient)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		fmt.Print(report)
+
+		if !report.OK() {
+			os.Exit(1)
+		}
+
+	case "provision-schema":
+		databaseID := fs.Int("database-id", 0, "ID of the Baserow database to create the tables in")
+		fs.Parse(args)
+
+		if *databaseID == 0 {
+			log.Fatal("-database-id is required")
+		}
+
+		configFile := os.Getenv("CONFIG_FILE")
+		if configFile == "" {
+			log.Fatal("CONFIG_FILE must be set so the new table IDs can be saved")
+		}
+
+		tenant, err := cfg.Tenant(*tenantName)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		result, err := run_provision_schema(ctx, tenant, *databaseID)
+
+		// save the tables created before any failure so a rerun picks up where
+		// this one stopped
+		if result != nil && len(result.CreatedTables) > 0 {
+			if saveErr := config.SaveTableIDs(configFile, tenant.Name, result.TableIDs); saveErr != nil {
+				log.Error(saveErr)
+			}
+		}
 
-	// if err := baserowClient.CreateRow(newRow); err != nil {
-	// 	log.Fatal(fmt.Errorf("Failed to create Baserow row: %w", err))
-	// }
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		log.Infof("Provisioned tenant %s: created tables %v and fields %v; table IDs saved to %s", tenant.Name, result.CreatedTables, result.CreatedFields, configFile)
+
+	case "cache":
+		fs.Parse(args)
+
+		if err := run_cache(parsecache.NewStore(cfg.Parser.CacheDir), fs.Args(), os.Stdout); err != nil {
+			log.Fatal(err)
+		}
 
-	// rows, err := ListRows[BaserowItemTable](baserowClient)
-	// if err != nil {
-	// 	log.Fatal(fmt.Errorf("Failed to list Baserow rows: %w", err))
-	// }
+	case "eval":
+		out := fs.String("out", "", "file to write the JSON report to (defaults to stdout)")
+		useCache := fs.Bool("cache", false, "answer from the parse cache where possible; off by default so latency and cost are measured")
+		compare := fs.Bool("compare", false, "compare two reports given as arguments instead of running an eval")
+		fs.Parse(args)
 
-	// for _, row := range rows {
-	// 	fmt.Printf("Row: %+v\n", row)
-	// }
+		if *compare {
+			if fs.NArg() != 2 {
+				log.Fatal("-compare needs two report files")
+			}
+
+			if err := run_eval_compare(fs.Arg(0), fs.Arg(1), os.Stdout); err != nil {
+				log.Fatal(err)
+			}
+			return
+		}
+
+		if fs.NArg() != 1 {
+			log.Fatal("eval needs a directory of golden receipts")
+		}
 
-	// fmt.Println("Successfully created a new row in Baserow!")
+		cfg.Parser.DisableCache = !*useCache
 
-	// if err := run_apply_purchase_item_groups_fixtures(context.Background(), baserowClient); err != nil {
-	// 	log.Fatal(fmt.Errorf("Failed to apply purchase item groups fixtures: %w", err))
-	// }
+		reader, err := cfg.NewReceiptReader(ctx)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		cases, err := eval.LoadCases(fs.Arg(0))
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		report := eval.Run(ctx, reader, cases)
+
+		w := io.Writer(os.Stdout)
+		if *out != "" {
+			f, err := os.Create(*out)
+			if err != nil {
+				log.Fatal(err)
+			}
+			defer f.Close()
+			w = f
+		}
+
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(report); err != nil {
+			log.Fatal(err)
+		}
+
+		log.Infof("Evaluated %s on %d receipts: %+v", report.Parser, len(cases), report.Summary)
+
+	case "ai-usage":
+		month := fs.String("month", "", "month to report (YYYY-MM); defaults to every month")
+		fs.Parse(args)
+
+		if *month != "" {
+			if _, err := time.Parse(aiUsageMonthLayout, *month); err != nil {
+				log.Fatalf("invalid -month %q: expected YYYY-MM", *month)
+			}
+		}
+
+		tenant, err := cfg.Tenant(*tenantName)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		clients := loadTenant(cfg, tenant.Name)
+
+		if err := run_ai_usage_report(ctx, clients.BaserowClient, *month, tenant.AIMonthlyBudgetUSD, os.Stdout); err != nil {
+			log.Fatal(err)
+		}
+
+	case "record-transactions":
+		days := fs.Int("days", defaultIngestDays, "number of days of bank transactions to record")
+		out := fs.String("out", "", "fixture directory to write transactions.json and attachments to")
+		fs.Parse(args)
+
+		if *out == "" {
+			log.Fatal("-out is required")
+		}
+
+		tenant := loadTenant(cfg, *tenantName)
+
+		end := time.Now()
+		start := end.AddDate(0, 0, -*days)
+
+		n, err := tenant.BankClient.RecordTransactions(ctx, start, end, *out)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		log.Infof("Recorded %d transactions for tenant %s to %s", n, tenant.Name, *out)
+
+	default:
+		log.Fatalf("Unknown command %q. Expected one of: serve, ingest, apply-fixtures, verify-schema, provision-schema, cache, eval, ai-usage, record-transactions", cmd)
+	}
 }
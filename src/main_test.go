@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jiaming2012/receipt-bot/src/fakes"
+	"github.com/jiaming2012/receipt-bot/src/models"
+	"github.com/jiaming2012/receipt-bot/src/parsecache"
+)
+
+func TestApplyPurchaseItemGroupsFixtures(t *testing.T) {
+	ctx := context.Background()
+	fake := fakes.NewBaserow(t)
+	client := fake.Client()
+
+	t.Setenv("PROJECT_DIR", "..")
+
+	if err := run_apply_purchase_item_groups_fixtures(ctx, client); err != nil {
+		t.Fatalf("run_apply_purchase_item_groups_fixtures: %v", err)
+	}
+
+	groups, err := models.ListRows[*models.BaserowPurchaseItemGroupTable](ctx, client)
+	if err != nil {
+		t.Fatalf("ListRows: %v", err)
+	}
+
+	if len(groups) == 0 {
+		t.Fatalf("expected purchase item groups to be created")
+	}
+
+	var brisket *models.BaserowPurchaseItemGroupTable
+	for _, g := range groups {
+		if g.Name == "Brisket" {
+			brisket = g
+		}
+	}
+
+	if brisket == nil || len(brisket.PurchaseItems) != 1 || brisket.PurchaseItems[0].Value != "BRISKET" || len(brisket.Tags) != 3 {
+		t.Errorf("expected Brisket to link to BRISKET and 3 tags, got %+v", brisket)
+	}
+
+	// applying the fixtures again does not duplicate rows
+	if err := run_apply_purchase_item_groups_fixtures(ctx, client); err != nil {
+		t.Fatalf("run_apply_purchase_item_groups_fixtures (rerun): %v", err)
+	}
+
+	if got := len(fake.Rows(models.BaserowPurchaseItemGroupTableName)); got != len(groups) {
+		t.Errorf("expected %d groups after rerun, got %d", len(groups), got)
+	}
+}
+
+func TestRemoveProcessedPendingPurchases(t *testing.T) {
+	fake := fakes.NewBaserow(t)
+	fake.SeedFile("testdata/baserow_seed.yaml")
+
+	if err := remove_processed_pending_purchases(context.Background(), fake.Client()); err != nil {
+		t.Fatalf("remove_processed_pending_purchases: %v", err)
+	}
+
+	rows := fake.Rows(models.BaserowPendingPurchasesTableName)
+	if len(rows) != 1 || rows[0]["Bank Tx ID"] != "tx-unprocessed" {
+		t.Fatalf("expected only tx-unprocessed to remain, got %v", rows)
+	}
+
+	// deleting a pending purchase unlinks it from its purchase
+	purchases := fake.Rows(models.BaserowPurchaseTableName)
+	if links := purchases[0]["PendingPurchases"].([]map[string]interface{}); len(links) != 0 {
+		t.Errorf("expected the purchase to have no pending purchases left, got %v", links)
+	}
+}
+
+func TestRunCacheHandlesHandEditedEntries(t *testing.T) {
+	dir := t.TempDir()
+
+	// an entry without its hashes, e.g. truncated or from an older format
+	key := strings.Repeat("3f2a", 16)
+	if err := os.WriteFile(filepath.Join(dir, key+".json"), []byte(`{"Parser":"gemini/gemini-2.5-flash"}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	// a file that isn't named after a key isn't an entry
+	if err := os.WriteFile(filepath.Join(dir, "backup.json"), []byte(`{"Parser":"gemini/gemini-2.5-flash"}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	store := parsecache.NewStore(dir)
+
+	var out bytes.Buffer
+	if err := run_cache(store, []string{"list"}, &out); err != nil {
+		t.Fatalf("run_cache list: %v", err)
+	}
+
+	if !strings.Contains(out.String(), key[:12]) || strings.Contains(out.String(), "backup") {
+		t.Errorf("expected only the entry to be listed, by its file name, got:\n%s", out.String())
+	}
+
+	if err := run_cache(store, []string{"clear"}, &out); err != nil {
+		t.Fatalf("run_cache clear: %v", err)
+	}
+
+	if entries, _ := store.List(); len(entries) != 0 {
+		t.Errorf("expected the entry to be deleted, got %d entries", len(entries))
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "backup.json")); err != nil {
+		t.Errorf("expected the other file to be left alone: %v", err)
+	}
+}
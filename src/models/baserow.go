@@ -1,140 +1,227 @@
 package models
 
 import (
-	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
-	"io"
 	"net/http"
-	"strconv"
+	"time"
 
 	"golang.org/x/text/cases"
 	"golang.org/x/text/language"
 )
 
+// Table names identify each table type independently of the database it
+// lives in; the client resolves them to table IDs through its configuration.
 const (
-	BaserowItemTableID              = "786113"
-	BaserowTagTableID               = "786134"
-	BaserowPurchaseItemTableID      = "786129"
-	BaserowPurchaseItemGroupTableID = "786135"
-	BaserowVendorTableID            = "786130"
-	BaserowPurchaseEventTableID     = "786138"
-	BaserowPendingPurchasesTableID  = "788804"
-	BaserowPurchaseTableID          = "786116"
+	BaserowItemTableName              = "Item"
+	BaserowTagTableName               = "Tag"
+	BaserowPurchaseItemTableName      = "PurchaseItem"
+	BaserowPurchaseItemGroupTableName = "PurchaseItemGroup"
+	BaserowVendorTableName            = "Vendor"
+	BaserowPurchaseEventTableName     = "PurchaseEvent"
+	BaserowPendingPurchasesTableName  = "PendingPurchases"
+	BaserowPurchaseTableName          = "Purchase"
+	BaserowAIUsageTableName           = "AIUsage"
 )
 
+// BaserowTableNames lists every table the pipeline reads or writes.
+var BaserowTableNames = []string{
+	BaserowItemTableName,
+	BaserowTagTableName,
+	BaserowPurchaseItemTableName,
+	BaserowPurchaseItemGroupTableName,
+	BaserowVendorTableName,
+	BaserowPurchaseEventTableName,
+	BaserowPendingPurchasesTableName,
+	BaserowPurchaseTableName,
+	BaserowAIUsageTableName,
+}
+
+// BaserowTables returns the type used to read each table, keyed by table name.
+func BaserowTables() map[string]BaserowData {
+	return map[string]BaserowData{
+		BaserowItemTableName:              &BaserowItemTable{},
+		BaserowTagTableName:               &BaserowTagTable{},
+		BaserowPurchaseItemTableName:      &BaserowPurchaseItemTable{},
+		BaserowPurchaseItemGroupTableName: &BaserowPurchaseItemGroupTable{},
+		BaserowVendorTableName:            &BaserowVendorTable{},
+		BaserowPurchaseEventTableName:     &BaserowPurchaseEventTable{},
+		BaserowPendingPurchasesTableName:  &BaserowPendingPurchase{},
+		BaserowPurchaseTableName:          &BaserowPurchaseTable{},
+		BaserowAIUsageTableName:           &BaserowAIUsage{},
+	}
+}
+
 type BaserowClient struct {
-	ApiKey  string
-	BaseURL string
+	ApiKey string
+	// AuthScheme prefixes ApiKey in the Authorization header: "Token" for
+	// database tokens, "JWT" for user sessions.
+	AuthScheme string
+	BaseURL    string
+	TableIDs   map[string]string // table name -> Baserow table ID
+	HTTPClient *http.Client
+	MaxRetries int
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
 }
 
-func (c *BaserowClient) UpdateRow(data BaserowData, jsonStr string) error {
-	client := &http.Client{}
-	url := fmt.Sprintf("%s/api/database/rows/table/%s/%s/?user_field_names=true", c.BaseURL, data.GetTableID(), data.GetRowID())
+type BaserowClientOption func(*BaserowClient)
 
-	rawData := []byte(jsonStr)
-	req, err := http.NewRequest("PATCH", url, bytes.NewBuffer(rawData))
-	if err != nil {
-		return fmt.Errorf("Error creating request: %v", err)
+// WithHTTPClient replaces the default http.Client, e.g. to inject a custom
+// transport or timeout.
+func WithHTTPClient(httpClient *http.Client) BaserowClientOption {
+	return func(c *BaserowClient) {
+		c.HTTPClient = httpClient
+	}
+}
+
+// WithJWT authenticates as a user instead of with a database token. Creating
+// tables and fields requires a user session; see BaserowTokenAuth.
+func WithJWT(token string) BaserowClientOption {
+	return func(c *BaserowClient) {
+		c.ApiKey = token
+		c.AuthScheme = "JWT"
 	}
+}
+
+// WithTableIDs sets the Baserow table ID of each table name.
+func WithTableIDs(tableIDs map[string]string) BaserowClientOption {
+	return func(c *BaserowClient) {
+		c.TableIDs = tableIDs
+	}
+}
 
-	req.Header.Add("Authorization", "Token "+c.ApiKey)
-	req.Header.Add("Content-Type", "application/json")
-	req.Header.Add("Accept", "application/json")
+// TableID resolves the ID of the table data belongs to.
+func (c *BaserowClient) TableID(data BaserowData) (string, error) {
+	return c.TableIDByName(data.GetTableName())
+}
+
+func (c *BaserowClient) TableIDByName(tableName string) (string, error) {
+	tableID, ok := c.TableIDs[tableName]
+	if !ok || tableID == "" {
+		return "", fmt.Errorf("no table ID configured for table %s", tableName)
+	}
 
-	resp, err := client.Do(req)
+	return tableID, nil
+}
+
+// WithRetryPolicy configures how rate-limited and transient failures are
+// retried. maxRetries of 0 disables retries.
+func WithRetryPolicy(maxRetries int, minBackoff, maxBackoff time.Duration) BaserowClientOption {
+	return func(c *BaserowClient) {
+		c.MaxRetries = maxRetries
+		c.MinBackoff = minBackoff
+		c.MaxBackoff = maxBackoff
+	}
+}
+
+// BaserowFields is a partial row update keyed by Baserow field name.
+type BaserowFields map[string]interface{}
+
+// UpdateRow sets the given fields on the row and refreshes data, which must be
+// a pointer, with the updated row returned by Baserow. Field names must match
+// a field of data's table.
+func (c *BaserowClient) UpdateRow(ctx context.Context, data BaserowData, fields BaserowFields) error {
+	if err := validateFields(data, fields); err != nil {
+		return fmt.Errorf("UpdateRow: %w", err)
+	}
+
+	rawData, err := json.Marshal(fields)
 	if err != nil {
-		return fmt.Errorf("Error making API request: %v", err)
+		return fmt.Errorf("Error marshalling data: %v", err)
 	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		bodyBytes, err := io.ReadAll(resp.Body)
-		if err != nil {
-			return fmt.Errorf("API request failed with status: %s and error reading body: %v", resp.Status, err)
-		}
-		bodyString := string(bodyBytes)
-		return fmt.Errorf("API request failed with status: %s and body: %s", resp.Status, bodyString)
+
+	if err := c.patchRow(ctx, data, rawData); err != nil {
+		return fmt.Errorf("UpdateRow: %w", err)
 	}
 
 	return nil
 }
 
-func (c *BaserowClient) DeleteRow(data BaserowData) error {
-	if !data.DeleteRowsAllowed() {
-		return fmt.Errorf("deleting rows is not allowed for table ID %s", data.GetTableID())
+func (c *BaserowClient) patchRow(ctx context.Context, data BaserowData, rawData []byte) error {
+	tableID, err := c.TableID(data)
+	if err != nil {
+		return err
 	}
 
-	client := &http.Client{}
-	url := fmt.Sprintf("%s/api/database/rows/table/%s/%s/", c.BaseURL, data.GetTableID(), data.GetRowID())
+	url := fmt.Sprintf("%s/api/database/rows/table/%s/%s/?user_field_names=true", c.BaseURL, tableID, data.GetRowID())
 
-	req, err := http.NewRequest("DELETE", url, nil)
+	body, err := c.do(ctx, http.MethodPatch, url, rawData)
 	if err != nil {
-		return fmt.Errorf("Error creating request: %v", err)
+		return err
 	}
 
-	req.Header.Add("Authorization", "Token "+c.ApiKey)
-	req.Header.Add("Accept", "application/json")
+	if err := decodeRow(data, body); err != nil {
+		return fmt.Errorf("failed to decode updated row: %w", err)
+	}
 
-	resp, err := client.Do(req)
+	return nil
+}
+
+func (c *BaserowClient) DeleteRow(ctx context.Context, data BaserowData) error {
+	if !data.DeleteRowsAllowed() {
+		return fmt.Errorf("deleting rows is not allowed for table %s", data.GetTableName())
+	}
+
+	tableID, err := c.TableID(data)
 	if err != nil {
-		return fmt.Errorf("Error making API request: %v", err)
+		return fmt.Errorf("DeleteRow: %w", err)
 	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusNoContent {
-		bodyBytes, err := io.ReadAll(resp.Body)
-		if err != nil {
-			return fmt.Errorf("API request failed with status: %s and error reading body: %v", resp.Status, err)
-		}
-		bodyString := string(bodyBytes)
-		return fmt.Errorf("API request failed with status: %s and body: %s", resp.Status, bodyString)
+
+	url := fmt.Sprintf("%s/api/database/rows/table/%s/%s/", c.BaseURL, tableID, data.GetRowID())
+
+	if _, err := c.do(ctx, http.MethodDelete, url, nil); err != nil {
+		return fmt.Errorf("DeleteRow: %w", err)
 	}
 
 	return nil
 }
 
-func (c *BaserowClient) CreateRow(data BaserowData) error {
-	client := &http.Client{}
-	url := fmt.Sprintf("%s/api/database/rows/table/%s/?user_field_names=true", c.BaseURL, data.GetTableID())
+// CreateRow creates the row and populates data, which must be a pointer, with
+// the created row returned by Baserow, including its ID and any
+// server-computed fields.
+func (c *BaserowClient) CreateRow(ctx context.Context, data BaserowData) error {
+	tableID, err := c.TableID(data)
+	if err != nil {
+		return fmt.Errorf("CreateRow: %w", err)
+	}
+
+	url := fmt.Sprintf("%s/api/database/rows/table/%s/?user_field_names=true", c.BaseURL, tableID)
 
 	rawData, err := json.Marshal(data)
 	if err != nil {
 		return fmt.Errorf("Error marshalling data: %v", err)
 	}
 
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(rawData))
+	body, err := c.do(ctx, http.MethodPost, url, rawData)
 	if err != nil {
-		return fmt.Errorf("Error creating request: %v", err)
+		return fmt.Errorf("CreateRow: %w", err)
 	}
 
-	req.Header.Add("Authorization", "Token "+c.ApiKey)
-	req.Header.Add("Content-Type", "application/json")
-	req.Header.Add("Accept", "application/json")
-
-	resp, err := client.Do(req)
-	if err != nil {
-		return fmt.Errorf("Error making API request: %v", err)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		bodyBytes, err := io.ReadAll(resp.Body)
-		if err != nil {
-			return fmt.Errorf("API request failed with status: %s and error reading body: %v", resp.Status, err)
-		}
-		bodyString := string(bodyBytes)
-		return fmt.Errorf("API request failed with status: %s and body: %s", resp.Status, bodyString)
+	if err := decodeRow(data, body); err != nil {
+		return fmt.Errorf("CreateRow: failed to decode created row: %w", err)
 	}
 
 	return nil
 }
 
-func NewBaserowClient(baseURL, apiKey string) *BaserowClient {
-	return &BaserowClient{
-		ApiKey:  apiKey,
-		BaseURL: baseURL,
+func NewBaserowClient(baseURL, apiKey string, opts ...BaserowClientOption) *BaserowClient {
+	c := &BaserowClient{
+		ApiKey:     apiKey,
+		AuthScheme: "Token",
+		BaseURL:    baseURL,
+		HTTPClient: &http.Client{Timeout: defaultHTTPTimeout},
+		MaxRetries: defaultMaxRetries,
+		MinBackoff: defaultMinBackoff,
+		MaxBackoff: defaultMaxBackoff,
+	}
+
+	for _, opt := range opts {
+		opt(c)
 	}
+
+	return c
 }
 
 type BaserowItemTable struct {
@@ -142,8 +229,8 @@ type BaserowItemTable struct {
 	Name string `json:"Name"`
 }
 
-func (b BaserowItemTable) GetTableID() string {
-	return BaserowItemTableID
+func (b BaserowItemTable) GetTableName() string {
+	return BaserowItemTableName
 }
 
 func (b BaserowItemTable) DeleteRowsAllowed() bool {
@@ -163,17 +250,8 @@ type BaserowTagTable struct {
 	TagName string `json:"Name"`
 }
 
-func (b *BaserowTagTable) UnmarshalJSON(data io.ReadCloser) (interface{}, error) {
-	var out BaserowQueryResponse[*BaserowTagTable]
-	if err := json.NewDecoder(data).Decode(&out); err != nil {
-		return nil, fmt.Errorf("error decoding JSON: %v", err)
-	}
-
-	return out, nil
-}
-
-func (b BaserowTagTable) GetTableID() string {
-	return BaserowTagTableID
+func (b BaserowTagTable) GetTableName() string {
+	return BaserowTagTableName
 }
 
 func (b BaserowTagTable) DeleteRowsAllowed() bool {
@@ -193,17 +271,8 @@ type BaserowPurchaseItemTable struct {
 	Description string `json:"Description"`
 }
 
-func (b *BaserowPurchaseItemTable) UnmarshalJSON(data io.ReadCloser) (interface{}, error) {
-	var out BaserowQueryResponse[*BaserowPurchaseItemTable]
-	if err := json.NewDecoder(data).Decode(&out); err != nil {
-		return nil, fmt.Errorf("error decoding JSON: %v", err)
-	}
-
-	return out, nil
-}
-
-func (b BaserowPurchaseItemTable) GetTableID() string {
-	return BaserowPurchaseItemTableID
+func (b BaserowPurchaseItemTable) GetTableName() string {
+	return BaserowPurchaseItemTableName
 }
 
 func (b BaserowPurchaseItemTable) DeleteRowsAllowed() bool {
@@ -224,24 +293,23 @@ type LinkedItem struct {
 	Order string `json:"order"`
 }
 
+// LinkRowID is the ID of the one row linked by a link-row field. Baserow only
+// accepts links as a list, so it is written as a list of one ID.
+type LinkRowID int
+
+func (id LinkRowID) MarshalJSON() ([]byte, error) {
+	return json.Marshal([]int{int(id)})
+}
+
 type BaserowPurchaseItemGroupTable struct {
 	ID            int          `json:"id"`
 	Name          string       `json:"Name"`
-	PurchaseItems []LinkedItem `json:"Purchase Items"` // Assuming this is a link to multiple purchase items by their IDs
-	Tags          []LinkedItem `json:"Tags"`           // Assuming this is a link to multiple tags by their IDs
+	PurchaseItems []LinkedItem `json:"Purchase Items" baserow:"Purchase Items,table=PurchaseItem"`
+	Tags          []LinkedItem `json:"Tags" baserow:"Tags,table=Tag"`
 }
 
-func (b *BaserowPurchaseItemGroupTable) UnmarshalJSON(data io.ReadCloser) (interface{}, error) {
-	var out BaserowQueryResponse[*BaserowPurchaseItemGroupTable]
-	if err := json.NewDecoder(data).Decode(&out); err != nil {
-		return nil, fmt.Errorf("error decoding JSON: %v", err)
-	}
-
-	return out, nil
-}
-
-func (b BaserowPurchaseItemGroupTable) GetTableID() string {
-	return BaserowPurchaseItemGroupTableID
+func (b BaserowPurchaseItemGroupTable) GetTableName() string {
+	return BaserowPurchaseItemGroupTableName
 }
 
 func (b BaserowPurchaseItemGroupTable) DeleteRowsAllowed() bool {
@@ -259,21 +327,12 @@ func (b BaserowPurchaseItemGroupTable) GetRowID() string {
 type BaserowPurchaseItemGroupTableInsert struct {
 	ID            int      `json:"id"`
 	Name          string   `json:"Name"`
-	PurchaseItems []string `json:"Purchase Items"`
-	Tags          []string `json:"Tags"`
-}
-
-func (b *BaserowPurchaseItemGroupTableInsert) UnmarshalJSON(data io.ReadCloser) (interface{}, error) {
-	var out BaserowQueryResponse[*BaserowPurchaseItemGroupTableInsert]
-	if err := json.NewDecoder(data).Decode(&out); err != nil {
-		return nil, fmt.Errorf("error decoding JSON: %v", err)
-	}
-
-	return out, nil
+	PurchaseItems []string `json:"Purchase Items" baserow:"Purchase Items,link,table=PurchaseItem"`
+	Tags          []string `json:"Tags" baserow:"Tags,link,table=Tag"`
 }
 
-func (b BaserowPurchaseItemGroupTableInsert) GetTableID() string {
-	return BaserowPurchaseItemGroupTableID
+func (b BaserowPurchaseItemGroupTableInsert) GetTableName() string {
+	return BaserowPurchaseItemGroupTableName
 }
 
 func (b BaserowPurchaseItemGroupTableInsert) DeleteRowsAllowed() bool {
@@ -289,113 +348,23 @@ func (b BaserowPurchaseItemGroupTableInsert) GetRowID() string {
 }
 
 type BaserowPurchaseEventTable struct {
-	ID                int      `json:"id"`
-	BankTxID          string   `json:"Bank Tx ID"`
-	Date              string   `json:"Date"`
-	Tax               float64  `json:"Tax"`
-	Total             float64  `json:"Total"`
-	TotalUnits        float64  `json:"Total Units"`
-	TotalCases        float64  `json:"Total Cases"`
-	Vendor            []string `json:"Vendor"`
-	Note              string   `json:"Note"`
-	PendingPurchaseID *int     `json:"PendingPurchase,omitempty"`
-}
-
-func (b *BaserowPurchaseEventTable) UnmarshalJSON(data io.ReadCloser) (interface{}, error) {
-	type raw struct {
-		ID              int          `json:"id"`
-		BankTxID        string       `json:"Bank Tx ID"`
-		Date            string       `json:"Date"`
-		Tax             *string      `json:"Tax"`
-		Total           *string      `json:"Total"`
-		TotalUnits      *string      `json:"Total Units"`
-		TotalCases      *string      `json:"Total Cases"`
-		Vendor          []LinkedItem `json:"Vendor"`
-		Note            *string      `json:"Note"`
-		PendingPurchase []LinkedItem `json:"PendingPurchase"`
-	}
-
-	var r BaserowQueryResponse[raw]
-	if err := json.NewDecoder(data).Decode(&r); err != nil {
-		return nil, fmt.Errorf("error decoding JSON: %v", err)
-	}
-
-	out := BaserowQueryResponse[*BaserowPurchaseEventTable]{
-		Count:    r.Count,
-		Next:     r.Next,
-		Previous: r.Previous,
-	}
-
-	for _, r := range r.Results {
-		var err error
-		tax := 0.0
-		if r.Tax != nil {
-			tax, err = strconv.ParseFloat(*r.Tax, 64)
-			if err != nil {
-				return nil, fmt.Errorf("error parsing Tax: %v", err)
-			}
-		}
-
-		total := 0.0
-		if r.Total != nil {
-			total, err = strconv.ParseFloat(*r.Total, 64)
-			if err != nil {
-				return nil, fmt.Errorf("error parsing Total: %v", err)
-			}
-		}
-
-		totalUnits := 0.0
-		if r.TotalUnits != nil {
-			totalUnits, err = strconv.ParseFloat(*r.TotalUnits, 64)
-			if err != nil {
-				return nil, fmt.Errorf("error parsing Total Units: %v", err)
-			}
-		}
-
-		totalCases := 0.0
-		if r.TotalCases != nil {
-			totalCases, err = strconv.ParseFloat(*r.TotalCases, 64)
-			if err != nil {
-				return nil, fmt.Errorf("error parsing Total Cases: %v", err)
-			}
-		}
-
-		var vendor []string
-		for _, v := range r.Vendor {
-			vendor = append(vendor, v.Value)
-		}
-
-		note := ""
-		if r.Note != nil {
-			note = *r.Note
-		}
-
-		var pendingPurchaseID *int
-		if len(r.PendingPurchase) == 1 {
-			pendingPurchaseID = &r.PendingPurchase[0].ID
-		} else if len(r.PendingPurchase) > 1 {
-			return nil, fmt.Errorf("unexpected number of linked pending purchases. Found %d, expected 0 or 1", len(r.PendingPurchase))
-		}
-
-		out.Results = append(out.Results, &BaserowPurchaseEventTable{
-			ID:                r.ID,
-			BankTxID:          r.BankTxID,
-			Date:              r.Date,
-			Note:              note,
-			Vendor:            vendor,
-			Tax:               tax,
-			Total:             total,
-			TotalUnits:        totalUnits,
-			TotalCases:        totalCases,
-			PendingPurchaseID: pendingPurchaseID,
-		})
-	}
-
-	return out, nil
+	ID                int        `json:"id"`
+	BankTxID          string     `json:"Bank Tx ID"`
+	Date              string     `json:"Date" baserow:"Date,type=date"`
+	Tax               float64    `json:"Tax" baserow:"Tax,decimal"`
+	Total             float64    `json:"Total" baserow:"Total,decimal"`
+	TotalUnits        float64    `json:"Total Units" baserow:"Total Units,decimal,decimals=0"`
+	TotalCases        float64    `json:"Total Cases" baserow:"Total Cases,decimal,decimals=0"`
+	Vendor            []string   `json:"Vendor" baserow:"Vendor,link,table=Vendor"`
+	Note              string     `json:"Note" baserow:"Note,type=long_text"`
+	ReceiptURLs       string     `json:"Receipt URLs" baserow:"Receipt URLs,type=long_text"`
+	ParseAttempts     string     `json:"Parse Attempts" baserow:"Parse Attempts,type=long_text"`
+	PromptVersion     string     `json:"Prompt Version"`
+	PendingPurchaseID *LinkRowID `json:"PendingPurchase,omitempty" baserow:"PendingPurchase,link_id,table=PendingPurchases,related=PurchaseEvent"`
 }
 
-func (b BaserowPurchaseEventTable) GetTableID() string {
-	return BaserowPurchaseEventTableID
+func (b BaserowPurchaseEventTable) GetTableName() string {
+	return BaserowPurchaseEventTableName
 }
 
 func (b BaserowPurchaseEventTable) DeleteRowsAllowed() bool {
@@ -411,176 +380,31 @@ func (b BaserowPurchaseEventTable) GetRowID() string {
 }
 
 type BaserowPendingPurchase struct {
-	ID              int     `json:"id"`
-	BankTxID        string  `json:"Bank Tx ID"`
-	ReceiptURL      string  `json:"Receipt URL"`
-	Vendor          string  `json:"Vendor"`
-	Date            *string `json:"Date"`
-	ItemName        string  `json:"Item: Name"`
-	ItemQuantity    int     `json:"Item: Quantity"`
-	ItemIsCase      bool    `json:"Item: Is Case"`
-	ItemPrice       float64 `json:"Item: Price"`
-	Note            string  `json:"Note"`
-	Tax             float64 `json:"Tax"`
-	Total           float64 `json:"Total"`
-	TotalUnits      int     `json:"Total Units"`
-	TotalCases      int     `json:"Total Cases"`
-	Reason          string  `json:"Reason"`
-	BankTotal       float64 `json:"Bank Total"`
-	PurchaseID      *int    `json:"PurchaseID"`
-	PurchaseEventID *int    `json:"PurchaseEventID"`
-}
-
-func (b *BaserowPendingPurchase) UnmarshalJSON(data io.ReadCloser) (interface{}, error) {
-	type raw struct {
-		ID            int          `json:"id"`
-		BankTxID      string       `json:"Bank Tx ID"`
-		Vendor        string       `json:"Vendor"`
-		Date          *string      `json:"Date"`
-		ItemName      *string      `json:"Item: Name"`
-		ItemQuantity  *string      `json:"Item: Quantity"`
-		ItemIsCase    bool         `json:"Item: Is Case"`
-		ItemPrice     *string      `json:"Item: Price"`
-		Note          *string      `json:"Note"`
-		Tax           *string      `json:"Tax"`
-		Total         *string      `json:"Total"`
-		TotalUnits    *string      `json:"Total Units"`
-		TotalCases    *string      `json:"Total Cases"`
-		Reason        *string      `json:"Reason"`
-		BankTotal     *string      `json:"Bank Total"`
-		Purchase      []LinkedItem `json:"Purchase"`
-		PurchaseEvent []LinkedItem `json:"PurchaseEvent"`
-	}
-
-	var r BaserowQueryResponse[raw]
-	if err := json.NewDecoder(data).Decode(&r); err != nil {
-		return nil, fmt.Errorf("error decoding JSON: %v", err)
-	}
-
-	out := BaserowQueryResponse[*BaserowPendingPurchase]{
-		Count:    r.Count,
-		Next:     r.Next,
-		Previous: r.Previous,
-	}
-
-	for _, r := range r.Results {
-		var err error
-		tax := 0.0
-		if r.Tax != nil {
-			tax, err = strconv.ParseFloat(*r.Tax, 64)
-			if err != nil {
-				return nil, fmt.Errorf("error parsing Tax: %v", err)
-			}
-		}
-
-		total := 0.0
-		if r.Total != nil {
-			total, err = strconv.ParseFloat(*r.Total, 64)
-			if err != nil {
-				return nil, fmt.Errorf("error parsing Total: %v", err)
-			}
-		}
-
-		totalUnits := 0
-		if r.TotalUnits != nil {
-			tu, err := strconv.ParseFloat(*r.TotalUnits, 64)
-			if err != nil {
-				return nil, fmt.Errorf("error parsing Total Units: %v", err)
-			}
-			totalUnits = int(tu)
-		}
-
-		totalCases := 0
-		if r.TotalCases != nil {
-			tc, err := strconv.ParseFloat(*r.TotalCases, 64)
-			if err != nil {
-				return nil, fmt.Errorf("error parsing Total Cases: %v", err)
-			}
-			totalCases = int(tc)
-		}
-
-		bankTotal := 0.0
-		if r.BankTotal != nil {
-			bankTotal, err = strconv.ParseFloat(*r.BankTotal, 64)
-			if err != nil {
-				return nil, fmt.Errorf("error parsing Bank Total: %v", err)
-			}
-		}
-
-		note := ""
-		if r.Note != nil {
-			note = *r.Note
-		}
-
-		itemName := ""
-		if r.ItemName != nil {
-			itemName = *r.ItemName
-		}
-
-		itemQuantity := 0
-		if r.ItemQuantity != nil {
-			iq, err := strconv.ParseFloat(*r.ItemQuantity, 64)
-			if err != nil {
-				return nil, fmt.Errorf("error parsing Item Quantity: %v", err)
-			}
-			itemQuantity = int(iq)
-		}
-
-		itemPrice := 0.0
-		if r.ItemPrice != nil {
-			itemPrice, err = strconv.ParseFloat(*r.ItemPrice, 64)
-			if err != nil {
-				return nil, fmt.Errorf("error parsing Item Price: %v", err)
-			}
-		}
-
-		reason := ""
-		if r.Reason != nil {
-			reason = *r.Reason
-		}
-
-		var purchaseID *int
-		if len(r.Purchase) == 1 {
-			purchaseID = &r.Purchase[0].ID
-		} else if len(r.Purchase) > 1 {
-			return nil, fmt.Errorf("unexpected number of linked purchases. Found %d, expected 0 or 1", len(r.Purchase))
-		}
-
-		var purchaseEventID *int
-		if len(r.PurchaseEvent) == 1 {
-			purchaseEventID = &r.PurchaseEvent[0].ID
-		} else if len(r.PurchaseEvent) > 1 {
-			return nil, fmt.Errorf("unexpected number of linked purchase events. Found %d, expected 0 or 1", len(r.PurchaseEvent))
-		}
-
-		pp := &BaserowPendingPurchase{
-			ID:              r.ID,
-			BankTxID:        r.BankTxID,
-			Date:            r.Date,
-			Note:            note,
-			Vendor:          r.Vendor,
-			ItemName:        itemName,
-			ItemQuantity:    itemQuantity,
-			ItemIsCase:      r.ItemIsCase,
-			ItemPrice:       itemPrice,
-			Tax:             tax,
-			Total:           total,
-			TotalUnits:      totalUnits,
-			TotalCases:      totalCases,
-			Reason:          reason,
-			BankTotal:       bankTotal,
-			PurchaseID:      purchaseID,
-			PurchaseEventID: purchaseEventID,
-		}
-
-		out.Results = append(out.Results, pp)
-	}
-
-	return out, nil
-}
-
-func (b BaserowPendingPurchase) GetTableID() string {
-	return BaserowPendingPurchasesTableID
+	ID              int        `json:"id"`
+	BankTxID        string     `json:"Bank Tx ID"`
+	ReceiptURL      string     `json:"Receipt URL" baserow:"Receipt URL,type=url"`
+	ReceiptURLs     string     `json:"Receipt URLs" baserow:"Receipt URLs,type=long_text"`
+	Vendor          string     `json:"Vendor"`
+	Date            *string    `json:"Date" baserow:"Date,type=date"`
+	ItemName        string     `json:"Item: Name"`
+	ItemQuantity    int        `json:"Item: Quantity" baserow:"Item: Quantity,decimal"`
+	ItemIsCase      bool       `json:"Item: Is Case"`
+	ItemPrice       float64    `json:"Item: Price" baserow:"Item: Price,decimal"`
+	Note            string     `json:"Note" baserow:"Note,type=long_text"`
+	Tax             float64    `json:"Tax" baserow:"Tax,decimal"`
+	Total           float64    `json:"Total" baserow:"Total,decimal"`
+	TotalUnits      int        `json:"Total Units" baserow:"Total Units,decimal"`
+	TotalCases      int        `json:"Total Cases" baserow:"Total Cases,decimal"`
+	Reason          string     `json:"Reason" baserow:"Reason,type=long_text"`
+	ParseAttempts   string     `json:"Parse Attempts" baserow:"Parse Attempts,type=long_text"`
+	PromptVersion   string     `json:"Prompt Version"`
+	BankTotal       float64    `json:"Bank Total" baserow:"Bank Total,decimal"`
+	PurchaseID      *LinkRowID `json:"Purchase,omitempty" baserow:"Purchase,link_id,table=Purchase,related=PendingPurchases"`
+	PurchaseEventID *LinkRowID `json:"PurchaseEvent,omitempty" baserow:"PurchaseEvent,link_id,table=PurchaseEvent,related=PendingPurchase"`
+}
+
+func (b BaserowPendingPurchase) GetTableName() string {
+	return BaserowPendingPurchasesTableName
 }
 
 func (b BaserowPendingPurchase) DeleteRowsAllowed() bool {
@@ -601,17 +425,8 @@ type BaserowVendorTable struct {
 	Addrsess string `json:"Address"`
 }
 
-func (b *BaserowVendorTable) UnmarshalJSON(data io.ReadCloser) (interface{}, error) {
-	var out BaserowQueryResponse[*BaserowVendorTable]
-	if err := json.NewDecoder(data).Decode(&out); err != nil {
-		return nil, fmt.Errorf("error decoding JSON: %v", err)
-	}
-
-	return out, nil
-}
-
-func (b BaserowVendorTable) GetTableID() string {
-	return BaserowVendorTableID
+func (b BaserowVendorTable) GetTableName() string {
+	return BaserowVendorTableName
 }
 
 func (b BaserowVendorTable) DeleteRowsAllowed() bool {
@@ -626,92 +441,28 @@ func (b BaserowVendorTable) GetRowID() string {
 	return fmt.Sprintf("%d", b.ID)
 }
 
+// BaserowData is implemented by every table type. Rows are decoded from
+// Baserow's JSON according to the fields' `baserow` struct tags; see decode.go.
 type BaserowData interface {
-	GetTableID() string
+	GetTableName() string
 	DeleteRowsAllowed() bool
 	GetPrimaryKey() string
 	GetRowID() string
-	UnmarshalJSON(data io.ReadCloser) (interface{}, error) // interface{} BaserowQueryResponse[T]
 }
 
 type BaserowPurchaseTable struct {
 	ID                 int      `json:"id"`
 	Name               string   `json:"Name"`
-	Quantity           int      `json:"Quantity"`
+	Quantity           int      `json:"Quantity" baserow:"Quantity,decimal"`
 	IsCase             bool     `json:"Is Case"`
-	Price              float64  `json:"Price"`
-	PurchaseItem       []string `json:"PurchaseItem"`
-	PurchaseEvent      []string `json:"PurchaseEvent"`
-	PendingPurchaseIDs []int    `json:"PendingPurchases,omitempty"`
-}
-
-func (b *BaserowPurchaseTable) UnmarshalJSON(data io.ReadCloser) (interface{}, error) {
-	// Alias struct with string fields
-	type raw struct {
-		ID               int          `json:"id"`
-		Name             string       `json:"Name"`
-		Quantity         string       `json:"Quantity"`
-		IsCase           bool         `json:"Is Case"`
-		Price            string       `json:"Price"`
-		PurchaseItem     []LinkedItem `json:"PurchaseItem"`
-		PurchaseEvent    []LinkedItem `json:"PurchaseEvent"`
-		PendingPurchases []LinkedItem `json:"PendingPurchases"`
-	}
-
-	var r BaserowQueryResponse[raw]
-	if err := json.NewDecoder(data).Decode(&r); err != nil {
-		return BaserowQueryResponse[interface{}]{}, fmt.Errorf("error decoding JSON: %v", err)
-	}
-
-	out := BaserowQueryResponse[*BaserowPurchaseTable]{
-		Count:    r.Count,
-		Next:     r.Next,
-		Previous: r.Previous,
-	}
-
-	for _, r := range r.Results {
-		qty, err := strconv.Atoi(r.Quantity)
-		if err != nil && r.Quantity != "" {
-			return nil, fmt.Errorf("error parsing Quantity: %v", err)
-		}
-
-		price, err := strconv.ParseFloat(r.Price, 64)
-		if err != nil && r.Price != "" {
-			return nil, fmt.Errorf("error parsing Price: %v", err)
-		}
-
-		var purchaseItemIDs []string
-		for _, pi := range r.PurchaseItem {
-			purchaseItemIDs = append(purchaseItemIDs, pi.Value)
-		}
-
-		var purchaseEventIDs []string
-		for _, pe := range r.PurchaseEvent {
-			purchaseEventIDs = append(purchaseEventIDs, pe.Value)
-		}
-
-		var pendingPurchaseIDs []int
-		for _, pp := range r.PendingPurchases {
-			pendingPurchaseIDs = append(pendingPurchaseIDs, pp.ID)
-		}
-
-		out.Results = append(out.Results, &BaserowPurchaseTable{
-			ID:                 r.ID,
-			Name:               r.Name,
-			Quantity:           qty,
-			IsCase:             r.IsCase,
-			Price:              price,
-			PurchaseItem:       purchaseItemIDs,
-			PurchaseEvent:      purchaseEventIDs,
-			PendingPurchaseIDs: pendingPurchaseIDs,
-		})
-	}
-
-	return out, nil
+	Price              float64  `json:"Price" baserow:"Price,decimal"`
+	PurchaseItem       []string `json:"PurchaseItem" baserow:"PurchaseItem,link,table=PurchaseItem"`
+	PurchaseEvent      []string `json:"PurchaseEvent" baserow:"PurchaseEvent,link,table=PurchaseEvent"`
+	PendingPurchaseIDs []int    `json:"PendingPurchases,omitempty" baserow:"PendingPurchases,link_id,table=PendingPurchases,related=Purchase"`
 }
 
-func (b BaserowPurchaseTable) GetTableID() string {
-	return BaserowPurchaseTableID
+func (b BaserowPurchaseTable) GetTableName() string {
+	return BaserowPurchaseTableName
 }
 
 func (b BaserowPurchaseTable) DeleteRowsAllowed() bool {
@@ -726,6 +477,36 @@ func (b BaserowPurchaseTable) GetRowID() string {
 	return fmt.Sprintf("%d", b.ID)
 }
 
+// BaserowAIUsage records the tokens and estimated cost of one model call made
+// to parse a receipt. Month ("2006-01") makes the monthly spend easy to filter.
+type BaserowAIUsage struct {
+	ID            int     `json:"id"`
+	BankTxID      string  `json:"Bank Tx ID"`
+	Date          string  `json:"Date" baserow:"Date,type=date"`
+	Month         string  `json:"Month"`
+	Parser        string  `json:"Parser"`
+	PromptVersion string  `json:"Prompt Version"`
+	InputTokens   int     `json:"Input Tokens" baserow:"Input Tokens,decimal"`
+	OutputTokens  int     `json:"Output Tokens" baserow:"Output Tokens,decimal"`
+	Cost          float64 `json:"Cost" baserow:"Cost,decimal,decimals=6"`
+}
+
+func (b BaserowAIUsage) GetTableName() string {
+	return BaserowAIUsageTableName
+}
+
+func (b BaserowAIUsage) DeleteRowsAllowed() bool {
+	return false
+}
+
+func (b BaserowAIUsage) GetPrimaryKey() string {
+	return b.BankTxID
+}
+
+func (b BaserowAIUsage) GetRowID() string {
+	return fmt.Sprintf("%d", b.ID)
+}
+
 func NewBaserowPurchaseTable(item ReceiptItem, purchaseItemID string, purchaseEventID string) *BaserowPurchaseTable {
 	out := &BaserowPurchaseTable{
 		Name:          cases.Title(language.English).String(item.Name),
@@ -751,9 +532,10 @@ type BaserowQueryResponse[T any] struct {
 }
 
 func NewPurchaseEvent(req CreateBaserowPurchaseRequest) *BaserowPurchaseEventTable {
-	var pendingPurchaseID *int
+	var pendingPurchaseID *LinkRowID
 	if req.PendingPurchase != nil {
-		pendingPurchaseID = &req.PendingPurchase.ID
+		id := LinkRowID(req.PendingPurchase.ID)
+		pendingPurchaseID = &id
 	}
 
 	return &BaserowPurchaseEventTable{
@@ -765,6 +547,9 @@ func NewPurchaseEvent(req CreateBaserowPurchaseRequest) *BaserowPurchaseEventTab
 		TotalCases:        float64(req.ReceiptSummary.TotalCases),
 		Vendor:            []string{req.ReceiptSummary.Vendor},
 		Note:              req.BankTransaction.Note,
+		ReceiptURLs:       JoinReceiptURLs(req.BankTransaction.AttachmentURLs()),
+		ParseAttempts:     req.ParseAttempts,
+		PromptVersion:     req.PromptVersion,
 		PendingPurchaseID: pendingPurchaseID,
 	}
 }
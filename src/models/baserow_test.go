@@ -0,0 +1,301 @@
+package models_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/jiaming2012/receipt-bot/src/fakes"
+	"github.com/jiaming2012/receipt-bot/src/models"
+)
+
+func TestListRowsFollowsPagination(t *testing.T) {
+	fake := fakes.NewBaserow(t)
+
+	var rows []map[string]interface{}
+	for i := 0; i < 450; i++ {
+		rows = append(rows, map[string]interface{}{"Description": fmt.Sprintf("item %d", i)})
+	}
+	fake.Seed(models.BaserowPurchaseItemTableName, rows...)
+
+	items, err := models.ListRows[*models.BaserowPurchaseItemTable](context.Background(), fake.Client())
+	if err != nil {
+		t.Fatalf("ListRows: %v", err)
+	}
+
+	if len(items) != 450 {
+		t.Fatalf("expected 450 rows, got %d", len(items))
+	}
+
+	if items[449].Description != "item 449" {
+		t.Errorf("expected last row to be item 449, got %q", items[449].Description)
+	}
+
+	if got := len(fake.Requests()); got != 3 {
+		t.Errorf("expected 3 page requests, got %d", got)
+	}
+}
+
+func TestListRowsFilters(t *testing.T) {
+	fake := fakes.NewBaserow(t)
+	fake.Seed(models.BaserowPendingPurchasesTableName,
+		map[string]interface{}{"Bank Tx ID": "tx-1", "Reason": "missing receipt"},
+		map[string]interface{}{"Bank Tx ID": "tx-2"},
+	)
+
+	rows, err := models.ListRows[*models.BaserowPendingPurchase](context.Background(), fake.Client(),
+		models.WithFilter("Reason", "not_empty", ""),
+	)
+	if err != nil {
+		t.Fatalf("ListRows: %v", err)
+	}
+
+	if len(rows) != 1 || rows[0].BankTxID != "tx-1" {
+		t.Fatalf("expected only tx-1, got %+v", rows)
+	}
+}
+
+func TestCreateRowDecodesDecimalsAndLinks(t *testing.T) {
+	fake := fakes.NewBaserow(t)
+	fake.Seed(models.BaserowVendorTableName, map[string]interface{}{"Name": "Restaurant Depot"})
+
+	client := fake.Client()
+	event := &models.BaserowPurchaseEventTable{
+		BankTxID: "tx-1",
+		Date:     "2024-05-01",
+		Tax:      1.5,
+		Total:    101.499,
+		Vendor:   []string{"Restaurant Depot"},
+	}
+	if err := client.CreateRow(context.Background(), event); err != nil {
+		t.Fatalf("CreateRow: %v", err)
+	}
+
+	if event.ID == 0 {
+		t.Errorf("expected the created row ID to be set")
+	}
+
+	// Baserow rounds to the field's decimal places
+	if event.Total != 101.5 {
+		t.Errorf("expected total 101.5, got %v", event.Total)
+	}
+
+	if len(event.Vendor) != 1 || event.Vendor[0] != "Restaurant Depot" {
+		t.Errorf("expected vendor link to Restaurant Depot, got %v", event.Vendor)
+	}
+}
+
+func TestUpdateRowRejectsUnknownFields(t *testing.T) {
+	fake := fakes.NewBaserow(t)
+	ids := fake.Seed(models.BaserowPendingPurchasesTableName, map[string]interface{}{"Bank Tx ID": "tx-1"})
+
+	row := &models.BaserowPendingPurchase{ID: ids[0]}
+	err := fake.Client().UpdateRow(context.Background(), row, models.BaserowFields{"Reasn": "typo"})
+	if !errors.Is(err, models.ErrUnknownField) {
+		t.Fatalf("expected ErrUnknownField, got %v", err)
+	}
+
+	if len(fake.Requests()) != 0 {
+		t.Errorf("expected no requests, got %v", fake.Requests())
+	}
+
+	if err := fake.Client().UpdateRow(context.Background(), row, models.BaserowFields{"Reason": "no receipt"}); err != nil {
+		t.Fatalf("UpdateRow: %v", err)
+	}
+
+	if row.Reason != "no receipt" || row.BankTxID != "tx-1" {
+		t.Errorf("expected row to be refreshed from the response, got %+v", row)
+	}
+}
+
+func TestCreateRowWritesPendingPurchaseLinks(t *testing.T) {
+	fake := fakes.NewBaserow(t)
+	ids := fake.Seed(models.BaserowPurchaseEventTableName, map[string]interface{}{"Bank Tx ID": "tx-1"})
+
+	eventID := models.LinkRowID(ids[0])
+	row := &models.BaserowPendingPurchase{BankTxID: "tx-1", PurchaseEventID: &eventID}
+
+	// Baserow only accepts links as a list of IDs
+	body, err := json.Marshal(row)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := fmt.Sprintf(`"PurchaseEvent":[%d]`, ids[0]); !strings.Contains(string(body), want) {
+		t.Errorf("expected %s in the request body, got %s", want, body)
+	}
+
+	if err := fake.Client().CreateRow(context.Background(), row); err != nil {
+		t.Fatalf("CreateRow: %v", err)
+	}
+
+	// Baserow ignores fields it doesn't know, so check what was stored
+	rows := fake.Rows(models.BaserowPendingPurchasesTableName)
+	if len(rows) != 1 || fmt.Sprint(rows[0]["PurchaseEvent"]) == "[]" {
+		t.Fatalf("expected the pending purchase to link to purchase event %d, got %v", ids[0], rows)
+	}
+}
+
+// reviewNote reads the Reason field of the PendingPurchases table under
+// another json name.
+type reviewNote struct {
+	ID   int    `json:"id"`
+	Note string `json:"note" baserow:"Reason"`
+}
+
+func (r reviewNote) GetTableName() string    { return models.BaserowPendingPurchasesTableName }
+func (r reviewNote) DeleteRowsAllowed() bool { return false }
+func (r reviewNote) GetPrimaryKey() string   { return "" }
+func (r reviewNote) GetRowID() string        { return fmt.Sprintf("%d", r.ID) }
+
+func TestUpdateRowValidatesBaserowFieldNames(t *testing.T) {
+	fake := fakes.NewBaserow(t)
+	ids := fake.Seed(models.BaserowPendingPurchasesTableName, map[string]interface{}{"Bank Tx ID": "tx-1"})
+
+	// the json name is not a Baserow field and would be dropped by Baserow
+	row := &reviewNote{ID: ids[0]}
+	err := fake.Client().UpdateRow(context.Background(), row, models.BaserowFields{"note": "typo"})
+	if !errors.Is(err, models.ErrUnknownField) {
+		t.Fatalf("expected ErrUnknownField, got %v", err)
+	}
+
+	if err := fake.Client().UpdateRow(context.Background(), row, models.BaserowFields{"Reason": "no receipt"}); err != nil {
+		t.Fatalf("UpdateRow: %v", err)
+	}
+
+	if row.Note != "no receipt" {
+		t.Errorf("expected the Reason field to be decoded into Note, got %+v", row)
+	}
+}
+
+func TestCreateRowsIsolatesInvalidRows(t *testing.T) {
+	fake := fakes.NewBaserow(t)
+	fake.Seed(models.BaserowPurchaseItemTableName, map[string]interface{}{"Description": "BRISKET"})
+
+	rows := []models.BaserowData{
+		&models.BaserowPurchaseItemGroupTableInsert{Name: "Brisket", PurchaseItems: []string{"BRISKET"}},
+		&models.BaserowPurchaseItemGroupTableInsert{Name: "Corn", PurchaseItems: []string{"CORN"}},
+		&models.BaserowPurchaseItemGroupTableInsert{Name: "Empty"},
+	}
+
+	err := fake.Client().CreateRows(context.Background(), rows)
+
+	var batchErr *models.BatchError
+	if !errors.As(err, &batchErr) {
+		t.Fatalf("expected a BatchError, got %v", err)
+	}
+
+	if len(batchErr.Failures) != 1 || batchErr.Failures[0].Index != 1 {
+		t.Fatalf("expected only row 1 to fail, got %v", batchErr)
+	}
+
+	if !errors.Is(err, models.ErrValidation) {
+		t.Errorf("expected the failure to be a validation error, got %v", err)
+	}
+
+	if got := len(fake.Rows(models.BaserowPurchaseItemGroupTableName)); got != 2 {
+		t.Errorf("expected the 2 valid rows to be created, got %d", got)
+	}
+}
+
+func TestDeleteRowsReportsMissingRows(t *testing.T) {
+	fake := fakes.NewBaserow(t)
+	ids := fake.Seed(models.BaserowPendingPurchasesTableName,
+		map[string]interface{}{"Bank Tx ID": "tx-1"},
+		map[string]interface{}{"Bank Tx ID": "tx-2"},
+	)
+
+	rows := []models.BaserowData{
+		&models.BaserowPendingPurchase{ID: ids[0]},
+		&models.BaserowPendingPurchase{ID: 999},
+		&models.BaserowPendingPurchase{ID: ids[1]},
+	}
+
+	err := fake.Client().DeleteRows(context.Background(), rows)
+
+	var batchErr *models.BatchError
+	if !errors.As(err, &batchErr) || len(batchErr.Failures) != 1 || !errors.Is(batchErr.Failures[0].Err, models.ErrNotFound) {
+		t.Fatalf("expected row 999 to be reported as not found, got %v", err)
+	}
+
+	if got := len(fake.Rows(models.BaserowPendingPurchasesTableName)); got != 0 {
+		t.Errorf("expected both existing rows to be deleted, got %d left", got)
+	}
+}
+
+func TestDeleteRowsChecksEveryRow(t *testing.T) {
+	fake := fakes.NewBaserow(t)
+	ids := fake.Seed(models.BaserowPendingPurchasesTableName,
+		map[string]interface{}{"Bank Tx ID": "tx-1"},
+		map[string]interface{}{"Bank Tx ID": "tx-2"},
+	)
+
+	// both types are rows of PendingPurchases, but reviewNote may not delete
+	rows := []models.BaserowData{
+		&models.BaserowPendingPurchase{ID: ids[0]},
+		&reviewNote{ID: ids[1]},
+	}
+
+	if err := fake.Client().DeleteRows(context.Background(), rows); err == nil {
+		t.Fatal("expected an error")
+	}
+
+	if got := len(fake.Rows(models.BaserowPendingPurchasesTableName)); got != 2 {
+		t.Errorf("expected no rows to be deleted, got %d left", got)
+	}
+}
+
+func TestRetriesServiceUnavailable(t *testing.T) {
+	fake := fakes.NewBaserow(t)
+	fake.FailNext(http.StatusServiceUnavailable, http.StatusTooManyRequests)
+
+	if err := fake.Client().CreateRow(context.Background(), &models.BaserowTagTable{TagName: "Produce"}); err != nil {
+		t.Fatalf("CreateRow: %v", err)
+	}
+
+	if got := len(fake.Rows(models.BaserowTagTableName)); got != 1 {
+		t.Errorf("expected exactly one tag after retries, got %d", got)
+	}
+
+	fake.FailNext(http.StatusServiceUnavailable, http.StatusServiceUnavailable, http.StatusServiceUnavailable)
+
+	_, err := models.ListRows[*models.BaserowTagTable](context.Background(), fake.Client())
+
+	var apiErr *models.BaserowAPIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("expected a 503 once retries are exhausted, got %v", err)
+	}
+}
+
+func TestPendingPurchasesKeepEveryReceiptImage(t *testing.T) {
+	tx := &models.MercuryTransaction{
+		ID:        "tx-1",
+		Amount:    -20,
+		CreatedAt: "2024-05-01T15:04:05Z",
+		Attachments: []*models.MercuryTransactionAttachment{
+			{URL: "https://example.com/top.jpg"},
+			{URL: "https://example.com/bottom.jpg"},
+		},
+	}
+
+	summary := models.ReceiptSummary{Vendor: "Restaurant Depot", Total: 20, TotalUnits: 1}
+	items := []models.ReceiptItem{{Name: "Corn", Quantity: 1, Price: 20}}
+
+	pendingPurchases, err := models.NewBaserowPendingPurchases(summary, items, tx, errors.New("needs review"))
+	if err != nil {
+		t.Fatalf("NewBaserowPendingPurchases: %v", err)
+	}
+
+	req, err := models.NewCreateBaserowPurchaseRequestFromPendingPurchases(pendingPurchases)
+	if err != nil {
+		t.Fatalf("NewCreateBaserowPurchaseRequestFromPendingPurchases: %v", err)
+	}
+
+	event := models.NewPurchaseEvent(req)
+	if want := "https://example.com/top.jpg\nhttps://example.com/bottom.jpg"; event.ReceiptURLs != want {
+		t.Errorf("expected the purchase event to keep both receipt URLs, got %q", event.ReceiptURLs)
+	}
+}
@@ -0,0 +1,232 @@
+package models
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// BaserowMaxBatchSize is the maximum number of rows Baserow accepts in a
+// single batch request.
+const BaserowMaxBatchSize = 200
+
+type RowError struct {
+	Index int // position of the row in the slice passed to the batch call
+	Row   BaserowData
+	Err   error
+}
+
+func (e RowError) Error() string {
+	return fmt.Sprintf("row %d: %v", e.Index, e.Err)
+}
+
+func (e RowError) Unwrap() error {
+	return e.Err
+}
+
+// BatchError reports the rows of a batch call that could not be written.
+// Rows not listed in Failures were written successfully.
+type BatchError struct {
+	Op       string
+	Total    int
+	Failures []RowError
+}
+
+func (e *BatchError) Error() string {
+	msgs := make([]string, 0, len(e.Failures))
+	for _, f := range e.Failures {
+		msgs = append(msgs, f.Error())
+	}
+
+	return fmt.Sprintf("%s: %d of %d rows failed: %s", e.Op, len(e.Failures), e.Total, strings.Join(msgs, "; "))
+}
+
+func (e *BatchError) Unwrap() []error {
+	out := make([]error, 0, len(e.Failures))
+	for _, f := range e.Failures {
+		out = append(out, f.Err)
+	}
+	return out
+}
+
+type batchRequest struct {
+	Items interface{} `json:"items"`
+}
+
+type batchResponse struct {
+	Items []json.RawMessage `json:"items"`
+}
+
+// decodeBatchResponse populates each row of chunk with the corresponding row
+// returned by Baserow, which preserves request order.
+func decodeBatchResponse(chunk []BaserowData, body []byte) error {
+	var resp batchResponse
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return fmt.Errorf("error decoding JSON: %v", err)
+	}
+
+	if len(resp.Items) != len(chunk) {
+		return fmt.Errorf("expected %d rows in batch response, got %d", len(chunk), len(resp.Items))
+	}
+
+	for i, item := range resp.Items {
+		if err := decodeRow(chunk[i], item); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// CreateRows creates rows in chunks of BaserowMaxBatchSize and populates each
+// row, which must be a pointer, with the created row as CreateRow does.
+// Baserow rejects a whole chunk if any row in it is invalid, so rejected chunks
+// are retried row by row to isolate the failures, which are returned as a
+// *BatchError.
+func (c *BaserowClient) CreateRows(ctx context.Context, rows []BaserowData) error {
+	tableID, err := c.batchTableID(rows)
+	if err != nil {
+		return fmt.Errorf("CreateRows: %w", err)
+	}
+
+	url := fmt.Sprintf("%s/api/database/rows/table/%s/batch/?user_field_names=true", c.BaseURL, tableID)
+
+	return c.runBatch("CreateRows", rows, func(chunk []BaserowData) error {
+		rawData, err := json.Marshal(batchRequest{Items: chunk})
+		if err != nil {
+			return fmt.Errorf("Error marshalling data: %v", err)
+		}
+
+		body, err := c.do(ctx, http.MethodPost, url, rawData)
+		if err != nil {
+			return err
+		}
+
+		return decodeBatchResponse(chunk, body)
+	}, func(row BaserowData) error {
+		return c.CreateRow(ctx, row)
+	})
+}
+
+// UpdateRows overwrites rows, matched by ID, in chunks of BaserowMaxBatchSize.
+func (c *BaserowClient) UpdateRows(ctx context.Context, rows []BaserowData) error {
+	tableID, err := c.batchTableID(rows)
+	if err != nil {
+		return fmt.Errorf("UpdateRows: %w", err)
+	}
+
+	url := fmt.Sprintf("%s/api/database/rows/table/%s/batch/?user_field_names=true", c.BaseURL, tableID)
+
+	return c.runBatch("UpdateRows", rows, func(chunk []BaserowData) error {
+		rawData, err := json.Marshal(batchRequest{Items: chunk})
+		if err != nil {
+			return fmt.Errorf("Error marshalling data: %v", err)
+		}
+
+		body, err := c.do(ctx, http.MethodPatch, url, rawData)
+		if err != nil {
+			return err
+		}
+
+		return decodeBatchResponse(chunk, body)
+	}, func(row BaserowData) error {
+		rawData, err := json.Marshal(row)
+		if err != nil {
+			return fmt.Errorf("Error marshalling data: %v", err)
+		}
+
+		return c.patchRow(ctx, row, rawData)
+	})
+}
+
+// DeleteRows deletes rows in chunks of BaserowMaxBatchSize.
+func (c *BaserowClient) DeleteRows(ctx context.Context, rows []BaserowData) error {
+	tableID, err := c.batchTableID(rows)
+	if err != nil {
+		return fmt.Errorf("DeleteRows: %w", err)
+	}
+
+	// rows of different types may share a table, so each is checked
+	for _, row := range rows {
+		if !row.DeleteRowsAllowed() {
+			return fmt.Errorf("deleting rows is not allowed for table %s", row.GetTableName())
+		}
+	}
+
+	url := fmt.Sprintf("%s/api/database/rows/table/%s/batch-delete/", c.BaseURL, tableID)
+
+	return c.runBatch("DeleteRows", rows, func(chunk []BaserowData) error {
+		ids := make([]int, 0, len(chunk))
+		for _, row := range chunk {
+			id, err := strconv.Atoi(row.GetRowID())
+			if err != nil {
+				return fmt.Errorf("invalid row ID %q: %v", row.GetRowID(), err)
+			}
+			ids = append(ids, id)
+		}
+
+		rawData, err := json.Marshal(batchRequest{Items: ids})
+		if err != nil {
+			return fmt.Errorf("Error marshalling data: %v", err)
+		}
+
+		_, err = c.do(ctx, http.MethodPost, url, rawData)
+		return err
+	}, func(row BaserowData) error {
+		return c.DeleteRow(ctx, row)
+	})
+}
+
+func (c *BaserowClient) runBatch(op string, rows []BaserowData, sendChunk func([]BaserowData) error, sendRow func(BaserowData) error) error {
+	batchErr := &BatchError{Op: op, Total: len(rows)}
+
+	for start := 0; start < len(rows); start += BaserowMaxBatchSize {
+		end := min(start+BaserowMaxBatchSize, len(rows))
+		chunk := rows[start:end]
+
+		err := sendChunk(chunk)
+		if err == nil {
+			continue
+		}
+
+		// a single bad row fails the whole chunk; fall back to one request per
+		// row so the remaining rows are still written
+		if errors.Is(err, ErrValidation) || errors.Is(err, ErrNotFound) {
+			for i, row := range chunk {
+				if rowErr := sendRow(row); rowErr != nil {
+					batchErr.Failures = append(batchErr.Failures, RowError{Index: start + i, Row: row, Err: rowErr})
+				}
+			}
+			continue
+		}
+
+		for i, row := range chunk {
+			batchErr.Failures = append(batchErr.Failures, RowError{Index: start + i, Row: row, Err: err})
+		}
+	}
+
+	if len(batchErr.Failures) > 0 {
+		return batchErr
+	}
+
+	return nil
+}
+
+func (c *BaserowClient) batchTableID(rows []BaserowData) (string, error) {
+	if len(rows) == 0 {
+		return "", nil
+	}
+
+	tableName := rows[0].GetTableName()
+	for i, row := range rows[1:] {
+		if row.GetTableName() != tableName {
+			return "", fmt.Errorf("all rows must belong to the same table: row 0 is in table %s, row %d is in table %s", tableName, i+1, row.GetTableName())
+		}
+	}
+
+	return c.TableID(rows[0])
+}
@@ -0,0 +1,198 @@
+package models
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// Field kinds understood by the `baserow` struct tag. A tag has the form
+// `baserow:"<field name>[,<kind>][,<option>=<value>...]"`; fields without a tag
+// are read from their json tag name and decoded with encoding/json. Options
+// describe the field for provisioning: table=<linked table name>,
+// related=<field name of the link back from the linked table>,
+// type=<Baserow field type> and decimals=<number of decimal places>.
+const (
+	// decimal fields are returned by Baserow as strings ("12.50") and may be
+	// decoded into float or int fields, or pointers to them.
+	fieldKindDecimal = "decimal"
+	// link fields are link-row fields flattened to the linked rows' primary
+	// values ([]string).
+	fieldKindLink = "link"
+	// link_id fields are link-row fields flattened to the linked rows' IDs
+	// ([]int, or *LinkRowID when at most one row may be linked).
+	fieldKindLinkID = "link_id"
+)
+
+type fieldSpec struct {
+	Name    string
+	Kind    string
+	Options map[string]string
+	Index   int
+}
+
+// readFieldSpecs returns how each exported field of struct type t is read from
+// a Baserow row.
+func readFieldSpecs(t reflect.Type) []fieldSpec {
+	var specs []fieldSpec
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+
+		jsonName, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if jsonName == "-" {
+			continue
+		}
+
+		spec := fieldSpec{Name: jsonName, Options: map[string]string{}, Index: i}
+		if tag, ok := field.Tag.Lookup("baserow"); ok {
+			parts := strings.Split(tag, ",")
+			if parts[0] != "" {
+				spec.Name = parts[0]
+			}
+
+			for _, part := range parts[1:] {
+				if key, value, isOption := strings.Cut(part, "="); isOption {
+					spec.Options[key] = value
+				} else {
+					spec.Kind = part
+				}
+			}
+		}
+
+		if spec.Name == "" {
+			spec.Name = field.Name
+		}
+
+		specs = append(specs, spec)
+	}
+
+	return specs
+}
+
+// decodeRow decodes a single Baserow row into data, which must be a non-nil
+// pointer to a struct.
+func decodeRow(data BaserowData, raw []byte) error {
+	target := reflect.ValueOf(data)
+	if target.Kind() != reflect.Ptr || target.IsNil() || target.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("decodeRow: %T must be a non-nil pointer to a struct", data)
+	}
+
+	return decodeRowValue(raw, target.Elem())
+}
+
+func decodeRowValue(raw []byte, dst reflect.Value) error {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &fields); err != nil {
+		return fmt.Errorf("error decoding JSON: %v", err)
+	}
+
+	for _, spec := range readFieldSpecs(dst.Type()) {
+		value, ok := fields[spec.Name]
+		if !ok || isNull(value) {
+			continue
+		}
+
+		field := dst.Field(spec.Index)
+
+		var err error
+		switch spec.Kind {
+		case fieldKindDecimal:
+			err = decodeDecimal(value, field)
+		case fieldKindLink, fieldKindLinkID:
+			err = decodeLink(value, field, spec.Kind == fieldKindLinkID)
+		case "":
+			err = json.Unmarshal(value, field.Addr().Interface())
+		default:
+			err = fmt.Errorf("unknown baserow field kind %q", spec.Kind)
+		}
+
+		if err != nil {
+			return fmt.Errorf("error parsing %s: %v", spec.Name, err)
+		}
+	}
+
+	return nil
+}
+
+func decodeDecimal(value json.RawMessage, field reflect.Value) error {
+	var s string
+	if err := json.Unmarshal(value, &s); err != nil {
+		// some formula fields return plain numbers
+		s = string(value)
+	}
+
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return nil
+	}
+
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return err
+	}
+
+	if field.Kind() == reflect.Ptr {
+		field.Set(reflect.New(field.Type().Elem()))
+		field = field.Elem()
+	}
+
+	switch field.Kind() {
+	case reflect.Float32, reflect.Float64:
+		field.SetFloat(f)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		field.SetInt(int64(f))
+	default:
+		return fmt.Errorf("cannot decode decimal into %s", field.Type())
+	}
+
+	return nil
+}
+
+func decodeLink(value json.RawMessage, field reflect.Value, ids bool) error {
+	var linked []LinkedItem
+	if err := json.Unmarshal(value, &linked); err != nil {
+		return err
+	}
+
+	switch {
+	case field.Kind() == reflect.Ptr && field.Type().Elem().Kind() == reflect.Int && ids:
+		if len(linked) > 1 {
+			return fmt.Errorf("unexpected number of linked rows. Found %d, expected 0 or 1", len(linked))
+		}
+
+		if len(linked) == 1 {
+			id := reflect.New(field.Type().Elem())
+			id.Elem().SetInt(int64(linked[0].ID))
+			field.Set(id)
+		}
+
+	case field.Kind() == reflect.Slice && field.Type().Elem().Kind() == reflect.Int && ids:
+		var out []int
+		for _, l := range linked {
+			out = append(out, l.ID)
+		}
+		field.Set(reflect.ValueOf(out))
+
+	case field.Kind() == reflect.Slice && field.Type().Elem().Kind() == reflect.String && !ids:
+		var out []string
+		for _, l := range linked {
+			out = append(out, l.Value)
+		}
+		field.Set(reflect.ValueOf(out))
+
+	default:
+		return fmt.Errorf("cannot decode link row into %s", field.Type())
+	}
+
+	return nil
+}
+
+func isNull(value json.RawMessage) bool {
+	return bytes.Equal(bytes.TrimSpace(value), []byte("null"))
+}
@@ -0,0 +1,79 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+var (
+	ErrNotFound    = errors.New("baserow: not found")
+	ErrRateLimited = errors.New("baserow: rate limited")
+	ErrValidation  = errors.New("baserow: validation failed")
+
+	// ErrUnknownField is returned before any request is made when an update
+	// names a field that the target table type does not declare.
+	ErrUnknownField = errors.New("baserow: unknown field")
+)
+
+// BaserowAPIError is returned for any non-2xx response from Baserow. Use
+// errors.Is with ErrNotFound, ErrRateLimited or ErrValidation to classify it.
+type BaserowAPIError struct {
+	StatusCode int
+	Status     string
+	Code       string          // Baserow error code, e.g. ERROR_REQUEST_BODY_VALIDATION
+	Detail     json.RawMessage // Baserow error detail; per-field messages for validation errors
+	Body       string
+}
+
+func newBaserowAPIError(resp *http.Response, body []byte) *BaserowAPIError {
+	apiErr := &BaserowAPIError{
+		StatusCode: resp.StatusCode,
+		Status:     resp.Status,
+		Body:       string(body),
+	}
+
+	var payload struct {
+		Error  string          `json:"error"`
+		Detail json.RawMessage `json:"detail"`
+	}
+
+	if err := json.Unmarshal(body, &payload); err == nil {
+		apiErr.Code = payload.Error
+		apiErr.Detail = payload.Detail
+	}
+
+	return apiErr
+}
+
+func (e *BaserowAPIError) Error() string {
+	return fmt.Sprintf("API request failed with status: %s and body: %s", e.Status, e.Body)
+}
+
+func (e *BaserowAPIError) Is(target error) bool {
+	switch target {
+	case ErrNotFound:
+		return e.StatusCode == http.StatusNotFound
+	case ErrRateLimited:
+		return e.StatusCode == http.StatusTooManyRequests
+	case ErrValidation:
+		return e.StatusCode == http.StatusBadRequest
+	}
+
+	return false
+}
+
+// transportError wraps failures to reach Baserow at all (DNS, connection
+// resets, timeouts) so they can be told apart from API errors when retrying.
+type transportError struct {
+	err error
+}
+
+func (e *transportError) Error() string {
+	return fmt.Sprintf("Error making API request: %v", e.err)
+}
+
+func (e *transportError) Unwrap() error {
+	return e.err
+}
@@ -0,0 +1,108 @@
+package models
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// BaserowField is a field as reported by Baserow's fields API.
+type BaserowField struct {
+	ID             int    `json:"id"`
+	Name           string `json:"name"`
+	Type           string `json:"type"`
+	Primary        bool   `json:"primary"`
+	LinkRowTableID *int   `json:"link_row_table_id,omitempty"`
+}
+
+// ListFields returns the fields of the named table.
+func (c *BaserowClient) ListFields(ctx context.Context, tableName string) ([]BaserowField, error) {
+	tableID, err := c.TableIDByName(tableName)
+	if err != nil {
+		return nil, fmt.Errorf("ListFields: %w", err)
+	}
+
+	url := fmt.Sprintf("%s/api/database/fields/table/%s/", c.BaseURL, tableID)
+
+	body, err := c.do(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("ListFields: %w", err)
+	}
+
+	var fields []BaserowField
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return nil, fmt.Errorf("ListFields: error decoding JSON: %v", err)
+	}
+
+	return fields, nil
+}
+
+// FieldDescription describes how a struct field is read from a Baserow row.
+type FieldDescription struct {
+	Name    string            // Baserow field name
+	Kind    string            // "decimal", "link", "link_id" or "" for plain JSON
+	Options map[string]string // provisioning options, e.g. "table", "related", "type"
+	GoType  reflect.Type      // type of the struct field
+}
+
+// DescribeFields returns the Baserow fields data's struct type reads, in
+// declaration order. The row "id" is excluded.
+func DescribeFields(data BaserowData) []FieldDescription {
+	t := reflect.TypeOf(data)
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	var out []FieldDescription
+	for _, spec := range readFieldSpecs(t) {
+		if spec.Name == "id" {
+			continue
+		}
+
+		out = append(out, FieldDescription{
+			Name:    spec.Name,
+			Kind:    spec.Kind,
+			Options: spec.Options,
+			GoType:  t.Field(spec.Index).Type,
+		})
+	}
+
+	return out
+}
+
+// FieldNames returns the Baserow field names declared by data's struct type,
+// as read by the decoder and checked by the schema verifier: the baserow tag's
+// name if it has one, otherwise the json tag's. The row "id" is excluded.
+func FieldNames(data BaserowData) []string {
+	var names []string
+	for _, field := range DescribeFields(data) {
+		names = append(names, field.Name)
+	}
+
+	return names
+}
+
+func validateFields(data BaserowData, fields BaserowFields) error {
+	known := make(map[string]bool)
+	for _, name := range FieldNames(data) {
+		known[name] = true
+	}
+
+	var unknown []string
+	for name := range fields {
+		if !known[name] {
+			unknown = append(unknown, name)
+		}
+	}
+
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return fmt.Errorf("%w: %s not declared on %T", ErrUnknownField, strings.Join(unknown, ", "), data)
+	}
+
+	return nil
+}
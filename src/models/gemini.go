@@ -21,6 +21,7 @@ type ReceiptItemsJSON struct {
 	IsCase          bool         `json:"IsCase"`
 	Quantity        interface{}  `json:"Quantity"`
 	Price           interface{}  `json:"Price"`
+	Image           interface{}  `json:"Image"`
 	PendingPurchase []LinkedItem `json:"PendingPurchase"`
 }
 
@@ -67,6 +68,14 @@ func (r ReceiptItemsJSON) ToReceiptItem() (ReceiptItem, error) {
 	receiptItem.Quantity = quantity
 	receiptItem.Price = price
 
+	// the image index only matters for receipts photographed in parts
+	switch img := r.Image.(type) {
+	case float64:
+		receiptItem.Image = int(img)
+	case string:
+		receiptItem.Image, _ = strconv.Atoi(img)
+	}
+
 	if len(r.PendingPurchase) == 1 {
 		receiptItem.PendingPurchase = &BaserowPendingPurchase{
 			ID: r.PendingPurchase[0].ID,
@@ -78,11 +87,14 @@ func (r ReceiptItemsJSON) ToReceiptItem() (ReceiptItem, error) {
 	return receiptItem, nil
 }
 
+// ReceiptItem is one line of a receipt. The description tags are sent to the
+// model as part of the response schema.
 type ReceiptItem struct {
-	Quantity        int                     `json:"Quantity"`
-	Price           float64                 `json:"Price"`
-	IsCase          bool                    `json:"IsCase"`
-	Name            string                  `json:"Name"`
+	Quantity        int                     `json:"Quantity" description:"number of units or cases bought"`
+	Price           float64                 `json:"Price" description:"price of one unit or case in dollars"`
+	IsCase          bool                    `json:"IsCase" description:"whether the line is sold by the case"`
+	Name            string                  `json:"Name" description:"item name as printed on the receipt"`
+	Image           int                     `json:"Image,omitempty" description:"0-based index of the file the line was read from"`
 	PendingPurchase *BaserowPendingPurchase `json:"-"`
 }
 
@@ -95,11 +107,11 @@ type ReceiptSummaryJSON struct {
 }
 
 type ReceiptSummary struct {
-	Vendor     string  `json:"vendor"`
-	Tax        float64 `json:"Tax"`
-	Total      float64 `json:"Total"`
-	TotalUnits int     `json:"total_units"`
-	TotalCases int     `json:"total_cases"`
+	Vendor     string  `json:"vendor" description:"store or distributor name"`
+	Tax        float64 `json:"Tax" description:"total tax in dollars"`
+	Total      float64 `json:"Total" description:"amount paid in dollars, including tax"`
+	TotalUnits int     `json:"total_units" description:"number of units bought, excluding cases"`
+	TotalCases int     `json:"total_cases" description:"number of cases bought"`
 }
 
 func (r ReceiptSummaryJSON) ToReceiptSummary() (ReceiptSummary, error) {
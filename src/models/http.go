@@ -1,64 +1,273 @@
 package models
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"math/rand"
 	"net/http"
+	"net/url"
 	"reflect"
+	"strconv"
+	"strings"
+	"time"
 )
 
-func listRows[T BaserowData](url string, c *BaserowClient, instance T) (BaserowQueryResponse[T], error) {
-	client := &http.Client{}
+const (
+	defaultHTTPTimeout = 30 * time.Second
+	defaultMaxRetries  = 5
+	defaultMinBackoff  = 500 * time.Millisecond
+	defaultMaxBackoff  = 30 * time.Second
 
-	req, err := http.NewRequest("GET", url, nil)
+	baserowMaxPageSize = 200
+)
+
+// do sends a request to the Baserow API and returns the response body of a
+// successful (2xx) call. Rate-limited and transient failures are retried with
+// exponential backoff; any other failure is returned as a *BaserowAPIError.
+func (c *BaserowClient) do(ctx context.Context, method, url string, body []byte) ([]byte, error) {
+	for attempt := 0; ; attempt++ {
+		respBody, retryAfter, err := c.doOnce(ctx, method, url, body)
+		if err == nil {
+			return respBody, nil
+		}
+
+		if attempt >= c.MaxRetries || !isRetryable(method, err) {
+			return nil, err
+		}
+
+		wait := c.backoff(attempt, retryAfter)
+
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("%w (giving up retry: %v)", err, ctx.Err())
+		case <-time.After(wait):
+		}
+	}
+}
+
+func (c *BaserowClient) doOnce(ctx context.Context, method, url string, body []byte) ([]byte, time.Duration, error) {
+	var reqBody io.Reader
+	if body != nil {
+		reqBody = bytes.NewReader(body)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, url, reqBody)
 	if err != nil {
-		return BaserowQueryResponse[T]{}, fmt.Errorf("Error creating request: %v", err)
+		return nil, 0, fmt.Errorf("Error creating request: %w", err)
 	}
 
-	req.Header.Add("Authorization", "Token "+c.ApiKey)
+	// token-auth requests are sent without credentials
+	if c.ApiKey != "" {
+		req.Header.Add("Authorization", c.AuthScheme+" "+c.ApiKey)
+	}
 	req.Header.Add("Accept", "application/json")
+	if body != nil {
+		req.Header.Add("Content-Type", "application/json")
+	}
 
-	resp, err := client.Do(req)
+	resp, err := c.HTTPClient.Do(req)
 	if err != nil {
-		return BaserowQueryResponse[T]{}, fmt.Errorf("Error making API request: %v", err)
+		return nil, 0, &transportError{err: err}
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		bodyBytes, err := io.ReadAll(resp.Body)
-		if err != nil {
-			return BaserowQueryResponse[T]{}, fmt.Errorf("API request failed with status: %s and error reading body: %v", resp.Status, err)
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, 0, &transportError{err: fmt.Errorf("API request failed with status: %s and error reading body: %w", resp.Status, err)}
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, parseRetryAfter(resp.Header.Get("Retry-After")), newBaserowAPIError(resp, respBody)
+	}
+
+	return respBody, 0, nil
+}
+
+// isRetryable reports whether a failed request can safely be sent again.
+// Rate limits and 503s are never processed by Baserow, so any method may be
+// retried; other server and network errors are only retried for idempotent
+// methods to avoid creating duplicate rows.
+func isRetryable(method string, err error) bool {
+	idempotent := method == http.MethodGet || method == http.MethodPatch || method == http.MethodDelete
+
+	switch e := err.(type) {
+	case *transportError:
+		return idempotent && !errors.Is(e.err, context.Canceled) && !errors.Is(e.err, context.DeadlineExceeded)
+	case *BaserowAPIError:
+		if e.StatusCode == http.StatusTooManyRequests || e.StatusCode == http.StatusServiceUnavailable {
+			return true
+		}
+		return idempotent && e.StatusCode >= 500
+	}
+
+	return false
+}
+
+// backoff returns the delay before the next attempt: the server's Retry-After
+// if it sent one, otherwise exponential backoff with jitter.
+func (c *BaserowClient) backoff(attempt int, retryAfter time.Duration) time.Duration {
+	if retryAfter > 0 {
+		if c.MaxBackoff > 0 && retryAfter > c.MaxBackoff {
+			return c.MaxBackoff
+		}
+		return retryAfter
+	}
+
+	d := c.MinBackoff << attempt
+	if d <= 0 || (c.MaxBackoff > 0 && d > c.MaxBackoff) {
+		d = c.MaxBackoff
+	}
+
+	if d <= 0 {
+		return 0
+	}
+
+	// equal jitter: wait between d/2 and d
+	half := d / 2
+	return half + time.Duration(rand.Int63n(int64(half)+1))
+}
+
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+
+	if t, err := http.ParseTime(value); err == nil {
+		if d := time.Until(t); d > 0 {
+			return d
 		}
-		bodyString := string(bodyBytes)
+	}
+
+	return 0
+}
 
-		return BaserowQueryResponse[T]{}, fmt.Errorf("API request failed with status: %s and body: %s", resp.Status, bodyString)
+func listRows[T BaserowData](ctx context.Context, url string, c *BaserowClient, rowType reflect.Type) (BaserowQueryResponse[T], error) {
+	body, err := c.do(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return BaserowQueryResponse[T]{}, err
 	}
 
-	data, err := instance.UnmarshalJSON(resp.Body)
-	response, ok := data.(BaserowQueryResponse[T])
-	if !ok {
-		return BaserowQueryResponse[T]{}, fmt.Errorf("error asserting type to BaserowQueryResponse")
+	var page BaserowQueryResponse[json.RawMessage]
+	if err := json.Unmarshal(body, &page); err != nil {
+		return BaserowQueryResponse[T]{}, fmt.Errorf("error decoding JSON: %v", err)
+	}
+
+	response := BaserowQueryResponse[T]{
+		Count:    page.Count,
+		Next:     page.Next,
+		Previous: page.Previous,
+	}
+
+	for _, raw := range page.Results {
+		row := reflect.New(rowType)
+		if err := decodeRowValue(raw, row.Elem()); err != nil {
+			return BaserowQueryResponse[T]{}, err
+		}
+
+		response.Results = append(response.Results, row.Interface().(T))
 	}
 
 	return response, nil
 }
 
-func ListRows[T BaserowData](c *BaserowClient) ([]T, error) {
+// ListRowsOption narrows or orders the rows returned by ListRows using
+// Baserow's list query parameters.
+type ListRowsOption func(q url.Values)
+
+// WithFilter adds a filter__{field}__{filterType}=value condition, e.g.
+// WithFilter("Reason", "not_empty", "") or WithFilter("Date", "date_after", "2024-01-01").
+func WithFilter(field, filterType, value string) ListRowsOption {
+	return func(q url.Values) {
+		q.Add(fmt.Sprintf("filter__%s__%s", field, filterType), value)
+	}
+}
+
+// WithFilterType sets how multiple filters combine: "AND" (default) or "OR".
+func WithFilterType(filterType string) ListRowsOption {
+	return func(q url.Values) {
+		q.Set("filter_type", filterType)
+	}
+}
+
+// WithOrderBy sorts by the given fields; prefix a field with "-" for descending.
+func WithOrderBy(fields ...string) ListRowsOption {
+	return func(q url.Values) {
+		q.Set("order_by", strings.Join(fields, ","))
+	}
+}
+
+// WithSearch only returns rows matching the full-text search query.
+func WithSearch(search string) ListRowsOption {
+	return func(q url.Values) {
+		q.Set("search", search)
+	}
+}
+
+// WithInclude only returns the given fields (plus the row ID).
+func WithInclude(fields ...string) ListRowsOption {
+	return func(q url.Values) {
+		q.Set("include", strings.Join(fields, ","))
+	}
+}
+
+// WithExclude omits the given fields.
+func WithExclude(fields ...string) ListRowsOption {
+	return func(q url.Values) {
+		q.Set("exclude", strings.Join(fields, ","))
+	}
+}
+
+// WithPageSize sets how many rows are fetched per request (max 200).
+func WithPageSize(size int) ListRowsOption {
+	return func(q url.Values) {
+		q.Set("size", strconv.Itoa(size))
+	}
+}
+
+// WithView applies the filters and sorts of a Baserow view.
+func WithView(viewID string) ListRowsOption {
+	return func(q url.Values) {
+		q.Set("view_id", viewID)
+	}
+}
+
+func ListRows[T BaserowData](ctx context.Context, c *BaserowClient, opts ...ListRowsOption) ([]T, error) {
 	var instance T
 	if reflect.TypeOf(instance).Kind() != reflect.Ptr {
 		return nil, fmt.Errorf("ListRows: type T must be a pointer type")
 	}
 
-	instance = reflect.New(reflect.TypeOf(instance).Elem()).Interface().(T)
+	rowType := reflect.TypeOf(instance).Elem()
+	instance = reflect.New(rowType).Interface().(T)
+
+	q := url.Values{}
+	q.Set("user_field_names", "true")
+	q.Set("size", strconv.Itoa(baserowMaxPageSize))
+	for _, opt := range opts {
+		opt(q)
+	}
+
+	tableID, err := c.TableID(instance)
+	if err != nil {
+		return nil, fmt.Errorf("ListRows: %w", err)
+	}
 
-	url := fmt.Sprintf("%s/api/database/rows/table/%s/?user_field_names=true", c.BaseURL, instance.GetTableID())
+	pageURL := fmt.Sprintf("%s/api/database/rows/table/%s/?%s", c.BaseURL, tableID, q.Encode())
 
 	var results []T
 	var count int
 	for {
-		resp, err := listRows[T](url, c, instance)
+		resp, err := listRows[T](ctx, pageURL, c, rowType)
 		if err != nil {
-			return nil, fmt.Errorf("Error listing rows: %v, url: %s", err, url)
+			return nil, fmt.Errorf("Error listing rows: %w, url: %s", err, pageURL)
 		}
 
 		results = append(results, resp.Results...)
@@ -67,7 +276,7 @@ func ListRows[T BaserowData](c *BaserowClient) ([]T, error) {
 		if resp.Next == "" {
 			break
 		} else {
-			url = resp.Next
+			pageURL = resp.Next
 		}
 	}
 
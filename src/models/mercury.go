@@ -1,6 +1,9 @@
 package models
 
-import "fmt"
+import (
+	"fmt"
+	"strings"
+)
 
 type MercuryPagination struct {
 	NextPage     string `json:"nextPage"`
@@ -13,8 +16,21 @@ type MercuryTransactionAttachment struct {
 	URL            string `json:"url"`
 }
 
+type MercuryAccount struct {
+	ID     string `json:"id"`
+	Name   string `json:"name"`
+	Kind   string `json:"kind"`
+	Status string `json:"status"`
+}
+
+type MercuryListAccountsResponse struct {
+	Accounts []*MercuryAccount `json:"accounts"`
+}
+
 type MercuryTransaction struct {
 	ID              string                          `json:"id"`
+	AccountID       string                          `json:"accountId,omitempty"`
+	AccountName     string                          `json:"accountName,omitempty"`
 	Amount          float64                         `json:"amount"`
 	BankDescription string                          `json:"bankDescription"`
 	Attachments     []*MercuryTransactionAttachment `json:"attachments"`
@@ -27,7 +43,53 @@ func (t MercuryTransaction) String() string {
 	return fmt.Sprintf("(%s) %s - %s - %.2f", t.ID, t.CreatedAt, t.BankDescription, t.Amount)
 }
 
+// AttachmentURLs returns the URLs of the transaction's attachments, in order.
+// Long receipts are often photographed in several parts.
+func (t MercuryTransaction) AttachmentURLs() []string {
+	var urls []string
+	for _, attachment := range t.Attachments {
+		urls = append(urls, attachment.URL)
+	}
+	return urls
+}
+
+// JoinReceiptURLs stores several receipt URLs in one long text field, one per
+// line.
+func JoinReceiptURLs(urls []string) string {
+	return strings.Join(urls, "\n")
+}
+
+// SplitReceiptURLs is the inverse of JoinReceiptURLs.
+func SplitReceiptURLs(field string) []string {
+	var urls []string
+	for _, url := range strings.Split(field, "\n") {
+		if url = strings.TrimSpace(url); url != "" {
+			urls = append(urls, url)
+		}
+	}
+	return urls
+}
+
 type MercuryListAllTransactionsResponse struct {
+	Total        int                   `json:"total,omitempty"`
 	Page         MercuryPagination     `json:"page"`
 	Transactions []*MercuryTransaction `json:"transactions"`
 }
+
+// MercuryWebhookEvent is the body of a Mercury webhook request. For
+// transaction events ResourceID is the transaction ID.
+type MercuryWebhookEvent struct {
+	ID            string                 `json:"id"`
+	ResourceType  string                 `json:"resourceType"`
+	ResourceID    string                 `json:"resourceId"`
+	OperationType string                 `json:"operationType"`
+	OccurredAt    string                 `json:"occurredAt"`
+	MergePatch    map[string]interface{} `json:"mergePatch"`
+}
+
+// AccountID returns the account of the changed resource, if the event carries
+// it.
+func (e MercuryWebhookEvent) AccountID() string {
+	accountID, _ := e.MergePatch["accountId"].(string)
+	return accountID
+}
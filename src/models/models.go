@@ -7,6 +7,12 @@ type CreateBaserowPurchaseRequest struct {
 	ReceiptItems    []ReceiptItem           `json:"receipt_items"`
 	BankTransaction *MercuryTransaction     `json:"bank_transaction"`
 	PendingPurchase *BaserowPendingPurchase `json:"pending_purchase"`
+	// ParseAttempts is the parser's attempts at reading the receipt, one per
+	// line.
+	ParseAttempts string `json:"parse_attempts,omitempty"`
+	// PromptVersion is the prompt template the receipt was read with, e.g.
+	// "sysco.v1".
+	PromptVersion string `json:"prompt_version,omitempty"`
 }
 
 func NewCreateBaserowPurchaseRequest(summary ReceiptSummary, items []ReceiptItem, tx *MercuryTransaction, pendingPurchase *BaserowPendingPurchase) (CreateBaserowPurchaseRequest, error) {
@@ -41,16 +47,20 @@ func NewCreateBaserowPurchaseRequestFromPendingPurchases(pendingPurchases []*Bas
 		return CreateBaserowPurchaseRequest{}, fmt.Errorf("pending purchase missing date for bank tx ID %s", header.BankTxID)
 	}
 
+	receiptURLs := SplitReceiptURLs(header.ReceiptURLs)
+	if len(receiptURLs) == 0 && header.ReceiptURL != "" {
+		receiptURLs = []string{header.ReceiptURL}
+	}
+
 	tx := &MercuryTransaction{
 		ID:        header.BankTxID,
 		Amount:    header.BankTotal,
 		CreatedAt: *header.Date,
 		Note:      header.Note,
-		Attachments: []*MercuryTransactionAttachment{
-			{
-				URL: header.ReceiptURL,
-			},
-		},
+	}
+
+	for _, url := range receiptURLs {
+		tx.Attachments = append(tx.Attachments, &MercuryTransactionAttachment{URL: url})
 	}
 
 	var items []ReceiptItem
@@ -64,15 +74,25 @@ func NewCreateBaserowPurchaseRequestFromPendingPurchases(pendingPurchases []*Bas
 		})
 	}
 
-	return NewCreateBaserowPurchaseRequest(summary, items, tx, header)
+	req, err := NewCreateBaserowPurchaseRequest(summary, items, tx, header)
+	if err != nil {
+		return CreateBaserowPurchaseRequest{}, err
+	}
+
+	req.ParseAttempts = header.ParseAttempts
+	req.PromptVersion = header.PromptVersion
+
+	return req, nil
 }
 
 func NewBaserowPendingPurchases(summary ReceiptSummary, items []ReceiptItem, tx *MercuryTransaction, err error) ([]*BaserowPendingPurchase, error) {
+	receiptURLs := tx.AttachmentURLs()
+
+	// Receipt URL links the first image for quick review; Receipt URLs keeps
+	// all of them
 	receiptURL := ""
-	if len(tx.Attachments) == 1 {
-		receiptURL = tx.Attachments[0].URL
-	} else if len(tx.Attachments) > 1 {
-		return nil, fmt.Errorf("NewBaserowPendingPurchases: expected 0 or 1 attachment for tx ID %s, got %d", tx.ID, len(tx.Attachments))
+	if len(receiptURLs) > 0 {
+		receiptURL = receiptURLs[0]
 	}
 
 	reason := err.Error()
@@ -80,17 +100,18 @@ func NewBaserowPendingPurchases(summary ReceiptSummary, items []ReceiptItem, tx
 	out := []*BaserowPendingPurchase{
 		// Header
 		{
-			BankTxID:   tx.ID,
-			BankTotal:  tx.Amount,
-			Vendor:     summary.Vendor,
-			Date:       &tx.CreatedAt,
-			Note:       tx.Note,
-			Tax:        summary.Tax,
-			Total:      summary.Total,
-			TotalUnits: summary.TotalUnits,
-			TotalCases: summary.TotalCases,
-			ReceiptURL: receiptURL,
-			Reason:     reason,
+			BankTxID:    tx.ID,
+			BankTotal:   tx.Amount,
+			Vendor:      summary.Vendor,
+			Date:        &tx.CreatedAt,
+			Note:        tx.Note,
+			Tax:         summary.Tax,
+			Total:       summary.Total,
+			TotalUnits:  summary.TotalUnits,
+			TotalCases:  summary.TotalCases,
+			ReceiptURL:  receiptURL,
+			ReceiptURLs: JoinReceiptURLs(receiptURLs),
+			Reason:      reason,
 		},
 	}
 
@@ -0,0 +1,133 @@
+package models
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// BaserowTable is a table as reported by Baserow's tables API.
+type BaserowTable struct {
+	ID         int    `json:"id"`
+	Name       string `json:"name"`
+	DatabaseID int    `json:"database_id"`
+}
+
+// BaserowFieldWithRelated is a created field together with the fields Baserow
+// created alongside it, such as the reverse side of a link-row field.
+type BaserowFieldWithRelated struct {
+	BaserowField
+	RelatedFields []BaserowField `json:"related_fields"`
+}
+
+// BaserowTokenAuth exchanges a user's email and password for a JWT, which is
+// required by the table and field management endpoints.
+func BaserowTokenAuth(ctx context.Context, baseURL, email, password string) (string, error) {
+	c := NewBaserowClient(baseURL, "")
+
+	rawData, err := json.Marshal(map[string]string{"email": email, "password": password})
+	if err != nil {
+		return "", fmt.Errorf("Error marshalling data: %v", err)
+	}
+
+	body, err := c.do(ctx, http.MethodPost, fmt.Sprintf("%s/api/user/token-auth/", baseURL), rawData)
+	if err != nil {
+		return "", fmt.Errorf("BaserowTokenAuth: %w", err)
+	}
+
+	var resp struct {
+		AccessToken string `json:"access_token"`
+		Token       string `json:"token"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return "", fmt.Errorf("BaserowTokenAuth: error decoding JSON: %v", err)
+	}
+
+	if resp.AccessToken != "" {
+		return resp.AccessToken, nil
+	}
+
+	if resp.Token == "" {
+		return "", fmt.Errorf("BaserowTokenAuth: no token in response")
+	}
+
+	return resp.Token, nil
+}
+
+// CreateTable creates an empty table in the database whose only field is a
+// text primary field named primaryField.
+func (c *BaserowClient) CreateTable(ctx context.Context, databaseID int, name, primaryField string) (*BaserowTable, error) {
+	url := fmt.Sprintf("%s/api/database/tables/database/%d/", c.BaseURL, databaseID)
+
+	rawData, err := json.Marshal(map[string]interface{}{
+		"name":             name,
+		"data":             [][]string{{primaryField}},
+		"first_row_header": true,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Error marshalling data: %v", err)
+	}
+
+	body, err := c.do(ctx, http.MethodPost, url, rawData)
+	if err != nil {
+		return nil, fmt.Errorf("CreateTable: %w", err)
+	}
+
+	var table BaserowTable
+	if err := json.Unmarshal(body, &table); err != nil {
+		return nil, fmt.Errorf("CreateTable: error decoding JSON: %v", err)
+	}
+
+	return &table, nil
+}
+
+// CreateField adds a field to the named table. field holds the field name,
+// type and any type-specific options, e.g. "link_row_table_id".
+func (c *BaserowClient) CreateField(ctx context.Context, tableName string, field map[string]interface{}) (*BaserowFieldWithRelated, error) {
+	tableID, err := c.TableIDByName(tableName)
+	if err != nil {
+		return nil, fmt.Errorf("CreateField: %w", err)
+	}
+
+	url := fmt.Sprintf("%s/api/database/fields/table/%s/", c.BaseURL, tableID)
+
+	rawData, err := json.Marshal(field)
+	if err != nil {
+		return nil, fmt.Errorf("Error marshalling data: %v", err)
+	}
+
+	body, err := c.do(ctx, http.MethodPost, url, rawData)
+	if err != nil {
+		return nil, fmt.Errorf("CreateField: %w", err)
+	}
+
+	var created BaserowFieldWithRelated
+	if err := json.Unmarshal(body, &created); err != nil {
+		return nil, fmt.Errorf("CreateField: error decoding JSON: %v", err)
+	}
+
+	return &created, nil
+}
+
+// UpdateField changes the given properties, e.g. "name", of a field.
+func (c *BaserowClient) UpdateField(ctx context.Context, fieldID int, changes map[string]interface{}) (*BaserowField, error) {
+	url := fmt.Sprintf("%s/api/database/fields/%d/", c.BaseURL, fieldID)
+
+	rawData, err := json.Marshal(changes)
+	if err != nil {
+		return nil, fmt.Errorf("Error marshalling data: %v", err)
+	}
+
+	body, err := c.do(ctx, http.MethodPatch, url, rawData)
+	if err != nil {
+		return nil, fmt.Errorf("UpdateField: %w", err)
+	}
+
+	var field BaserowField
+	if err := json.Unmarshal(body, &field); err != nil {
+		return nil, fmt.Errorf("UpdateField: error decoding JSON: %v", err)
+	}
+
+	return &field, nil
+}
@@ -0,0 +1,228 @@
+package parsecache
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/jiaming2012/receipt-bot/src/models"
+	"github.com/jiaming2012/receipt-bot/src/services"
+)
+
+// DefaultDir is where parsed receipts are cached when PARSE_CACHE_DIR is not
+// set.
+const DefaultDir = "parse_cache"
+
+// Entry is a parser's answer for one receipt.
+type Entry struct {
+	Key           string `json:"key"`
+	Parser        string `json:"parser"`
+	PromptVersion string `json:"prompt_version"`
+	// FilesSHA256 is the services.StubReceiptKey of the receipt's files.
+	FilesSHA256 string         `json:"files_sha256"`
+	Corrected   bool           `json:"corrected,omitempty"`
+	CreatedAt   time.Time      `json:"created_at"`
+	Receipt     models.Receipt `json:"receipt"`
+}
+
+// errNotAKey is returned for files in the cache directory that aren't named
+// after a cache key, e.g. copies or backups of an entry.
+var errNotAKey = errors.New("file name is not a cache key")
+
+// Store keeps cache entries as one JSON file per key in a directory.
+type Store struct {
+	dir string
+}
+
+func NewStore(dir string) *Store {
+	return &Store{dir: dir}
+}
+
+// Key is the cache key for parsing files with the named parser. It covers the
+// files' contents, the parser and model, and the prompt's version and
+// instructions, so a re-prompt is cached separately from the first answer.
+func Key(parser string, files []*services.ReceiptFile, prompt *services.Prompt) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "files:%s\nparser:%s\nprompt:%s\n", services.StubReceiptKey(files), parser, prompt.Version)
+	for _, instruction := range prompt.Instructions {
+		fmt.Fprintf(h, "%s\n", instruction)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Get returns the entry for key, or nil if there is none.
+func (s *Store) Get(key string) (*Entry, error) {
+	entry, err := s.read(filepath.Join(s.dir, key+".json"))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("parsecache.Get: %w", err)
+	}
+
+	return entry, nil
+}
+
+func (s *Store) Put(entry *Entry) error {
+	if err := os.MkdirAll(s.dir, 0o755); err != nil {
+		return fmt.Errorf("parsecache.Put: %w", err)
+	}
+
+	out, err := json.MarshalIndent(entry, "", "  ")
+	if err != nil {
+		return fmt.Errorf("parsecache.Put: %w", err)
+	}
+
+	// write to a temporary file first so a crash never leaves a truncated entry
+	path := filepath.Join(s.dir, entry.Key+".json")
+	if err := os.WriteFile(path+".tmp", out, 0o644); err != nil {
+		return fmt.Errorf("parsecache.Put: %w", err)
+	}
+
+	if err := os.Rename(path+".tmp", path); err != nil {
+		return fmt.Errorf("parsecache.Put: %w", err)
+	}
+
+	return nil
+}
+
+// List returns every entry, oldest first.
+func (s *Store) List() ([]*Entry, error) {
+	paths, err := filepath.Glob(filepath.Join(s.dir, "*.json"))
+	if err != nil {
+		return nil, fmt.Errorf("parsecache.List: %w", err)
+	}
+
+	var entries []*Entry
+	for _, path := range paths {
+		entry, err := s.read(path)
+		if errors.Is(err, errNotAKey) {
+			log.Warnf("parsecache.List: skipping %s: %v", path, err)
+			continue
+		} else if err != nil {
+			return nil, fmt.Errorf("parsecache.List: %w", err)
+		}
+
+		entries = append(entries, entry)
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].CreatedAt.Before(entries[j].CreatedAt)
+	})
+
+	return entries, nil
+}
+
+// Find returns the entries whose key, or the hash of whose files, starts with
+// prefix.
+func (s *Store) Find(prefix string) ([]*Entry, error) {
+	entries, err := s.List()
+	if err != nil {
+		return nil, err
+	}
+
+	var out []*Entry
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Key, prefix) || strings.HasPrefix(entry.FilesSHA256, prefix) {
+			out = append(out, entry)
+		}
+	}
+
+	return out, nil
+}
+
+func (s *Store) Delete(entries ...*Entry) error {
+	for _, entry := range entries {
+		if err := os.Remove(filepath.Join(s.dir, entry.Key+".json")); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("parsecache.Delete: %w", err)
+		}
+	}
+
+	return nil
+}
+
+func (s *Store) read(path string) (*Entry, error) {
+	key := strings.TrimSuffix(filepath.Base(path), ".json")
+	if !isKey(key) {
+		return nil, fmt.Errorf("%s: %w", filepath.Base(path), errNotAKey)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var entry Entry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", filepath.Base(path), err)
+	}
+
+	// the file name is the key Delete removes, whatever the entry says
+	entry.Key = key
+
+	return &entry, nil
+}
+
+// isKey reports whether s has the form of a Key: a hex SHA-256.
+func isKey(s string) bool {
+	b, err := hex.DecodeString(s)
+	return err == nil && len(b) == sha256.Size && strings.ToLower(s) == s
+}
+
+// Parser answers from the cache when it can and calls the wrapped parser
+// otherwise, caching its answer. Failed calls are not cached.
+type Parser struct {
+	parser services.ReceiptParser
+	store  *Store
+}
+
+func Wrap(parser services.ReceiptParser, store *Store) *Parser {
+	return &Parser{parser: parser, store: store}
+}
+
+func (p *Parser) Name() string {
+	return p.parser.Name()
+}
+
+func (p *Parser) ParseReceipt(ctx context.Context, files []*services.ReceiptFile, prompt *services.Prompt) ([]models.ReceiptItem, models.ReceiptSummary, error) {
+	key := Key(p.parser.Name(), files, prompt)
+
+	entry, err := p.store.Get(key)
+	if err != nil {
+		// a broken cache shouldn't stop ingestion
+		log.Warnf("Ignoring parse cache entry %s: %v", key, err)
+	} else if entry != nil {
+		log.Debugf("Parse cache hit %s for %s", key, p.parser.Name())
+		return entry.Receipt.Items, entry.Receipt.Summary, nil
+	}
+
+	items, summary, err := p.parser.ParseReceipt(ctx, files, prompt)
+	if err != nil {
+		return nil, models.ReceiptSummary{}, err
+	}
+
+	entry = &Entry{
+		Key:           key,
+		Parser:        p.parser.Name(),
+		PromptVersion: prompt.Version,
+		FilesSHA256:   services.StubReceiptKey(files),
+		Corrected:     prompt.Correction != nil,
+		CreatedAt:     time.Now().UTC(),
+		Receipt:       models.Receipt{Items: items, Summary: summary},
+	}
+
+	if err := p.store.Put(entry); err != nil {
+		log.Warnf("Failed to cache parsed receipt: %v", err)
+	}
+
+	return items, summary, nil
+}
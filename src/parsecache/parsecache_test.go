@@ -0,0 +1,90 @@
+package parsecache_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/jiaming2012/receipt-bot/src/models"
+	"github.com/jiaming2012/receipt-bot/src/parsecache"
+	"github.com/jiaming2012/receipt-bot/src/services"
+)
+
+// countingParser answers every receipt the same way and counts its calls.
+type countingParser struct {
+	model string
+	calls int
+}
+
+func (p *countingParser) Name() string {
+	return "fake/" + p.model
+}
+
+func (p *countingParser) ParseReceipt(ctx context.Context, files []*services.ReceiptFile, prompt *services.Prompt) ([]models.ReceiptItem, models.ReceiptSummary, error) {
+	p.calls++
+	return []models.ReceiptItem{{Name: "Corn", Quantity: 2, Price: 4.5}}, models.ReceiptSummary{Vendor: "Farmers Market", Total: 9}, nil
+}
+
+func TestParserCachesByFilesModelAndPrompt(t *testing.T) {
+	store := parsecache.NewStore(t.TempDir())
+	ctx := context.Background()
+
+	templates := services.DefaultPromptTemplates()
+	files := []*services.ReceiptFile{{Data: []byte("receipt"), MIMEType: "image/jpeg"}}
+
+	prompt, err := templates.Render(services.DefaultPrompt, 1, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	corrected, err := templates.Render(services.DefaultPrompt, 1, &services.Correction{Problem: "mismatch"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	flash := &countingParser{model: "flash"}
+	parser := parsecache.Wrap(flash, store)
+	for i := 0; i < 2; i++ {
+		items, summary, err := parser.ParseReceipt(ctx, files, prompt)
+		if err != nil {
+			t.Fatalf("ParseReceipt: %v", err)
+		}
+
+		if len(items) != 1 || items[0].Name != "Corn" || summary.Total != 9 {
+			t.Fatalf("unexpected receipt: %+v %+v", items, summary)
+		}
+	}
+
+	if flash.calls != 1 {
+		t.Errorf("expected the second parse to hit the cache, got %d calls", flash.calls)
+	}
+
+	// a re-prompt, another model or another photo is a miss
+	parser.ParseReceipt(ctx, files, corrected)
+	parser.ParseReceipt(ctx, []*services.ReceiptFile{{Data: []byte("other"), MIMEType: "image/jpeg"}}, prompt)
+
+	pro := &countingParser{model: "pro"}
+	parsecache.Wrap(pro, store).ParseReceipt(ctx, files, prompt)
+
+	if flash.calls != 3 || pro.calls != 1 {
+		t.Errorf("expected misses for new inputs, got %d flash and %d pro calls", flash.calls, pro.calls)
+	}
+
+	// invalidating a receipt's files drops all of its answers
+	entries, err := store.Find(services.StubReceiptKey(files))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(entries) != 3 {
+		t.Fatalf("expected 3 entries for the receipt, got %d", len(entries))
+	}
+
+	if err := store.Delete(entries...); err != nil {
+		t.Fatal(err)
+	}
+
+	parser.ParseReceipt(ctx, files, prompt)
+	if flash.calls != 4 {
+		t.Errorf("expected a miss after invalidation, got %d calls", flash.calls)
+	}
+}
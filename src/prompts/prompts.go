@@ -0,0 +1,13 @@
+// Package prompts holds the receipt prompt templates built into the binary.
+//
+// Templates are named <name>.v<version>.tmpl and the highest version of each
+// name is used. "default" is used for every receipt without a vendor override;
+// any other name is a vendor override, selected when the name appears in the
+// bank description or the vendor read from the receipt, ignoring case and
+// punctuation (e.g. restaurant-depot matches "RESTAURANT DEPOT #12").
+package prompts
+
+import "embed"
+
+//go:embed *.tmpl
+var FS embed.FS
@@ -0,0 +1,185 @@
+package schema
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strconv"
+
+	"github.com/jiaming2012/receipt-bot/src/models"
+)
+
+// ProvisionResult lists the tables and fields ("Table.Field") Provision created.
+type ProvisionResult struct {
+	TableIDs      map[string]string
+	CreatedTables []string
+	CreatedFields []string
+}
+
+// Provision creates every registered table that has no configured table ID in
+// the database, then adds any fields the models read that the tables lack.
+// The client must be authenticated with a user JWT (see models.WithJWT), and
+// its TableIDs are updated with the IDs of the created tables. Running it
+// again against a provisioned database is a no-op.
+//
+// Link-row fields that declare a related field are created together with
+// their reverse side, which is named after the related option, so that e.g.
+// Purchase.PendingPurchases and PendingPurchases.Purchase are one link.
+func Provision(ctx context.Context, client *models.BaserowClient, databaseID int) (*ProvisionResult, error) {
+	tables := models.BaserowTables()
+	if client.TableIDs == nil {
+		client.TableIDs = make(map[string]string)
+	}
+
+	// TableIDs is the client's map, so tables created before a failure are
+	// still reported
+	result := &ProvisionResult{TableIDs: client.TableIDs}
+	for _, name := range models.BaserowTableNames {
+		if _, err := client.TableIDByName(name); err == nil {
+			continue
+		}
+
+		primary, err := primaryField(tables[name])
+		if err != nil {
+			return result, fmt.Errorf("schema.Provision: table %s: %w", name, err)
+		}
+
+		table, err := client.CreateTable(ctx, databaseID, name, primary)
+		if err != nil {
+			return result, fmt.Errorf("schema.Provision: failed to create table %s: %w", name, err)
+		}
+
+		client.TableIDs[name] = strconv.Itoa(table.ID)
+		result.CreatedTables = append(result.CreatedTables, name)
+	}
+
+	// every table exists before any field is created, so links can be resolved
+	existing := make(map[string]map[string]bool)
+	for _, name := range models.BaserowTableNames {
+		fields, err := client.ListFields(ctx, name)
+		if err != nil {
+			return result, fmt.Errorf("schema.Provision: failed to list fields of table %s: %w", name, err)
+		}
+
+		existing[name] = make(map[string]bool)
+		for _, f := range fields {
+			existing[name][f.Name] = true
+		}
+	}
+
+	for _, name := range models.BaserowTableNames {
+		for _, e := range models.DescribeFields(tables[name]) {
+			if existing[name][e.Name] {
+				continue
+			}
+
+			req, err := fieldRequest(client, e)
+			if err != nil {
+				return result, fmt.Errorf("schema.Provision: field %s.%s: %w", name, e.Name, err)
+			}
+
+			created, err := client.CreateField(ctx, name, req)
+			if err != nil {
+				return result, fmt.Errorf("schema.Provision: failed to create field %s.%s: %w", name, e.Name, err)
+			}
+
+			existing[name][e.Name] = true
+			result.CreatedFields = append(result.CreatedFields, name+"."+e.Name)
+
+			related := e.Options["related"]
+			if related == "" {
+				continue
+			}
+
+			target := e.Options["table"]
+			for _, rf := range created.RelatedFields {
+				if rf.Name != related {
+					if _, err := client.UpdateField(ctx, rf.ID, map[string]interface{}{"name": related}); err != nil {
+						return result, fmt.Errorf("schema.Provision: failed to rename field %s.%s to %s: %w", target, rf.Name, related, err)
+					}
+				}
+
+				existing[target][related] = true
+				result.CreatedFields = append(result.CreatedFields, target+"."+related)
+			}
+		}
+	}
+
+	return result, nil
+}
+
+// primaryField returns the name of the first field the model reads, which
+// becomes the table's primary field.
+func primaryField(data models.BaserowData) (string, error) {
+	fields := models.DescribeFields(data)
+	if len(fields) == 0 {
+		return "", fmt.Errorf("%T declares no fields", data)
+	}
+
+	return fields[0].Name, nil
+}
+
+// fieldRequest builds the Baserow field definition for a model field from its
+// Go type and baserow tag options.
+func fieldRequest(client *models.BaserowClient, e models.FieldDescription) (map[string]interface{}, error) {
+	req := map[string]interface{}{"name": e.Name}
+
+	t := e.GoType
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch {
+	case e.Kind == "link" || e.Kind == "link_id" || t == reflect.TypeOf([]models.LinkedItem{}):
+		target := e.Options["table"]
+		if target == "" {
+			return nil, fmt.Errorf("link-row field has no table option")
+		}
+
+		tableID, err := client.TableIDByName(target)
+		if err != nil {
+			return nil, err
+		}
+
+		id, err := strconv.Atoi(tableID)
+		if err != nil {
+			return nil, fmt.Errorf("invalid table ID %q for table %s", tableID, target)
+		}
+
+		req["type"] = "link_row"
+		req["link_row_table_id"] = id
+		req["has_related_field"] = e.Options["related"] != ""
+
+	case e.Options["type"] != "":
+		req["type"] = e.Options["type"]
+		if e.Options["type"] == "date" {
+			req["date_format"] = "ISO"
+			req["date_include_time"] = true
+		}
+
+	case e.Kind == "decimal" || t.Kind() == reflect.Int || t.Kind() == reflect.Int64 || t.Kind() == reflect.Float64:
+		places := 0
+		if t.Kind() == reflect.Float64 {
+			places = 2
+		}
+
+		if decimals, ok := e.Options["decimals"]; ok {
+			var err error
+			if places, err = strconv.Atoi(decimals); err != nil {
+				return nil, fmt.Errorf("invalid decimals option %q", decimals)
+			}
+		}
+
+		req["type"] = "number"
+		req["number_decimal_places"] = places
+		req["number_negative"] = true
+
+	case t.Kind() == reflect.Bool:
+		req["type"] = "boolean"
+
+	default:
+		req["type"] = "text"
+	}
+
+	return req, nil
+}
@@ -0,0 +1,211 @@
+package schema
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/antzucaro/matchr"
+
+	"github.com/jiaming2012/receipt-bot/src/models"
+)
+
+type ProblemKind string
+
+const (
+	ProblemUnconfigured ProblemKind = "unconfigured"
+	ProblemMissing      ProblemKind = "missing"
+	ProblemRenamed      ProblemKind = "renamed"
+	ProblemMistyped     ProblemKind = "mistyped"
+)
+
+type Problem struct {
+	Table   string
+	Field   string
+	Kind    ProblemKind
+	Message string
+}
+
+func (p Problem) String() string {
+	if p.Field == "" {
+		return fmt.Sprintf("[%s] %s: %s", p.Kind, p.Table, p.Message)
+	}
+	return fmt.Sprintf("[%s] %s.%s: %s", p.Kind, p.Table, p.Field, p.Message)
+}
+
+// Report lists the differences between the Go models and the live tables.
+// Unconfigured tables are reported but do not fail verification, since not
+// every tenant uses every table.
+type Report struct {
+	Tables   []string
+	Problems []Problem
+}
+
+func (r *Report) OK() bool {
+	for _, p := range r.Problems {
+		if p.Kind != ProblemUnconfigured {
+			return false
+		}
+	}
+	return true
+}
+
+func (r *Report) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "checked %d tables: %s\n", len(r.Tables), strings.Join(r.Tables, ", "))
+	if len(r.Problems) == 0 {
+		b.WriteString("no problems found\n")
+	}
+	for _, p := range r.Problems {
+		b.WriteString(p.String())
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
+
+// Verify fetches the fields of every registered table from Baserow and
+// compares them against the models.
+func Verify(ctx context.Context, client *models.BaserowClient) (*Report, error) {
+	tables := models.BaserowTables()
+
+	names := make([]string, 0, len(tables))
+	for name := range tables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	report := &Report{}
+	for _, name := range names {
+		if _, err := client.TableIDByName(name); err != nil {
+			report.Problems = append(report.Problems, Problem{Table: name, Kind: ProblemUnconfigured, Message: err.Error()})
+			continue
+		}
+
+		fields, err := client.ListFields(ctx, name)
+		if err != nil {
+			return nil, fmt.Errorf("schema.Verify: failed to list fields of table %s: %w", name, err)
+		}
+
+		report.Tables = append(report.Tables, name)
+		report.Problems = append(report.Problems, CompareTable(name, tables[name], fields)...)
+	}
+
+	return report, nil
+}
+
+// CompareTable reports fields that data's struct type reads but that are
+// missing from, or have an incompatible type in, the live fields.
+func CompareTable(tableName string, data models.BaserowData, fields []models.BaserowField) []Problem {
+	actual := make(map[string]models.BaserowField)
+	for _, f := range fields {
+		actual[f.Name] = f
+	}
+
+	expected := models.DescribeFields(data)
+	expectedNames := make(map[string]bool)
+	for _, e := range expected {
+		expectedNames[e.Name] = true
+	}
+
+	var problems []Problem
+	for _, e := range expected {
+		f, ok := actual[e.Name]
+		if !ok {
+			if renamed, found := closestUnexpected(e.Name, fields, expectedNames); found {
+				problems = append(problems, Problem{
+					Table:   tableName,
+					Field:   e.Name,
+					Kind:    ProblemRenamed,
+					Message: fmt.Sprintf("field not found; was it renamed to %q?", renamed),
+				})
+			} else {
+				problems = append(problems, Problem{
+					Table:   tableName,
+					Field:   e.Name,
+					Kind:    ProblemMissing,
+					Message: "field not found",
+				})
+			}
+			continue
+		}
+
+		allowed := compatibleTypes(e)
+		if !contains(allowed, f.Type) {
+			problems = append(problems, Problem{
+				Table:   tableName,
+				Field:   e.Name,
+				Kind:    ProblemMistyped,
+				Message: fmt.Sprintf("field has type %q, expected one of: %s", f.Type, strings.Join(allowed, ", ")),
+			})
+		}
+	}
+
+	return problems
+}
+
+// closestUnexpected finds the live field, not read by the model, whose name is
+// most similar to name.
+func closestUnexpected(name string, fields []models.BaserowField, expectedNames map[string]bool) (string, bool) {
+	var best string
+	highestScore := 0.0
+	for _, f := range fields {
+		if expectedNames[f.Name] {
+			continue
+		}
+
+		score := matchr.JaroWinkler(strings.ToLower(name), strings.ToLower(f.Name), true)
+		if score > highestScore {
+			highestScore = score
+			best = f.Name
+		}
+	}
+
+	return best, highestScore >= 0.85
+}
+
+var (
+	// read-only field types that may stand in for any plain value
+	computedTypes = []string{"formula", "lookup", "rollup"}
+	textTypes     = []string{"text", "long_text", "url", "email", "phone_number", "date", "single_select", "rich_text", "uuid", "autonumber", "created_on", "last_modified"}
+	numberTypes   = []string{"number", "count", "autonumber"}
+)
+
+func compatibleTypes(e models.FieldDescription) []string {
+	switch e.Kind {
+	case "link", "link_id":
+		return []string{"link_row"}
+	case "decimal":
+		return append(append([]string{}, numberTypes...), computedTypes...)
+	}
+
+	t := e.GoType
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	if t == reflect.TypeOf([]models.LinkedItem{}) {
+		return []string{"link_row"}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return append([]string{"boolean"}, computedTypes...)
+	case reflect.Int, reflect.Int64, reflect.Float64:
+		return append(append([]string{}, numberTypes...), computedTypes...)
+	case reflect.String:
+		return append(append([]string{}, textTypes...), computedTypes...)
+	}
+
+	return computedTypes
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,93 @@
+package schema_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/jiaming2012/receipt-bot/src/fakes"
+	"github.com/jiaming2012/receipt-bot/src/models"
+	"github.com/jiaming2012/receipt-bot/src/schema"
+)
+
+func TestProvisionCreatesTablesMatchingTheModels(t *testing.T) {
+	ctx := context.Background()
+	fake := fakes.NewEmptyBaserow(t)
+
+	client := models.NewBaserowClient(fake.Server.URL, "", models.WithJWT(fakes.FakeBaserowJWT))
+	result, err := schema.Provision(ctx, client, fakes.FakeBaserowDatabaseID)
+	if err != nil {
+		t.Fatalf("Provision: %v", err)
+	}
+
+	if len(result.CreatedTables) != len(models.BaserowTableNames) {
+		t.Errorf("expected %d tables to be created, got %v", len(models.BaserowTableNames), result.CreatedTables)
+	}
+
+	report, err := schema.Verify(ctx, fake.Client())
+	if err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+
+	if len(report.Problems) != 0 {
+		t.Errorf("expected a provisioned database to verify cleanly, got:\n%s", report)
+	}
+
+	// the reverse side of a related link is named after the related option
+	fields, err := fake.Client().ListFields(ctx, models.BaserowPendingPurchasesTableName)
+	if err != nil {
+		t.Fatalf("ListFields: %v", err)
+	}
+
+	var purchaseLink *models.BaserowField
+	for i := range fields {
+		if fields[i].Name == "Purchase" {
+			purchaseLink = &fields[i]
+		}
+	}
+
+	if purchaseLink == nil || purchaseLink.Type != "link_row" {
+		t.Fatalf("expected PendingPurchases.Purchase to be a link-row field, got %+v", fields)
+	}
+
+	again, err := schema.Provision(ctx, client, fakes.FakeBaserowDatabaseID)
+	if err != nil {
+		t.Fatalf("Provision (rerun): %v", err)
+	}
+
+	if len(again.CreatedTables) != 0 || len(again.CreatedFields) != 0 {
+		t.Errorf("expected rerunning Provision to be a no-op, got %+v", again)
+	}
+}
+
+func TestVerifyDetectsRenamedFields(t *testing.T) {
+	ctx := context.Background()
+	fake := fakes.NewBaserow(t)
+
+	client := fake.Client()
+	fields, err := client.ListFields(ctx, models.BaserowPendingPurchasesTableName)
+	if err != nil {
+		t.Fatalf("ListFields: %v", err)
+	}
+
+	admin := fake.Client(models.WithJWT(fakes.FakeBaserowJWT))
+	for _, f := range fields {
+		if f.Name == "Receipt URL" {
+			if _, err := admin.UpdateField(ctx, f.ID, map[string]interface{}{"name": "Receipt Link"}); err != nil {
+				t.Fatalf("UpdateField: %v", err)
+			}
+		}
+	}
+
+	report, err := schema.Verify(ctx, client)
+	if err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+
+	if report.OK() {
+		t.Fatalf("expected the renamed field to fail verification")
+	}
+
+	if len(report.Problems) != 1 || report.Problems[0].Kind != schema.ProblemRenamed || report.Problems[0].Field != "Receipt URL" {
+		t.Errorf("expected a single rename problem for Receipt URL, got:\n%s", report)
+	}
+}
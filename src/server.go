@@ -0,0 +1,241 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os/signal"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/jiaming2012/receipt-bot/src/models"
+	"github.com/jiaming2012/receipt-bot/src/services"
+)
+
+const (
+	defaultTransactionsDays = 7
+	defaultIngestDays       = 14
+	shutdownTimeout         = 30 * time.Second
+)
+
+type Server struct {
+	reader        *services.ReceiptReader
+	tenants       map[string]*TenantClients
+	defaultTenant string
+	username      string
+	password      string
+
+	// ingestMu prevents concurrent pipeline runs from creating duplicate rows
+	ingestMu sync.Mutex
+
+	// jobs are the running /demo ingests, which jobsCtx cancels on shutdown
+	jobs       sync.WaitGroup
+	jobsCtx    context.Context
+	cancelJobs context.CancelFunc
+	demoMu     sync.Mutex
+	demoSeq    int
+	demoJobs   map[string]*demoJob
+	demoOrder  []string
+
+	webhookJobs   chan webhookJob
+	webhookMu     sync.Mutex
+	webhookQueued map[webhookJob]bool
+}
+
+type TransactionsResponse struct {
+	Tenant              string                       `json:"tenant"`
+	Start               string                       `json:"start"`
+	End                 string                       `json:"end"`
+	ValidTransactions   []*models.MercuryTransaction `json:"valid_transactions"`
+	InvalidTransactions []*models.MercuryTransaction `json:"invalid_transactions"`
+	Error               string                       `json:"error,omitempty"`
+}
+
+type IngestResponse struct {
+	Tenant string        `json:"tenant"`
+	Start  string        `json:"start"`
+	End    string        `json:"end"`
+	Result *IngestResult `json:"result,omitempty"`
+	Error  string        `json:"error,omitempty"`
+}
+
+type ErrorResponse struct {
+	Error string `json:"error"`
+}
+
+func NewServer(reader *services.ReceiptReader, tenants map[string]*TenantClients, defaultTenant, username, password string) *Server {
+	jobsCtx, cancelJobs := context.WithCancel(context.Background())
+
+	return &Server{
+		reader:        reader,
+		tenants:       tenants,
+		defaultTenant: defaultTenant,
+		username:      username,
+		password:      password,
+		jobsCtx:       jobsCtx,
+		cancelJobs:    cancelJobs,
+		demoJobs:      make(map[string]*demoJob),
+		webhookJobs:   make(chan webhookJob, webhookQueueSize),
+		webhookQueued: make(map[webhookJob]bool),
+	}
+}
+
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /health", s.handleHealth)
+	mux.Handle("GET /transactions", s.basicAuth(http.HandlerFunc(s.handleTransactions)))
+	mux.Handle("GET /demo", s.basicAuth(http.HandlerFunc(s.handleDemo)))
+	mux.Handle("GET /demo/{id}", s.basicAuth(http.HandlerFunc(s.handleDemoStatus)))
+	mux.HandleFunc("POST /webhooks/mercury", s.handleMercuryWebhook)
+	return mux
+}
+
+// ListenAndServe blocks until ctx is cancelled or SIGINT/SIGTERM is received,
+// then drains in-flight requests and /demo jobs before returning. Jobs still
+// running after shutdownTimeout are cancelled.
+func (s *Server) ListenAndServe(ctx context.Context, addr string) error {
+	ctx, stop := signal.NotifyContext(ctx, syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	srv := &http.Server{
+		Addr:              addr,
+		Handler:           s.Handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	go s.runWebhookWorker(ctx)
+
+	errCh := make(chan error, 1)
+	go func() {
+		log.Infof("Listening on %s", addr)
+		errCh <- srv.ListenAndServe()
+	}()
+
+	select {
+	case err := <-errCh:
+		return fmt.Errorf("ListenAndServe: %w", err)
+	case <-ctx.Done():
+	}
+
+	log.Info("Shutting down server")
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	shutdownErr := srv.Shutdown(shutdownCtx)
+	s.waitForJobs(shutdownCtx)
+
+	if shutdownErr != nil {
+		return fmt.Errorf("ListenAndServe: failed to shut down gracefully: %w", shutdownErr)
+	}
+
+	if err := <-errCh; err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("ListenAndServe: %w", err)
+	}
+
+	return nil
+}
+
+func (s *Server) basicAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		username, password, ok := r.BasicAuth()
+		usernameMatch := subtle.ConstantTimeCompare([]byte(username), []byte(s.username)) == 1
+		passwordMatch := subtle.ConstantTimeCompare([]byte(password), []byte(s.password)) == 1
+
+		if !ok || !usernameMatch || !passwordMatch {
+			w.Header().Set("WWW-Authenticate", `Basic realm="receipt-bot", charset="UTF-8"`)
+			writeJSON(w, http.StatusUnauthorized, ErrorResponse{Error: "unauthorized"})
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// tenant returns the tenant selected by the ?tenant= query parameter, or the
+// default tenant.
+func (s *Server) tenant(r *http.Request) (*TenantClients, error) {
+	name := r.URL.Query().Get("tenant")
+	if name == "" {
+		name = s.defaultTenant
+	}
+
+	tenant, ok := s.tenants[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown tenant %q", name)
+	}
+
+	return tenant, nil
+}
+
+func (s *Server) handleTransactions(w http.ResponseWriter, r *http.Request) {
+	tenant, err := s.tenant(r)
+	if err != nil {
+		writeJSON(w, http.StatusNotFound, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	days, err := parseDays(r, defaultTransactionsDays)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	end := time.Now()
+	start := end.AddDate(0, 0, -days)
+
+	validTx, invalidTx, err := tenant.BankClient.FetchReceipts(r.Context(), start, end)
+
+	resp := TransactionsResponse{
+		Tenant:              tenant.Name,
+		Start:               start.Format(time.DateOnly),
+		End:                 end.Format(time.DateOnly),
+		ValidTransactions:   validTx,
+		InvalidTransactions: invalidTx,
+	}
+
+	// FetchReceipts reports transactions missing receipts as an error, which is
+	// informational here; only a failure to reach the bank is fatal.
+	if err != nil {
+		resp.Error = err.Error()
+		if validTx == nil && invalidTx == nil {
+			writeJSON(w, http.StatusBadGateway, resp)
+			return
+		}
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func parseDays(r *http.Request, defaultDays int) (int, error) {
+	daysStr := r.URL.Query().Get("days")
+	if daysStr == "" {
+		return defaultDays, nil
+	}
+
+	days, err := strconv.Atoi(daysStr)
+	if err != nil || days <= 0 {
+		return 0, fmt.Errorf("days must be a positive integer, got %q", daysStr)
+	}
+
+	return days, nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		log.Errorf("Failed to write JSON response: %v", err)
+	}
+}
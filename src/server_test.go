@@ -0,0 +1,615 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jiaming2012/receipt-bot/src/fakes"
+	"github.com/jiaming2012/receipt-bot/src/models"
+	"github.com/jiaming2012/receipt-bot/src/services"
+)
+
+func newTestServer(t *testing.T) (*Server, *fakes.Mercury) {
+	t.Helper()
+
+	bank := fakes.NewMercury(t, "")
+	tenants := map[string]*TenantClients{
+		"main": {
+			Name:          "main",
+			BaserowClient: fakes.NewBaserow(t).Client(),
+			BankClient:    bank.Client(),
+			WebhookSecret: "whsec",
+		},
+	}
+
+	return NewServer(nil, tenants, "main", "admin", "secret"), bank
+}
+
+func TestTransactionsRequiresBasicAuth(t *testing.T) {
+	server, _ := newTestServer(t)
+
+	rec := httptest.NewRecorder()
+	server.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/transactions", nil))
+
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401, got %d", rec.Code)
+	}
+}
+
+func TestTransactionsReportsMissingReceipts(t *testing.T) {
+	server, bank := newTestServer(t)
+
+	now := time.Now().UTC()
+	bank.AddTransactions(
+		&models.MercuryTransaction{ID: "tx-1", CreatedAt: now.Format(time.RFC3339), Note: "cash"},
+		&models.MercuryTransaction{ID: "tx-2", CreatedAt: now.Format(time.RFC3339)},
+		&models.MercuryTransaction{ID: "tx-old", CreatedAt: now.AddDate(0, 0, -30).Format(time.RFC3339)},
+	)
+
+	req := httptest.NewRequest(http.MethodGet, "/transactions?days=7", nil)
+	req.SetBasicAuth("admin", "secret")
+
+	rec := httptest.NewRecorder()
+	server.Handler().ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body)
+	}
+
+	var resp TransactionsResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(resp.ValidTransactions) != 1 || resp.ValidTransactions[0].ID != "tx-1" {
+		t.Errorf("expected tx-1 to be valid, got %v", resp.ValidTransactions)
+	}
+
+	if len(resp.InvalidTransactions) != 1 || resp.InvalidTransactions[0].ID != "tx-2" {
+		t.Errorf("expected tx-2 to be invalid, got %v", resp.InvalidTransactions)
+	}
+
+	if resp.Error == "" {
+		t.Errorf("expected the missing receipt to be reported in error")
+	}
+}
+
+// blockingParser waits for its context to be cancelled.
+type blockingParser struct{ services.StubParser }
+
+func (p *blockingParser) ParseReceipt(ctx context.Context, files []*services.ReceiptFile, prompt *services.Prompt) ([]models.ReceiptItem, models.ReceiptSummary, error) {
+	<-ctx.Done()
+	return nil, models.ReceiptSummary{}, ctx.Err()
+}
+
+func demoRequest(t *testing.T, server *Server, path string) (int, demoJob) {
+	t.Helper()
+
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	req.SetBasicAuth("admin", "secret")
+
+	rec := httptest.NewRecorder()
+	server.Handler().ServeHTTP(rec, req)
+
+	var job demoJob
+	json.NewDecoder(rec.Body).Decode(&job)
+	return rec.Code, job
+}
+
+func TestDemoRunsIngestInTheBackground(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "attachments"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "attachments", "tx-1-0.jpg"), []byte("\xff\xd8\xff\xe0\x00\x10JFIF\x00"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	bank := fakes.NewMercury(t, dir)
+	bank.AddTransactions(&models.MercuryTransaction{
+		ID:          "tx-1",
+		Amount:      -91.5,
+		CreatedAt:   time.Now().UTC().Format(time.RFC3339),
+		Attachments: []*models.MercuryTransactionAttachment{{FileName: "receipt.jpg", URL: "attachments/tx-1-0.jpg"}},
+	})
+
+	tenants := map[string]*TenantClients{
+		"main": {Name: "main", BaserowClient: fakes.NewBaserow(t).Client(), BankClient: bank.Client()},
+	}
+	server := NewServer(services.NewReceiptReader(&blockingParser{}), tenants, "main", "admin", "secret")
+
+	code, job := demoRequest(t, server, "/demo")
+	if code != http.StatusAccepted || job.ID == "" || job.Status != demoJobRunning {
+		t.Fatalf("expected a running job, got %d %+v", code, job)
+	}
+
+	if code, _ := demoRequest(t, server, "/demo"); code != http.StatusConflict {
+		t.Errorf("expected a second run to be refused while the first is running, got %d", code)
+	}
+
+	if code, status := demoRequest(t, server, "/demo/"+job.ID); code != http.StatusOK || status.Status != demoJobRunning {
+		t.Errorf("expected the job to be running, got %d %+v", code, status)
+	}
+
+	// shutdown cancels a job that outlasts its timeout
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	server.waitForJobs(ctx)
+
+	if _, status := demoRequest(t, server, "/demo/"+job.ID); status.Status != demoJobFailed || status.Error == "" {
+		t.Errorf("expected the cancelled job to have failed, got %+v", status)
+	}
+
+	if code, _ := demoRequest(t, server, "/demo/unknown"); code != http.StatusNotFound {
+		t.Errorf("expected 404 for an unknown job, got %d", code)
+	}
+}
+
+func webhookRequest(t *testing.T, secret string, event models.MercuryWebhookEvent) *http.Request {
+	t.Helper()
+
+	body, err := json.Marshal(event)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/webhooks/mercury", bytes.NewReader(body))
+	req.Header.Set(services.MercurySignatureHeader, services.SignMercuryWebhook(secret, body, time.Now()))
+	return req
+}
+
+func TestMercuryWebhookRejectsInvalidSignatures(t *testing.T) {
+	server, _ := newTestServer(t)
+
+	rec := httptest.NewRecorder()
+	server.Handler().ServeHTTP(rec, webhookRequest(t, "wrong", models.MercuryWebhookEvent{ResourceType: "transaction", ResourceID: "tx-1"}))
+
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401, got %d", rec.Code)
+	}
+
+	if len(server.webhookJobs) != 0 {
+		t.Errorf("expected nothing to be queued")
+	}
+}
+
+func TestMercuryWebhookQueuesTransactionsOnce(t *testing.T) {
+	server, _ := newTestServer(t)
+
+	for _, event := range []models.MercuryWebhookEvent{
+		{ResourceType: "transaction", ResourceID: "tx-1", OperationType: "created"},
+		{ResourceType: "transaction", ResourceID: "tx-1", OperationType: "updated"},
+		{ResourceType: "account", ResourceID: "acct-1", OperationType: "updated"},
+	} {
+		rec := httptest.NewRecorder()
+		server.Handler().ServeHTTP(rec, webhookRequest(t, "whsec", event))
+
+		if rec.Code != http.StatusAccepted && rec.Code != http.StatusOK {
+			t.Fatalf("expected the %s event to be acknowledged, got %d: %s", event.ResourceType, rec.Code, rec.Body)
+		}
+	}
+
+	if got := len(server.webhookJobs); got != 1 {
+		t.Errorf("expected tx-1 to be queued once, got %d jobs", got)
+	}
+}
+
+func TestIngestTransactionSkipsProcessedAndIncompleteTransactions(t *testing.T) {
+	server, bank := newTestServer(t)
+	tenant := server.tenants["main"]
+
+	now := time.Now().UTC().Format(time.RFC3339)
+	bank.AddTransactions(
+		&models.MercuryTransaction{ID: "tx-done", CreatedAt: now, Attachments: []*models.MercuryTransactionAttachment{{URL: "attachments/receipt.jpg"}}},
+		&models.MercuryTransaction{ID: "tx-waiting", CreatedAt: now},
+	)
+
+	if err := tenant.BaserowClient.CreateRow(context.Background(), &models.BaserowPurchaseEventTable{BankTxID: "tx-done"}); err != nil {
+		t.Fatal(err)
+	}
+
+	reader := services.NewReceiptReader(&services.StubParser{Err: errors.New("parser should not be called")})
+	for _, txID := range []string{"tx-done", "tx-waiting"} {
+		result, err := run_ingest_transaction(context.Background(), reader, tenant, "", txID)
+		if err != nil {
+			t.Fatalf("%s: %v", txID, err)
+		}
+
+		if result.PurchaseEventsCreated+result.PendingPurchasesCreated != 0 {
+			t.Errorf("%s: expected nothing to be created, got %+v", txID, *result)
+		}
+	}
+}
+
+func TestIngestTransactionRoutesUnsupportedReceiptsToReview(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "attachments"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "attachments", "tx-zip-0.zip"), []byte("PK\x03\x04\x14\x00"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	bank := fakes.NewMercury(t, dir)
+	baserow := fakes.NewBaserow(t)
+	tenant := &TenantClients{Name: "main", BaserowClient: baserow.Client(), BankClient: bank.Client()}
+
+	bank.AddTransactions(&models.MercuryTransaction{
+		ID:          "tx-zip",
+		Amount:      -42,
+		CreatedAt:   time.Now().UTC().Format(time.RFC3339),
+		Attachments: []*models.MercuryTransactionAttachment{{FileName: "receipts.zip", URL: "attachments/tx-zip-0.zip"}},
+	})
+
+	reader := services.NewReceiptReader(&services.StubParser{Err: errors.New("parser should not be called")})
+	result, err := run_ingest_transaction(context.Background(), reader, tenant, "", "tx-zip")
+	if err != nil {
+		t.Fatalf("run_ingest_transaction: %v", err)
+	}
+
+	if result.PendingPurchasesCreated != 1 {
+		t.Fatalf("expected a pending purchase for review, got %+v", *result)
+	}
+
+	rows := baserow.Rows(models.BaserowPendingPurchasesTableName)
+	if len(rows) != 1 || !strings.Contains(fmt.Sprint(rows[0]["Reason"]), "unsupported receipt attachment") {
+		t.Errorf("expected the pending purchase to explain the unsupported attachment, got %v", rows)
+	}
+}
+
+func TestFailedDownloadsAreReadAgain(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "attachments"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "attachments", "tx-good-0.jpg"), []byte("\xff\xd8\xff\xe0\x00\x10JFIF\x00"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	bank := fakes.NewMercury(t, dir)
+	baserow := fakes.NewBaserow(t)
+
+	now := time.Now().UTC()
+	bank.AddTransactions(
+		&models.MercuryTransaction{
+			ID:          "tx-missing",
+			Amount:      -20,
+			CreatedAt:   now.Format(time.RFC3339),
+			Attachments: []*models.MercuryTransactionAttachment{{FileName: "receipt.jpg", URL: "attachments/tx-missing-0.jpg"}},
+		},
+		&models.MercuryTransaction{
+			ID:          "tx-good",
+			Amount:      -91.5,
+			CreatedAt:   now.Format(time.RFC3339),
+			Attachments: []*models.MercuryTransactionAttachment{{FileName: "receipt.jpg", URL: "attachments/tx-good-0.jpg"}},
+		},
+	)
+
+	reader := services.NewReceiptReader(&services.StubParser{Receipts: map[string]models.Receipt{
+		"*": {
+			Items:   []models.ReceiptItem{{Name: "sweet corn", Quantity: 3, Price: 30.5}},
+			Summary: models.ReceiptSummary{Vendor: "Restaurant Depot", Total: 91.5, TotalUnits: 3},
+		},
+	}})
+
+	result, err := run_ingest_receipts(context.Background(), reader, nil, baserow.Client(), bank.Client(), now.AddDate(0, 0, -1), now.AddDate(0, 0, 1))
+	if err != nil {
+		t.Fatalf("run_ingest_receipts: %v", err)
+	}
+
+	if result.PendingPurchasesCreated != 1 || result.PurchaseEventsCreated != 1 {
+		t.Fatalf("expected the failed download to be paused and the other receipt written, got %+v", *result)
+	}
+
+	rows := baserow.Rows(models.BaserowPendingPurchasesTableName)
+	if len(rows) != 1 || rows[0]["Bank Tx ID"] != "tx-missing" || !strings.HasPrefix(fmt.Sprint(rows[0]["Reason"]), attachmentRetryReason) {
+		t.Fatalf("expected the pending purchase to explain the failed download, got %v", rows)
+	}
+
+	// a run while the download still fails keeps the paused row
+	if _, err := run_ingest_receipts(context.Background(), reader, nil, baserow.Client(), bank.Client(), now.AddDate(0, 0, -1), now.AddDate(0, 0, 1)); err != nil {
+		t.Fatalf("run_ingest_receipts: %v", err)
+	}
+
+	if rows := baserow.Rows(models.BaserowPendingPurchasesTableName); len(rows) != 1 {
+		t.Fatalf("expected the paused row to be kept, got %v", rows)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "attachments", "tx-missing-0.jpg"), []byte("\xff\xd8\xff\xe0\x00\x10JFIF\x00"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	reader = services.NewReceiptReader(&services.StubParser{Receipts: map[string]models.Receipt{
+		"*": {
+			Items:   []models.ReceiptItem{{Name: "limes", Quantity: 4, Price: 5}},
+			Summary: models.ReceiptSummary{Vendor: "Restaurant Depot", Total: 20, TotalUnits: 4},
+		},
+	}})
+
+	result, err = run_ingest_receipts(context.Background(), reader, nil, baserow.Client(), bank.Client(), now.AddDate(0, 0, -1), now.AddDate(0, 0, 1))
+	if err != nil {
+		t.Fatalf("run_ingest_receipts: %v", err)
+	}
+
+	if result.PurchaseEventsCreated != 1 {
+		t.Fatalf("expected the receipt to be read once it downloads, got %+v", *result)
+	}
+
+	if rows := baserow.Rows(models.BaserowPendingPurchasesTableName); len(rows) != 0 {
+		t.Errorf("expected the paused row to be deleted, got %v", rows)
+	}
+}
+
+func TestIngestReceiptsRoutesParseFailuresToReview(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "attachments"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	good, bad := []byte("\xff\xd8\xff\xe0\x00\x10JFIF\x00good"), []byte("\xff\xd8\xff\xe0\x00\x10JFIF\x00bad")
+	if err := os.WriteFile(filepath.Join(dir, "attachments", "tx-good-0.jpg"), good, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "attachments", "tx-bad-0.jpg"), bad, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	bank := fakes.NewMercury(t, dir)
+	baserow := fakes.NewBaserow(t)
+
+	now := time.Now().UTC()
+	bank.AddTransactions(
+		&models.MercuryTransaction{
+			ID:          "tx-bad",
+			Amount:      -20,
+			CreatedAt:   now.Format(time.RFC3339),
+			Attachments: []*models.MercuryTransactionAttachment{{FileName: "receipt.jpg", URL: "attachments/tx-bad-0.jpg"}},
+		},
+		&models.MercuryTransaction{
+			ID:          "tx-good",
+			Amount:      -91.5,
+			CreatedAt:   now.Format(time.RFC3339),
+			Attachments: []*models.MercuryTransactionAttachment{{FileName: "receipt.jpg", URL: "attachments/tx-good-0.jpg"}},
+		},
+	)
+
+	// the stub has no answer for the bad receipt
+	key := services.StubReceiptKey([]*services.ReceiptFile{{Data: good}})
+	reader := services.NewReceiptReader(&services.StubParser{Receipts: map[string]models.Receipt{
+		key: {
+			Items:   []models.ReceiptItem{{Name: "sweet corn", Quantity: 3, Price: 30.5}},
+			Summary: models.ReceiptSummary{Vendor: "Restaurant Depot", Total: 91.5, TotalUnits: 3},
+		},
+	}})
+
+	result, err := run_ingest_receipts(context.Background(), reader, nil, baserow.Client(), bank.Client(), now.AddDate(0, 0, -1), now.AddDate(0, 0, 1))
+	if err != nil {
+		t.Fatalf("run_ingest_receipts: %v", err)
+	}
+
+	if result.PendingPurchasesCreated != 1 || result.PurchaseEventsCreated != 1 {
+		t.Fatalf("expected the failed parse to be left for review and the other receipt written, got %+v", *result)
+	}
+
+	rows := baserow.Rows(models.BaserowPendingPurchasesTableName)
+	if len(rows) != 1 || rows[0]["Bank Tx ID"] != "tx-bad" || !strings.Contains(fmt.Sprint(rows[0]["Reason"]), "StubParser: no receipt") {
+		t.Fatalf("expected the pending purchase to explain the failed parse, got %v", rows)
+	}
+
+	if attempts := fmt.Sprint(rows[0]["Parse Attempts"]); !strings.HasPrefix(attempts, "1. stub (") {
+		t.Errorf("expected the attempt to be logged, got %q", attempts)
+	}
+}
+
+func TestIngestTransactionWritesParsedReceipts(t *testing.T) {
+	bank := fakes.NewMercury(t, "testdata/mercury")
+	baserow := fakes.NewBaserow(t)
+	tenant := &TenantClients{Name: "main", BaserowClient: baserow.Client(), BankClient: bank.Client()}
+
+	reader := services.NewReceiptReader(&services.StubParser{Receipts: map[string]models.Receipt{
+		"*": {
+			Items:   []models.ReceiptItem{{Name: "sweet corn", Quantity: 3, Price: 30.5}},
+			Summary: models.ReceiptSummary{Vendor: "Restaurant Depot", Total: 91.5, TotalUnits: 3},
+		},
+	}})
+
+	result, err := run_ingest_transaction(context.Background(), reader, tenant, "", "tx-1")
+	if err != nil {
+		t.Fatalf("run_ingest_transaction: %v", err)
+	}
+
+	if result.PurchaseEventsCreated != 1 || result.PurchasesCreated != 1 {
+		t.Fatalf("expected a purchase event and a purchase, got %+v", *result)
+	}
+
+	events := baserow.Rows(models.BaserowPurchaseEventTableName)
+	if len(events) != 1 || events[0]["Bank Tx ID"] != "tx-1" {
+		t.Fatalf("expected a purchase event for tx-1, got %v", events)
+	}
+
+	if events[0]["Prompt Version"] != "restaurant-depot.v1" {
+		t.Errorf("expected the Restaurant Depot prompt to be recorded, got %v", events[0]["Prompt Version"])
+	}
+}
+
+// meteredParser answers like its StubParser and reports a fixed token usage
+// for every call.
+type meteredParser struct {
+	*services.StubParser
+	usage services.Usage
+}
+
+func (p *meteredParser) ParseReceipt(ctx context.Context, files []*services.ReceiptFile, prompt *services.Prompt) ([]models.ReceiptItem, models.ReceiptSummary, error) {
+	u := p.usage
+	u.PromptVersion = prompt.Version
+	services.RecordUsage(ctx, u)
+
+	return p.StubParser.ParseReceipt(ctx, files, prompt)
+}
+
+func TestIngestTransactionRecordsAIUsage(t *testing.T) {
+	bank := fakes.NewMercury(t, "testdata/mercury")
+	baserow := fakes.NewBaserow(t)
+	client := baserow.Client()
+	tenant := &TenantClients{Name: "main", BaserowClient: client, BankClient: bank.Client(), AIUsage: newAIUsageTracker(client, 5)}
+
+	reader := services.NewReceiptReader(&meteredParser{
+		StubParser: &services.StubParser{Receipts: map[string]models.Receipt{
+			"*": {
+				Items:   []models.ReceiptItem{{Name: "sweet corn", Quantity: 3, Price: 30.5}},
+				Summary: models.ReceiptSummary{Vendor: "Restaurant Depot", Total: 91.5, TotalUnits: 3},
+			},
+		}},
+		usage: services.Usage{Parser: "gemini/gemini-2.5-flash", InputTokens: 2000, OutputTokens: 400},
+	})
+
+	if _, err := run_ingest_transaction(context.Background(), reader, tenant, "", "tx-1"); err != nil {
+		t.Fatalf("run_ingest_transaction: %v", err)
+	}
+
+	rows := baserow.Rows(models.BaserowAIUsageTableName)
+	if len(rows) != 1 || rows[0]["Bank Tx ID"] != "tx-1" || rows[0]["Prompt Version"] != "restaurant-depot.v1" {
+		t.Fatalf("expected a usage row for tx-1, got %v", rows)
+	}
+
+	var out bytes.Buffer
+	if err := run_ai_usage_report(context.Background(), client, "", 5, &out); err != nil {
+		t.Fatalf("run_ai_usage_report: %v", err)
+	}
+
+	// 2000 input tokens at $0.30/M and 400 output tokens at $2.50/M
+	if !strings.Contains(out.String(), "gemini/gemini-2.5-flash") || !strings.Contains(out.String(), "$0.0016") {
+		t.Errorf("expected the call in the report, got:\n%s", out.String())
+	}
+}
+
+func TestIngestTransactionPausesParsingOverBudget(t *testing.T) {
+	bank := fakes.NewMercury(t, "testdata/mercury")
+	baserow := fakes.NewBaserow(t)
+	client := baserow.Client()
+	tenant := &TenantClients{Name: "main", BaserowClient: client, BankClient: bank.Client(), AIUsage: newAIUsageTracker(client, 5)}
+
+	now := time.Now().UTC()
+	baserow.Seed(models.BaserowAIUsageTableName, map[string]interface{}{
+		"Bank Tx ID": "tx-earlier",
+		"Month":      now.Format(aiUsageMonthLayout),
+		"Parser":     "gemini/gemini-2.5-pro",
+		"Cost":       "5.250000",
+	})
+
+	reader := services.NewReceiptReader(&services.StubParser{Err: errors.New("parser should not be called")})
+	result, err := run_ingest_transaction(context.Background(), reader, tenant, "", "tx-1")
+	if err != nil {
+		t.Fatalf("run_ingest_transaction: %v", err)
+	}
+
+	if result.PendingPurchasesCreated != 1 {
+		t.Fatalf("expected the receipt to be left for review, got %+v", *result)
+	}
+
+	rows := baserow.Rows(models.BaserowPendingPurchasesTableName)
+	if len(rows) != 1 || !strings.HasPrefix(fmt.Sprint(rows[0]["Reason"]), aiBudgetPausedReason) {
+		t.Errorf("expected the pending purchase to explain the budget, got %v", rows)
+	}
+}
+
+func TestBudgetPausedReceiptsAreReadAgain(t *testing.T) {
+	ctx := context.Background()
+	bank := fakes.NewMercury(t, "testdata/mercury")
+	baserow := fakes.NewBaserow(t)
+	client := baserow.Client()
+	tenant := &TenantClients{Name: "main", BaserowClient: client, BankClient: bank.Client(), AIUsage: newAIUsageTracker(client, 5)}
+
+	now := time.Now().UTC()
+	baserow.Seed(models.BaserowAIUsageTableName, map[string]interface{}{
+		"Bank Tx ID": "tx-earlier",
+		"Month":      now.Format(aiUsageMonthLayout),
+		"Cost":       "4.000000",
+	})
+
+	corn := []models.ReceiptItem{{Name: "sweet corn", Quantity: 3, Price: 30.5}}
+
+	// the first answer fails validation and its $1.25 call uses up the
+	// budget, so the re-prompt is never sent
+	expensive := services.NewReceiptReader(&meteredParser{
+		StubParser: &services.StubParser{Receipts: map[string]models.Receipt{
+			"*": {Items: corn, Summary: models.ReceiptSummary{Vendor: "Restaurant Depot", Total: 50, TotalUnits: 3}},
+		}},
+		usage: services.Usage{Parser: "gemini/gemini-2.5-pro", InputTokens: 1_000_000},
+	})
+
+	if _, err := run_ingest_transaction(ctx, expensive, tenant, "", "tx-1"); err != nil {
+		t.Fatalf("run_ingest_transaction: %v", err)
+	}
+
+	if calls := len(baserow.Rows(models.BaserowAIUsageTableName)); calls != 2 {
+		t.Fatalf("expected one call before the budget ran out, got %d usage rows", calls-1)
+	}
+
+	pending := baserow.Rows(models.BaserowPendingPurchasesTableName)
+	if len(pending) != 1 || !strings.HasPrefix(fmt.Sprint(pending[0]["Reason"]), aiBudgetPausedReason) {
+		t.Fatalf("expected the receipt to be paused, got %v", pending)
+	}
+
+	// with a higher budget the next run reads it again, even though it is
+	// outside the window being ingested
+	tenant.AIUsage = newAIUsageTracker(client, 10)
+	reader := services.NewReceiptReader(&services.StubParser{Receipts: map[string]models.Receipt{
+		"*": {Items: corn, Summary: models.ReceiptSummary{Vendor: "Restaurant Depot", Total: 91.5, TotalUnits: 3}},
+	}})
+
+	result, err := run_ingest_receipts(ctx, reader, tenant.AIUsage, client, tenant.BankClient, now.AddDate(0, 0, -1), now)
+	if err != nil {
+		t.Fatalf("run_ingest_receipts: %v", err)
+	}
+
+	if result.PurchaseEventsCreated != 1 {
+		t.Fatalf("expected the paused receipt to be written, got %+v", *result)
+	}
+
+	if pending := baserow.Rows(models.BaserowPendingPurchasesTableName); len(pending) != 0 {
+		t.Errorf("expected the paused pending purchase to be deleted, got %v", pending)
+	}
+}
+
+func TestPausedReceiptsThatFailToParseAreLeftForReview(t *testing.T) {
+	bank := fakes.NewMercury(t, "testdata/mercury")
+	baserow := fakes.NewBaserow(t)
+	client := baserow.Client()
+
+	baserow.Seed(models.BaserowPendingPurchasesTableName, map[string]interface{}{
+		"Bank Tx ID": "tx-1",
+		"Reason":     aiBudgetPausedReason + ": monthly AI budget exceeded",
+	})
+
+	reader := services.NewReceiptReader(&services.StubParser{Err: errors.New("response does not match the receipt schema")})
+
+	now := time.Now().UTC()
+	if _, err := run_ingest_receipts(context.Background(), reader, newAIUsageTracker(client, 10), client, bank.Client(), now.AddDate(0, 0, -1), now); err != nil {
+		t.Fatalf("run_ingest_receipts: %v", err)
+	}
+
+	rows := baserow.Rows(models.BaserowPendingPurchasesTableName)
+	if len(rows) != 1 || !strings.Contains(fmt.Sprint(rows[0]["Reason"]), "receipt schema") {
+		t.Errorf("expected the paused row to be replaced by one explaining the failed parse, got %v", rows)
+	}
+}
+
+func TestAIUsageTrackerTreatsUnpricedModelsAsOverBudget(t *testing.T) {
+	tracker := newAIUsageTracker(fakes.NewBaserow(t).Client(), 5)
+
+	calls := []services.Usage{{Parser: "openai/llava", InputTokens: 2000, OutputTokens: 400}}
+	if err := tracker.Check(context.Background(), calls); !errors.Is(err, ErrAIBudgetExceeded) {
+		t.Errorf("expected a call to an unpriced model to pause parsing, got %v", err)
+	}
+}
@@ -0,0 +1,198 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/jiaming2012/receipt-bot/src/models"
+)
+
+// defaultAttachmentHTTPTimeout bounds each attachment download, so a host that
+// never responds can't hang an ingest run.
+const defaultAttachmentHTTPTimeout = time.Minute
+
+// ErrAttachmentFailed is returned when a receipt attachment can't be
+// downloaded or converted for the model.
+var ErrAttachmentFailed = errors.New("failed to prepare receipt attachment")
+
+// ErrUnsupportedAttachment is returned for receipts in a format the model
+// can't read, e.g. spreadsheets or zip files.
+var ErrUnsupportedAttachment = errors.New("unsupported receipt attachment")
+
+// supportedReceiptTypes are the MIME types sent to the model as they are.
+// PDFs are sent whole, so multi-page invoices are read in one request.
+var supportedReceiptTypes = map[string]bool{
+	"image/jpeg":      true,
+	"image/png":       true,
+	"image/webp":      true,
+	"application/pdf": true,
+}
+
+// receiptTypesByExt covers extensions the system MIME table may not know.
+var receiptTypesByExt = map[string]string{
+	".jpg":  "image/jpeg",
+	".jpeg": "image/jpeg",
+	".png":  "image/png",
+	".webp": "image/webp",
+	".pdf":  "application/pdf",
+	".heic": "image/heic",
+	".heif": "image/heif",
+}
+
+// heifBrands are the ISO base media file brands used by HEIC and HEIF photos,
+// as taken by iPhones.
+var heifBrands = map[string]bool{
+	"heic": true, "heix": true, "hevc": true, "hevx": true,
+	"heim": true, "heis": true, "mif1": true, "msf1": true,
+}
+
+// ReceiptFile is a downloaded receipt attachment, ready to send to the model.
+type ReceiptFile struct {
+	Data     []byte
+	MIMEType string
+}
+
+// FetchReceiptFile downloads an attachment with httpClient and prepares it for
+// the model.
+func FetchReceiptFile(ctx context.Context, httpClient *http.Client, attachment *models.MercuryTransactionAttachment) (*ReceiptFile, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", attachment.URL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("FetchReceiptFile: failed to create request: %w", err)
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("FetchReceiptFile: failed to fetch receipt: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("FetchReceiptFile: received non-200 response code: %d", resp.StatusCode)
+	}
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("FetchReceiptFile: failed to read receipt: %w", err)
+	}
+
+	return PrepareReceiptFile(ctx, attachment, data, resp.Header.Get("Content-Type"))
+}
+
+// PrepareReceiptFile detects the attachment's type and converts HEIC photos to
+// JPEG. Types the model can't read return ErrUnsupportedAttachment.
+func PrepareReceiptFile(ctx context.Context, attachment *models.MercuryTransactionAttachment, data []byte, contentType string) (*ReceiptFile, error) {
+	fileName := attachment.FileName
+	if fileName == "" {
+		fileName = path.Base(strings.SplitN(attachment.URL, "?", 2)[0])
+	}
+
+	mimeType := DetectReceiptMIME(fileName, attachment.AttachmentType, contentType, data)
+
+	switch {
+	case supportedReceiptTypes[mimeType]:
+		return &ReceiptFile{Data: data, MIMEType: mimeType}, nil
+	case mimeType == "image/heic" || mimeType == "image/heif":
+		return convertHEIC(ctx, data, mimeType)
+	default:
+		return nil, fmt.Errorf("%w: %s is %s; attach a JPEG, PNG, WebP, HEIC or PDF instead", ErrUnsupportedAttachment, fileName, mimeType)
+	}
+}
+
+// DetectReceiptMIME works out an attachment's MIME type from its contents,
+// falling back to the file name, Mercury's attachment type and the download's
+// Content-Type when the contents are not recognised.
+func DetectReceiptMIME(fileName, attachmentType, contentType string, data []byte) string {
+	if len(data) >= 12 && string(data[4:8]) == "ftyp" && heifBrands[string(data[8:12])] {
+		return "image/heic"
+	}
+
+	sniffed := baseMIME(http.DetectContentType(data))
+	if sniffed != "application/octet-stream" && !strings.HasPrefix(sniffed, "text/") {
+		return sniffed
+	}
+
+	ext := strings.ToLower(filepath.Ext(fileName))
+	if t, ok := receiptTypesByExt[ext]; ok {
+		return t
+	} else if t := mime.TypeByExtension(ext); t != "" {
+		return baseMIME(t)
+	}
+
+	// Mercury's attachment type is usually a category such as "receipt", but
+	// use it when it is a MIME type
+	for _, t := range []string{attachmentType, contentType} {
+		if t = baseMIME(t); strings.Contains(t, "/") && t != "application/octet-stream" {
+			return t
+		}
+	}
+
+	return sniffed
+}
+
+func baseMIME(t string) string {
+	mediaType, _, err := mime.ParseMediaType(t)
+	if err != nil {
+		return strings.ToLower(strings.TrimSpace(t))
+	}
+	return mediaType
+}
+
+// heicConverters are tried in order to convert HEIC photos to JPEG. Each is
+// run as "<command> <input> <output>".
+var heicConverters = []string{"heif-convert", "magick", "convert"}
+
+// convertHEIC converts a HEIC photo to JPEG with the first converter found on
+// the PATH. Without one the photo is sent as HEIC, which Gemini reads but
+// other models may not.
+func convertHEIC(ctx context.Context, data []byte, mimeType string) (*ReceiptFile, error) {
+	var converter string
+	for _, name := range heicConverters {
+		if p, err := exec.LookPath(name); err == nil {
+			converter = p
+			break
+		}
+	}
+
+	if converter == "" {
+		log.Warnf("No HEIC converter found (tried %s); sending the receipt as %s", strings.Join(heicConverters, ", "), mimeType)
+		return &ReceiptFile{Data: data, MIMEType: mimeType}, nil
+	}
+
+	dir, err := os.MkdirTemp("", "receipt-heic-")
+	if err != nil {
+		return nil, fmt.Errorf("convertHEIC: %w", err)
+	}
+	defer os.RemoveAll(dir)
+
+	in, out := filepath.Join(dir, "receipt.heic"), filepath.Join(dir, "receipt.jpg")
+	if err := os.WriteFile(in, data, 0o600); err != nil {
+		return nil, fmt.Errorf("convertHEIC: %w", err)
+	}
+
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, converter, in, out)
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("convertHEIC: %s failed: %w: %s", filepath.Base(converter), err, strings.TrimSpace(stderr.String()))
+	}
+
+	jpeg, err := os.ReadFile(out)
+	if err != nil {
+		return nil, fmt.Errorf("convertHEIC: %w", err)
+	}
+
+	return &ReceiptFile{Data: jpeg, MIMEType: "image/jpeg"}, nil
+}
@@ -0,0 +1,67 @@
+package services_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/jiaming2012/receipt-bot/src/models"
+	"github.com/jiaming2012/receipt-bot/src/services"
+)
+
+func TestDetectReceiptMIME(t *testing.T) {
+	heic := append([]byte{0, 0, 0, 24}, []byte("ftypheic\x00\x00\x00\x00mif1heic")...)
+	png := []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+	jpeg := []byte("\xff\xd8\xff\xe0\x00\x10JFIF\x00")
+
+	tests := []struct {
+		name        string
+		fileName    string
+		contentType string
+		data        []byte
+		want        string
+	}{
+		{name: "pdf invoice", fileName: "invoice.pdf", data: []byte("%PDF-1.7\n%...."), want: "application/pdf"},
+		{name: "png named as jpeg", fileName: "receipt.jpg", data: png, want: "image/png"},
+		{name: "jpeg", fileName: "receipt", data: jpeg, want: "image/jpeg"},
+		{name: "iphone photo", fileName: "IMG_0001.HEIC", data: heic, want: "image/heic"},
+		{name: "unknown bytes use the file name", fileName: "receipt.heif", data: []byte{1, 2, 3}, want: "image/heif"},
+		{name: "unknown bytes use the content type", contentType: "application/pdf; charset=binary", data: []byte{1, 2, 3}, want: "application/pdf"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := services.DetectReceiptMIME(tt.fileName, "receipt", tt.contentType, tt.data); got != tt.want {
+				t.Errorf("expected %s, got %s", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestPrepareReceiptFileRejectsUnsupportedTypes(t *testing.T) {
+	attachment := &models.MercuryTransactionAttachment{FileName: "receipts.zip"}
+
+	_, err := services.PrepareReceiptFile(context.Background(), attachment, []byte("PK\x03\x04\x14\x00"), "")
+	if !errors.Is(err, services.ErrUnsupportedAttachment) {
+		t.Fatalf("expected ErrUnsupportedAttachment, got %v", err)
+	}
+}
+
+func TestFetchReceiptFileTimesOut(t *testing.T) {
+	done := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-done
+	}))
+	t.Cleanup(server.Close)
+	t.Cleanup(func() { close(done) })
+
+	attachment := &models.MercuryTransactionAttachment{FileName: "receipt.jpg", URL: server.URL}
+	httpClient := &http.Client{Timeout: 50 * time.Millisecond}
+
+	if _, err := services.FetchReceiptFile(context.Background(), httpClient, attachment); err == nil {
+		t.Fatal("expected the download to time out")
+	}
+}
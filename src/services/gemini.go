@@ -4,9 +4,8 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"io"
-	"net/http"
 	"regexp"
+	"strings"
 
 	"google.golang.org/genai"
 
@@ -21,7 +20,13 @@ func parseJSONBody(jsonStr string) ([]models.ReceiptItem, models.ReceiptSummary,
 	// Decode the JSON content
 	var result models.ReceiptJSON
 
-	if len(matches) == 1 {
+	if len(matches) == 0 {
+		// models without fences, e.g. behind an OpenAI-compatible server,
+		// often answer with the bare object
+		if err := json.Unmarshal([]byte(strings.TrimSpace(jsonStr)), &result); err != nil {
+			return nil, models.ReceiptSummary{}, fmt.Errorf("no JSON code block found and the response is not JSON: %v", err)
+		}
+	} else if len(matches) == 1 {
 		if err := json.Unmarshal([]byte(matches[0][1]), &result); err != nil {
 			return nil, models.ReceiptSummary{}, fmt.Errorf("error unmarshaling receipt JSON: %v", err)
 		}
@@ -81,46 +86,78 @@ func parseJSONBody(jsonStr string) ([]models.ReceiptItem, models.ReceiptSummary,
 	return items, summary, nil
 }
 
-func ParseReceipt(ctx context.Context, client *genai.Client, receiptURL string) ([]models.ReceiptItem, models.ReceiptSummary, error) {
-	imageResp, err := http.Get(receiptURL)
-	if err != nil {
-		return nil, models.ReceiptSummary{}, fmt.Errorf("run_parse_receipt_with_genai: failed to fetch receipt image: %w", err)
+const DefaultGeminiModel = "gemini-2.5-flash-lite"
+
+// GeminiParser parses receipts with a Gemini model.
+type GeminiParser struct {
+	Client *genai.Client
+	Model  string
+	// ResponseSchema asks for JSON matching ReceiptResponseSchema. Turn it off
+	// for models that don't support structured output.
+	ResponseSchema bool
+}
+
+func NewGeminiParser(client *genai.Client, model string) *GeminiParser {
+	if model == "" {
+		model = DefaultGeminiModel
 	}
-	defer imageResp.Body.Close()
 
-	imageBytes, err := io.ReadAll(imageResp.Body)
-	if err != nil {
-		return nil, models.ReceiptSummary{}, fmt.Errorf("run_parse_receipt_with_genai: failed to read image bytes: %w", err)
+	return &GeminiParser{Client: client, Model: model, ResponseSchema: true}
+}
+
+func (p *GeminiParser) Name() string {
+	return "gemini/" + p.Model
+}
+
+func (p *GeminiParser) ParseReceipt(ctx context.Context, files []*ReceiptFile, prompt *Prompt) ([]models.ReceiptItem, models.ReceiptSummary, error) {
+	var parts []*genai.Part
+	for _, file := range files {
+		parts = append(parts, genai.NewPartFromBytes(file.Data, file.MIMEType))
 	}
 
-	parts := []*genai.Part{
-		genai.NewPartFromBytes(imageBytes, "image/jpeg"),
-		genai.NewPartFromText("Parse items[] with fields: name,quantity(int),price(float),total(float),is_case(bool)"),
-		genai.NewPartFromText("Parse summary with fields: vendor,total_units(int),total_cases(int),tax(float),total(float)"),
-		genai.NewPartFromText("Response in JSON format"),
+	for _, instruction := range prompt.Instructions {
+		parts = append(parts, genai.NewPartFromText(instruction))
 	}
 
 	contents := []*genai.Content{
 		genai.NewContentFromParts(parts, genai.RoleUser),
 	}
 
-	result, err := client.Models.GenerateContent(
-		ctx,
-		// "gemini-2.5-pro",
-		"gemini-2.5-flash-lite",
-		contents,
-		nil,
-	)
+	var config *genai.GenerateContentConfig
+	if p.ResponseSchema {
+		config = &genai.GenerateContentConfig{
+			ResponseMIMEType: "application/json",
+			ResponseSchema:   ReceiptResponseSchema(),
+		}
+	}
 
+	result, err := p.Client.Models.GenerateContent(ctx, p.Model, contents, config)
 	if err != nil {
-		return nil, models.ReceiptSummary{}, fmt.Errorf("ParseReceipt: failed to generate content: %w", err)
+		return nil, models.ReceiptSummary{}, fmt.Errorf("GeminiParser: failed to generate content: %w", err)
+	}
+
+	if usage := result.UsageMetadata; usage != nil {
+		// thinking tokens are billed as output
+		RecordUsage(ctx, Usage{
+			Parser:        p.Name(),
+			PromptVersion: prompt.Version,
+			InputTokens:   int(usage.PromptTokenCount),
+			OutputTokens:  int(usage.CandidatesTokenCount + usage.ThoughtsTokenCount),
+		})
 	}
 
 	jsonResp := result.Text()
 
-	items, summary, err := parseJSONBody(jsonResp)
+	// without a response schema the model may fence the JSON or quote its
+	// numbers, which only the lenient parser copes with
+	parse := parseJSONBody
+	if p.ResponseSchema {
+		parse = ParseReceiptJSON
+	}
+
+	items, summary, err := parse(jsonResp)
 	if err != nil {
-		return nil, models.ReceiptSummary{}, fmt.Errorf("ParseReceipt: failed to parse JSON body: %w", err)
+		return nil, models.ReceiptSummary{}, fmt.Errorf("GeminiParser: failed to parse JSON body: %w", err)
 	}
 
 	return items, summary, nil
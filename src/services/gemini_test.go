@@ -0,0 +1,57 @@
+package services_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"google.golang.org/genai"
+
+	"github.com/jiaming2012/receipt-bot/src/services"
+)
+
+func TestGeminiParserOnlyParsesLenientlyWithoutResponseSchema(t *testing.T) {
+	// prices written as strings don't conform to the response schema
+	answer := `{"items":[{"Name":"Corn","Quantity":2,"Price":"$4.99","IsCase":false}],"summary":{"vendor":"Farmers Market","Tax":0,"Total":9.98,"total_units":2,"total_cases":0}}`
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"candidates": []interface{}{map[string]interface{}{
+				"content": map[string]interface{}{
+					"role":  "model",
+					"parts": []interface{}{map[string]string{"text": answer}},
+				},
+			}},
+		})
+	}))
+	defer server.Close()
+
+	client, err := genai.NewClient(context.Background(), &genai.ClientConfig{
+		APIKey:      "test",
+		Backend:     genai.BackendGeminiAPI,
+		HTTPOptions: genai.HTTPOptions{BaseURL: server.URL},
+	})
+	if err != nil {
+		t.Fatalf("genai.NewClient: %v", err)
+	}
+
+	files := []*services.ReceiptFile{{Data: []byte("jpeg"), MIMEType: "image/jpeg"}}
+	prompt := &services.Prompt{Version: "test.v1", Instructions: []string{"Response in JSON format"}}
+
+	parser := services.NewGeminiParser(client, "")
+	if items, summary, err := parser.ParseReceipt(context.Background(), files, prompt); err == nil {
+		t.Errorf("expected a response that doesn't match the schema to be rejected, got %+v %+v", items, summary)
+	}
+
+	parser.ResponseSchema = false
+	items, summary, err := parser.ParseReceipt(context.Background(), files, prompt)
+	if err != nil {
+		t.Fatalf("ParseReceipt without a response schema: %v", err)
+	}
+
+	if len(items) != 1 || items[0].Price != 4.99 || summary.Total != 9.98 {
+		t.Errorf("unexpected receipt: %+v %+v", items, summary)
+	}
+}
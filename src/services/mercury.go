@@ -3,79 +3,435 @@ package services
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"iter"
 	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/jiaming2012/receipt-bot/src/models"
 )
 
+const (
+	DefaultMercuryBaseURL = "https://api.mercury.com/api/v1"
+
+	defaultMercuryHTTPTimeout = 30 * time.Second
+	// MercuryMaxPageSize is the largest limit Mercury accepts per request.
+	MercuryMaxPageSize = 1000
+)
+
 var IgnoreReceiptsNamed = []string{"Expense Reimbursement"}
 
-func FetchReceipts(ctx context.Context, bankApiKey string, start, end time.Time) (validTransactions []*models.MercuryTransaction, invalidTransactions []*models.MercuryTransaction, err error) {
-	resp, err := fetchMercuryTransactions(ctx, bankApiKey, start, end)
-	if err != nil {
-		err = fmt.Errorf("FetchReceipts: failed to fetch mercury transactions: %w", err)
-		return
+// ErrMissingReceipts is returned by FetchReceipts alongside its results when
+// some transactions have neither an attachment nor a note.
+var ErrMissingReceipts = errors.New("transactions without attachments or notes")
+
+// ErrMercuryNotFound is returned when Mercury responds 404.
+var ErrMercuryNotFound = errors.New("not found")
+
+type MercuryClient struct {
+	ApiKey     string
+	BaseURL    string
+	HTTPClient *http.Client
+	PageSize   int
+
+	// IncludeAccounts and ExcludeAccounts select accounts by ID or name. An
+	// empty include list selects every account.
+	IncludeAccounts []string
+	ExcludeAccounts []string
+}
+
+type MercuryClientOption func(*MercuryClient)
+
+// WithMercuryBaseURL points the client at another Mercury API, e.g. a fake
+// server in tests.
+func WithMercuryBaseURL(baseURL string) MercuryClientOption {
+	return func(c *MercuryClient) {
+		c.BaseURL = baseURL
 	}
+}
 
-outer_loop:
-	for _, tx := range resp.Transactions {
-		for _, ignoreName := range IgnoreReceiptsNamed {
-			if tx.BankDescription == ignoreName {
-				continue outer_loop
-			}
+func WithMercuryHTTPClient(httpClient *http.Client) MercuryClientOption {
+	return func(c *MercuryClient) {
+		c.HTTPClient = httpClient
+	}
+}
+
+// WithMercuryPageSize sets how many transactions are fetched per request.
+func WithMercuryPageSize(size int) MercuryClientOption {
+	return func(c *MercuryClient) {
+		c.PageSize = size
+	}
+}
+
+// WithMercuryAccounts limits which accounts transactions are fetched from.
+func WithMercuryAccounts(include, exclude []string) MercuryClientOption {
+	return func(c *MercuryClient) {
+		c.IncludeAccounts = include
+		c.ExcludeAccounts = exclude
+	}
+}
+
+func NewMercuryClient(apiKey string, opts ...MercuryClientOption) *MercuryClient {
+	c := &MercuryClient{
+		ApiKey:     apiKey,
+		BaseURL:    DefaultMercuryBaseURL,
+		HTTPClient: &http.Client{Timeout: defaultMercuryHTTPTimeout},
+		PageSize:   MercuryMaxPageSize,
+	}
+
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	return c
+}
+
+func (c *MercuryClient) FetchReceipts(ctx context.Context, start, end time.Time) (validTransactions []*models.MercuryTransaction, invalidTransactions []*models.MercuryTransaction, err error) {
+	for tx, fetchErr := range c.Transactions(ctx, start, end) {
+		if fetchErr != nil {
+			return nil, nil, fmt.Errorf("FetchReceipts: failed to fetch mercury transactions: %w", fetchErr)
+		}
+
+		if IsIgnoredTransaction(tx) {
+			continue
 		}
 
-		if len(tx.Attachments) > 0 || tx.Note != "" {
+		if HasReceipt(tx) {
 			validTransactions = append(validTransactions, tx)
 		} else {
 			invalidTransactions = append(invalidTransactions, tx)
 		}
 	}
 
+	// accounts are fetched concurrently; restore a stable newest-first order
+	sortNewestFirst(validTransactions)
+	sortNewestFirst(invalidTransactions)
+
 	if len(invalidTransactions) > 0 {
-		err = fmt.Errorf("FetchReceipts: found %d transactions without attachments or notes", len(invalidTransactions))
+		err = fmt.Errorf("FetchReceipts: found %d %w", len(invalidTransactions), ErrMissingReceipts)
 	}
 
 	return
 }
 
-func fetchMercuryTransactions(ctx context.Context, apiKey string, startAt, endAt time.Time) (*models.MercuryListAllTransactionsResponse, error) {
-	url := "https://api.mercury.com/api/v1/transactions"
+// IsIgnoredTransaction reports whether tx never needs a receipt.
+func IsIgnoredTransaction(tx *models.MercuryTransaction) bool {
+	for _, ignoreName := range IgnoreReceiptsNamed {
+		if tx.BankDescription == ignoreName {
+			return true
+		}
+	}
+	return false
+}
 
-	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+// HasReceipt reports whether tx has an attachment or a note to ingest.
+func HasReceipt(tx *models.MercuryTransaction) bool {
+	return len(tx.Attachments) > 0 || tx.Note != ""
+}
+
+func sortNewestFirst(txs []*models.MercuryTransaction) {
+	sort.SliceStable(txs, func(i, j int) bool {
+		return txs[i].CreatedAt > txs[j].CreatedAt
+	})
+}
+
+// Accounts returns the accounts transactions are fetched from: every account
+// of the API key, narrowed by the client's include and exclude lists.
+func (c *MercuryClient) Accounts(ctx context.Context) ([]*models.MercuryAccount, error) {
+	var resp models.MercuryListAccountsResponse
+	if err := c.getJSON(ctx, "/accounts", nil, &resp); err != nil {
+		return nil, fmt.Errorf("Accounts: %w", err)
+	}
+
+	var accounts []*models.MercuryAccount
+	for _, account := range resp.Accounts {
+		if len(c.IncludeAccounts) > 0 && !matchesAccount(account, c.IncludeAccounts) {
+			continue
+		}
+
+		if matchesAccount(account, c.ExcludeAccounts) {
+			continue
+		}
+
+		accounts = append(accounts, account)
+	}
+
+	return accounts, nil
+}
+
+// matchesAccount reports whether the account's ID or name is in names.
+func matchesAccount(account *models.MercuryAccount, names []string) bool {
+	for _, name := range names {
+		if name == account.ID || strings.EqualFold(name, account.Name) {
+			return true
+		}
+	}
+	return false
+}
+
+// Transactions streams the transactions created between start and end across
+// all of the client's accounts, fetching each account concurrently. Each
+// transaction is tagged with its account. Transactions of different accounts
+// are interleaved in no particular order. Iteration stops at the first error.
+func (c *MercuryClient) Transactions(ctx context.Context, start, end time.Time) iter.Seq2[*models.MercuryTransaction, error] {
+	return func(yield func(*models.MercuryTransaction, error) bool) {
+		accounts, err := c.Accounts(ctx)
+		if err != nil {
+			yield(nil, err)
+			return
+		}
+
+		// stops the account fetchers once the caller stops iterating
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		type result struct {
+			tx  *models.MercuryTransaction
+			err error
+		}
+
+		results := make(chan result)
+
+		var wg sync.WaitGroup
+		for _, account := range accounts {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+
+				for tx, err := range c.AccountTransactions(ctx, account, start, end) {
+					select {
+					case results <- result{tx: tx, err: err}:
+					case <-ctx.Done():
+						return
+					}
+				}
+			}()
+		}
+
+		go func() {
+			wg.Wait()
+			close(results)
+		}()
+
+		for r := range results {
+			if !yield(r.tx, r.err) || r.err != nil {
+				return
+			}
+		}
+	}
+}
+
+// AccountTransactions streams the transactions of one account created between
+// start and end, one page at a time, so large date ranges need not be held in
+// memory. Pages are followed through the nextPage cursor when Mercury returns
+// one, otherwise by offset until a short page is returned. Iteration stops at
+// the first error.
+func (c *MercuryClient) AccountTransactions(ctx context.Context, account *models.MercuryAccount, start, end time.Time) iter.Seq2[*models.MercuryTransaction, error] {
+	return func(yield func(*models.MercuryTransaction, error) bool) {
+		q := url.Values{}
+		q.Set("start", start.Format("2006-01-02"))
+		q.Set("end", end.Format("2006-01-02"))
+		q.Set("limit", strconv.Itoa(c.PageSize))
+
+		offset := 0
+		for {
+			page, err := c.fetchMercuryTransactions(ctx, account.ID, q)
+			if err != nil {
+				yield(nil, fmt.Errorf("account %s: %w", account.Name, err))
+				return
+			}
+
+			for _, tx := range page.Transactions {
+				tx.AccountID = account.ID
+				tx.AccountName = account.Name
+
+				if !yield(tx, nil) {
+					return
+				}
+			}
+
+			offset += len(page.Transactions)
+
+			switch {
+			case page.Page.NextPage != "":
+				q.Del("offset")
+				q.Set("start_after", page.Page.NextPage)
+			case len(page.Transactions) >= c.PageSize && (page.Total == 0 || offset < page.Total):
+				q.Set("offset", strconv.Itoa(offset))
+			default:
+				return
+			}
+		}
+	}
+}
+
+// Transaction fetches a single transaction. If accountID is empty every
+// account of the client is searched.
+func (c *MercuryClient) Transaction(ctx context.Context, accountID, transactionID string) (*models.MercuryTransaction, error) {
+	accounts := []*models.MercuryAccount{{ID: accountID}}
+	if accountID == "" {
+		var err error
+		accounts, err = c.Accounts(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("Transaction: %w", err)
+		}
+	}
+
+	for _, account := range accounts {
+		var tx models.MercuryTransaction
+		err := c.getJSON(ctx, fmt.Sprintf("/account/%s/transaction/%s", url.PathEscape(account.ID), url.PathEscape(transactionID)), nil, &tx)
+		if errors.Is(err, ErrMercuryNotFound) {
+			continue
+		} else if err != nil {
+			return nil, fmt.Errorf("Transaction: %w", err)
+		}
+
+		tx.AccountID = account.ID
+		if account.Name != "" {
+			tx.AccountName = account.Name
+		}
+
+		return &tx, nil
+	}
+
+	return nil, fmt.Errorf("Transaction: transaction %s: %w", transactionID, ErrMercuryNotFound)
+}
+
+func (c *MercuryClient) fetchMercuryTransactions(ctx context.Context, accountID string, q url.Values) (*models.MercuryListAllTransactionsResponse, error) {
+	var transactionsResponse models.MercuryListAllTransactionsResponse
+	if err := c.getJSON(ctx, fmt.Sprintf("/account/%s/transactions", url.PathEscape(accountID)), q, &transactionsResponse); err != nil {
+		return nil, fmt.Errorf("FetchMercuryTransactions: %w", err)
+	}
+
+	return &transactionsResponse, nil
+}
+
+func (c *MercuryClient) getJSON(ctx context.Context, path string, q url.Values, out interface{}) error {
+	reqURL := c.BaseURL + path
+	if len(q) > 0 {
+		reqURL += "?" + q.Encode()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", reqURL, nil)
 	if err != nil {
-		return nil, fmt.Errorf("FetchMercuryTransactions: failed to create requrest with context: %w", err)
+		return fmt.Errorf("failed to create requrest with context: %w", err)
 	}
 
-	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", apiKey))
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", c.ApiKey))
 	req.Header.Set("Accept", "application/json;charset=utf-8")
 
-	q := req.URL.Query()
-	q.Add("start", startAt.Format("2006-01-02"))
-	q.Add("end", endAt.Format("2006-01-02"))
-	req.URL.RawQuery = q.Encode()
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to make request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return fmt.Errorf("received non-200 response code: %d: %w", resp.StatusCode, ErrMercuryNotFound)
+	} else if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("received non-200 response code: %d", resp.StatusCode)
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode json response: %w", err)
+	}
+
+	return nil
+}
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
+// DownloadAttachment fetches an attachment from its URL. Attachment URLs are
+// pre-signed, so no credentials are sent.
+func (c *MercuryClient) DownloadAttachment(ctx context.Context, url string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
-		return nil, fmt.Errorf("FetchMercuryTransactions: failed to make request: %w", err)
+		return nil, fmt.Errorf("DownloadAttachment: failed to create request: %w", err)
+	}
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("DownloadAttachment: failed to make request: %w", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("FetchMercuryTransactions: received non-200 response code: %d", resp.StatusCode)
+		return nil, fmt.Errorf("DownloadAttachment: received non-200 response code: %d", resp.StatusCode)
 	}
 
-	var transactionsResponse models.MercuryListAllTransactionsResponse
-	if err := json.NewDecoder(resp.Body).Decode(&transactionsResponse); err != nil {
-		return nil, fmt.Errorf("FetchMercuryTransactions: failed to decode json response: %w", err)
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("DownloadAttachment: failed to read body: %w", err)
+	}
+
+	return body, nil
+}
+
+// RecordTransactions saves the accounts, the transactions between start and
+// end, and their attachments, to dir in the layout served by fakes.NewMercury:
+// accounts.json, a transactions.json page and an attachments/ directory, with
+// attachment URLs rewritten to paths relative to it. It returns the number of
+// transactions recorded.
+func (c *MercuryClient) RecordTransactions(ctx context.Context, start, end time.Time, dir string) (int, error) {
+	accounts, err := c.Accounts(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("RecordTransactions: %w", err)
 	}
 
-	if len(transactionsResponse.Transactions) >= 1000 {
-		return nil, fmt.Errorf("FetchMercuryTransactions: response limit reached - implement pagination")
+	resp := &models.MercuryListAllTransactionsResponse{}
+	for tx, err := range c.Transactions(ctx, start, end) {
+		if err != nil {
+			return 0, fmt.Errorf("RecordTransactions: %w", err)
+		}
+		resp.Transactions = append(resp.Transactions, tx)
 	}
 
-	return &transactionsResponse, nil
+	if err := os.MkdirAll(filepath.Join(dir, "attachments"), 0o755); err != nil {
+		return 0, fmt.Errorf("RecordTransactions: %w", err)
+	}
+
+	for _, tx := range resp.Transactions {
+		for i, attachment := range tx.Attachments {
+			data, err := c.DownloadAttachment(ctx, attachment.URL)
+			if err != nil {
+				return 0, fmt.Errorf("RecordTransactions: transaction %s: %w", tx.ID, err)
+			}
+
+			name := fmt.Sprintf("%s-%d%s", tx.ID, i, path.Ext(attachment.FileName))
+			if err := os.WriteFile(filepath.Join(dir, "attachments", name), data, 0o644); err != nil {
+				return 0, fmt.Errorf("RecordTransactions: %w", err)
+			}
+
+			attachment.URL = "attachments/" + name
+		}
+	}
+
+	sortNewestFirst(resp.Transactions)
+
+	if err := writeJSONFile(filepath.Join(dir, "accounts.json"), models.MercuryListAccountsResponse{Accounts: accounts}); err != nil {
+		return 0, fmt.Errorf("RecordTransactions: %w", err)
+	}
+
+	if err := writeJSONFile(filepath.Join(dir, "transactions.json"), resp); err != nil {
+		return 0, fmt.Errorf("RecordTransactions: %w", err)
+	}
+
+	return len(resp.Transactions), nil
+}
+
+func writeJSONFile(path string, v interface{}) error {
+	out, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(path, out, 0o644)
 }
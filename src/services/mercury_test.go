@@ -0,0 +1,223 @@
+package services_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jiaming2012/receipt-bot/src/fakes"
+	"github.com/jiaming2012/receipt-bot/src/models"
+	"github.com/jiaming2012/receipt-bot/src/services"
+)
+
+var (
+	fixtureStart = time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	fixtureEnd   = time.Date(2024, 5, 7, 0, 0, 0, 0, time.UTC)
+)
+
+func TestFetchReceiptsSplitsTransactions(t *testing.T) {
+	fake := fakes.NewMercury(t, "../testdata/mercury")
+
+	valid, invalid, err := fake.Client().FetchReceipts(context.Background(), fixtureStart, fixtureEnd)
+	if err == nil {
+		t.Errorf("expected an error reporting the transaction without a receipt")
+	}
+
+	var validIDs []string
+	for _, tx := range valid {
+		validIDs = append(validIDs, tx.ID)
+	}
+
+	// newest first; tx-4 is ignored and tx-5 is outside the date range
+	if len(validIDs) != 2 || validIDs[0] != "tx-2" || validIDs[1] != "tx-1" {
+		t.Errorf("expected tx-2 and tx-1 to be valid, got %v", validIDs)
+	}
+
+	if len(invalid) != 1 || invalid[0].ID != "tx-3" {
+		t.Errorf("expected only tx-3 to be invalid, got %v", invalid)
+	}
+}
+
+func TestRecordTransactionsRoundTrips(t *testing.T) {
+	ctx := context.Background()
+	source := fakes.NewMercury(t, "../testdata/mercury")
+
+	dir := t.TempDir()
+	n, err := source.Client().RecordTransactions(ctx, fixtureStart, fixtureEnd, dir)
+	if err != nil {
+		t.Fatalf("RecordTransactions: %v", err)
+	}
+
+	if n != 4 {
+		t.Errorf("expected 4 transactions to be recorded, got %d", n)
+	}
+
+	replay := fakes.NewMercury(t, dir)
+	valid, _, _ := replay.Client().FetchReceipts(ctx, fixtureStart, fixtureEnd)
+
+	var receiptURL string
+	for _, tx := range valid {
+		if tx.ID == "tx-1" {
+			receiptURL = tx.Attachments[0].URL
+		}
+	}
+
+	if receiptURL == "" {
+		t.Fatalf("expected tx-1 to be replayed with its attachment")
+	}
+
+	got, err := replay.Client().DownloadAttachment(ctx, receiptURL)
+	if err != nil {
+		t.Fatalf("DownloadAttachment: %v", err)
+	}
+
+	want, err := os.ReadFile(filepath.Join("../testdata/mercury/attachments", "tx-1-0.jpg"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(got, want) {
+		t.Errorf("expected the replayed attachment to match the fixture")
+	}
+}
+
+func addTransactions(fake *fakes.Mercury, n int) {
+	for i := 0; i < n; i++ {
+		fake.AddTransactions(&models.MercuryTransaction{
+			ID:        fmt.Sprintf("tx-%04d", i),
+			CreatedAt: fixtureStart.Add(time.Duration(i) * time.Minute).Format(time.RFC3339),
+			Note:      "cash",
+		})
+	}
+}
+
+// pageRequests counts the transaction page requests the fake received.
+func pageRequests(fake *fakes.Mercury) int {
+	n := 0
+	for _, r := range fake.Requests() {
+		if strings.HasSuffix(r, "/transactions") {
+			n++
+		}
+	}
+	return n
+}
+
+func TestTransactionsFollowsCursors(t *testing.T) {
+	fake := fakes.NewMercury(t, "")
+	addTransactions(fake, 2500)
+
+	seen := make(map[string]bool)
+	for tx, err := range fake.Client().Transactions(context.Background(), fixtureStart, fixtureEnd) {
+		if err != nil {
+			t.Fatalf("Transactions: %v", err)
+		}
+		seen[tx.ID] = true
+	}
+
+	if len(seen) != 2500 {
+		t.Errorf("expected 2500 distinct transactions, got %d", len(seen))
+	}
+
+	if got := pageRequests(fake); got != 3 {
+		t.Errorf("expected 3 page requests, got %d", got)
+	}
+}
+
+func TestTransactionsFallsBackToOffsets(t *testing.T) {
+	fake := fakes.NewMercury(t, "")
+	fake.OffsetOnly = true
+	addTransactions(fake, 25)
+
+	client := services.NewMercuryClient(fakes.FakeMercuryToken, services.WithMercuryBaseURL(fake.Server.URL), services.WithMercuryPageSize(10))
+
+	seen := make(map[string]bool)
+	for tx, err := range client.Transactions(context.Background(), fixtureStart, fixtureEnd) {
+		if err != nil {
+			t.Fatalf("Transactions: %v", err)
+		}
+		seen[tx.ID] = true
+	}
+
+	if len(seen) != 25 {
+		t.Errorf("expected 25 distinct transactions, got %d", len(seen))
+	}
+}
+
+func TestTransactionsStopsFetchingWhenTheCallerStops(t *testing.T) {
+	fake := fakes.NewMercury(t, "")
+	addTransactions(fake, 2500)
+
+	n := 0
+	for _, err := range fake.Client().Transactions(context.Background(), fixtureStart, fixtureEnd) {
+		if err != nil {
+			t.Fatalf("Transactions: %v", err)
+		}
+
+		n++
+		if n == 10 {
+			break
+		}
+	}
+
+	if got := pageRequests(fake); got != 1 {
+		t.Errorf("expected a single page request, got %d", got)
+	}
+}
+
+func TestTransactionsCoversEverySelectedAccount(t *testing.T) {
+	fake := fakes.NewMercury(t, "")
+	fake.AddAccount(&models.MercuryAccount{ID: "fake-savings", Name: "Savings", Kind: "savings", Status: "active"})
+	fake.AddAccount(&models.MercuryAccount{ID: "fake-card", Name: "Credit Card", Kind: "creditCard", Status: "active"})
+
+	for i, accountID := range []string{fakes.FakeMercuryAccountID, "fake-savings", "fake-card"} {
+		fake.AddTransactions(&models.MercuryTransaction{
+			ID:        "tx-" + accountID,
+			AccountID: accountID,
+			CreatedAt: fixtureStart.Add(time.Duration(i) * time.Hour).Format(time.RFC3339),
+			Note:      "cash",
+		})
+	}
+
+	tests := []struct {
+		name    string
+		include []string
+		exclude []string
+		want    []string
+	}{
+		{name: "all accounts", want: []string{"Checking", "Credit Card", "Savings"}},
+		{name: "include by name", include: []string{"savings"}, want: []string{"Savings"}},
+		{name: "exclude by ID", exclude: []string{"fake-card"}, want: []string{"Checking", "Savings"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := services.NewMercuryClient(fakes.FakeMercuryToken,
+				services.WithMercuryBaseURL(fake.Server.URL),
+				services.WithMercuryAccounts(tt.include, tt.exclude))
+
+			var got []string
+			for tx, err := range client.Transactions(context.Background(), fixtureStart, fixtureEnd) {
+				if err != nil {
+					t.Fatalf("Transactions: %v", err)
+				}
+
+				if tx.ID != "tx-"+tx.AccountID {
+					t.Errorf("expected %s to be tagged with its account, got %q", tx.ID, tx.AccountID)
+				}
+
+				got = append(got, tx.AccountName)
+			}
+
+			slices.Sort(got)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("expected transactions from %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,76 @@
+package services
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// MercurySignatureHeader carries the webhook signature, in the form
+	// "t=<unix timestamp>,v1=<hex HMAC-SHA256 of "<timestamp>.<body>">".
+	MercurySignatureHeader = "Mercury-Signature"
+
+	// MercuryWebhookTolerance is how old a signed event may be before it is
+	// rejected as a possible replay.
+	MercuryWebhookTolerance = 5 * time.Minute
+)
+
+var ErrInvalidWebhookSignature = errors.New("invalid webhook signature")
+
+// SignMercuryWebhook returns the signature header value Mercury sends for body
+// at time t.
+func SignMercuryWebhook(secret string, body []byte, t time.Time) string {
+	ts := strconv.FormatInt(t.Unix(), 10)
+	return fmt.Sprintf("t=%s,v1=%s", ts, mercuryWebhookMAC(secret, ts, body))
+}
+
+// VerifyMercuryWebhook checks that header is a valid signature of body made
+// with secret within MercuryWebhookTolerance of now.
+func VerifyMercuryWebhook(secret, header string, body []byte, now time.Time) error {
+	if secret == "" {
+		return fmt.Errorf("VerifyMercuryWebhook: no webhook secret configured: %w", ErrInvalidWebhookSignature)
+	}
+
+	var ts string
+	var signatures []string
+	for _, part := range strings.Split(header, ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch key {
+		case "t":
+			ts = value
+		case "v1":
+			signatures = append(signatures, value)
+		}
+	}
+
+	unix, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil || len(signatures) == 0 {
+		return fmt.Errorf("VerifyMercuryWebhook: malformed %s header: %w", MercurySignatureHeader, ErrInvalidWebhookSignature)
+	}
+
+	if age := now.Sub(time.Unix(unix, 0)); age > MercuryWebhookTolerance || age < -MercuryWebhookTolerance {
+		return fmt.Errorf("VerifyMercuryWebhook: timestamp outside tolerance: %w", ErrInvalidWebhookSignature)
+	}
+
+	expected := mercuryWebhookMAC(secret, ts, body)
+	for _, sig := range signatures {
+		if hmac.Equal([]byte(sig), []byte(expected)) {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("VerifyMercuryWebhook: %w", ErrInvalidWebhookSignature)
+}
+
+func mercuryWebhookMAC(secret, ts string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(ts + "."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
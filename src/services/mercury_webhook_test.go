@@ -0,0 +1,44 @@
+package services_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jiaming2012/receipt-bot/src/services"
+)
+
+func TestVerifyMercuryWebhook(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	body := []byte(`{"resourceType":"transaction","resourceId":"tx-1"}`)
+	header := services.SignMercuryWebhook("secret", body, now)
+
+	tests := []struct {
+		name   string
+		secret string
+		header string
+		body   []byte
+		now    time.Time
+		valid  bool
+	}{
+		{name: "valid", secret: "secret", header: header, body: body, now: now, valid: true},
+		{name: "wrong secret", secret: "other", header: header, body: body, now: now},
+		{name: "tampered body", secret: "secret", header: header, body: []byte(`{"resourceId":"tx-2"}`), now: now},
+		{name: "replayed", secret: "secret", header: header, body: body, now: now.Add(10 * time.Minute)},
+		{name: "malformed header", secret: "secret", header: "v1=abc", body: body, now: now},
+		{name: "no secret configured", secret: "", header: header, body: body, now: now},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := services.VerifyMercuryWebhook(tt.secret, tt.header, tt.body, tt.now)
+			if tt.valid && err != nil {
+				t.Errorf("expected a valid signature, got %v", err)
+			}
+
+			if !tt.valid && !errors.Is(err, services.ErrInvalidWebhookSignature) {
+				t.Errorf("expected ErrInvalidWebhookSignature, got %v", err)
+			}
+		})
+	}
+}
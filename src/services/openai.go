@@ -0,0 +1,166 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/jiaming2012/receipt-bot/src/models"
+)
+
+const (
+	DefaultOpenAIBaseURL = "https://api.openai.com/v1"
+	DefaultOpenAIModel   = "gpt-4o-mini"
+
+	defaultOpenAIHTTPTimeout = 2 * time.Minute
+)
+
+// OpenAIParser parses receipts with any server implementing the OpenAI chat
+// completions API, including local ones such as llama.cpp and Ollama.
+type OpenAIParser struct {
+	BaseURL    string
+	APIKey     string
+	Model      string
+	HTTPClient *http.Client
+}
+
+// NewOpenAIParser builds a parser for the server at baseURL. The API key may
+// be empty for local servers.
+func NewOpenAIParser(baseURL, apiKey, model string) *OpenAIParser {
+	if baseURL == "" {
+		baseURL = DefaultOpenAIBaseURL
+	}
+
+	if model == "" {
+		model = DefaultOpenAIModel
+	}
+
+	return &OpenAIParser{
+		BaseURL:    strings.TrimSuffix(baseURL, "/"),
+		APIKey:     apiKey,
+		Model:      model,
+		HTTPClient: &http.Client{Timeout: defaultOpenAIHTTPTimeout},
+	}
+}
+
+func (p *OpenAIParser) Name() string {
+	return "openai/" + p.Model
+}
+
+type openAIContentPart struct {
+	Type     string          `json:"type"`
+	Text     string          `json:"text,omitempty"`
+	ImageURL *openAIImageURL `json:"image_url,omitempty"`
+	File     *openAIFile     `json:"file,omitempty"`
+}
+
+type openAIImageURL struct {
+	URL string `json:"url"`
+}
+
+type openAIFile struct {
+	Filename string `json:"filename"`
+	FileData string `json:"file_data"`
+}
+
+type openAIMessage struct {
+	Role    string              `json:"role"`
+	Content []openAIContentPart `json:"content"`
+}
+
+type openAIChatRequest struct {
+	Model    string          `json:"model"`
+	Messages []openAIMessage `json:"messages"`
+}
+
+type openAIChatResponse struct {
+	Choices []struct {
+		Message struct {
+			Content string `json:"content"`
+		} `json:"message"`
+	} `json:"choices"`
+	Usage struct {
+		PromptTokens     int `json:"prompt_tokens"`
+		CompletionTokens int `json:"completion_tokens"`
+	} `json:"usage"`
+}
+
+func (p *OpenAIParser) ParseReceipt(ctx context.Context, files []*ReceiptFile, prompt *Prompt) ([]models.ReceiptItem, models.ReceiptSummary, error) {
+	var content []openAIContentPart
+	for i, file := range files {
+		dataURL := fmt.Sprintf("data:%s;base64,%s", file.MIMEType, base64.StdEncoding.EncodeToString(file.Data))
+
+		// images go in image_url parts; PDFs need a file part
+		if strings.HasPrefix(file.MIMEType, "image/") {
+			content = append(content, openAIContentPart{Type: "image_url", ImageURL: &openAIImageURL{URL: dataURL}})
+		} else {
+			content = append(content, openAIContentPart{Type: "file", File: &openAIFile{Filename: fmt.Sprintf("receipt-%d.pdf", i), FileData: dataURL}})
+		}
+	}
+
+	for _, instruction := range prompt.Instructions {
+		content = append(content, openAIContentPart{Type: "text", Text: instruction})
+	}
+
+	body, err := json.Marshal(openAIChatRequest{
+		Model:    p.Model,
+		Messages: []openAIMessage{{Role: "user", Content: content}},
+	})
+	if err != nil {
+		return nil, models.ReceiptSummary{}, fmt.Errorf("OpenAIParser: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", p.BaseURL+"/chat/completions", bytes.NewReader(body))
+	if err != nil {
+		return nil, models.ReceiptSummary{}, fmt.Errorf("OpenAIParser: failed to create request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	if p.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+p.APIKey)
+	}
+
+	resp, err := p.HTTPClient.Do(req)
+	if err != nil {
+		return nil, models.ReceiptSummary{}, fmt.Errorf("OpenAIParser: failed to make request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, models.ReceiptSummary{}, fmt.Errorf("OpenAIParser: failed to read response: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, models.ReceiptSummary{}, fmt.Errorf("OpenAIParser: received non-200 response code: %d: %s", resp.StatusCode, respBody)
+	}
+
+	var chatResp openAIChatResponse
+	if err := json.Unmarshal(respBody, &chatResp); err != nil {
+		return nil, models.ReceiptSummary{}, fmt.Errorf("OpenAIParser: failed to decode response: %w", err)
+	}
+
+	RecordUsage(ctx, Usage{
+		Parser:        p.Name(),
+		PromptVersion: prompt.Version,
+		InputTokens:   chatResp.Usage.PromptTokens,
+		OutputTokens:  chatResp.Usage.CompletionTokens,
+	})
+
+	if len(chatResp.Choices) == 0 {
+		return nil, models.ReceiptSummary{}, fmt.Errorf("OpenAIParser: response has no choices")
+	}
+
+	items, summary, err := parseJSONBody(chatResp.Choices[0].Message.Content)
+	if err != nil {
+		return nil, models.ReceiptSummary{}, fmt.Errorf("OpenAIParser: failed to parse JSON body: %w", err)
+	}
+
+	return items, summary, nil
+}
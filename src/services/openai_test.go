@@ -0,0 +1,82 @@
+package services_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/jiaming2012/receipt-bot/src/services"
+)
+
+func TestOpenAIParserSendsFilesAndParsesBareJSON(t *testing.T) {
+	var got struct {
+		Model    string `json:"model"`
+		Messages []struct {
+			Content []map[string]interface{} `json:"content"`
+		} `json:"messages"`
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/chat/completions" {
+			http.NotFound(w, r)
+			return
+		}
+
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Errorf("failed to decode request: %v", err)
+		}
+
+		// local models often answer without a ```json fence
+		answer := `{"items":[{"name":"Corn","quantity":2,"price":4.5,"is_case":false}],"summary":{"vendor":"Farmers Market","tax":0,"total":9,"total_units":2,"total_cases":0}}`
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"choices": []interface{}{map[string]interface{}{"message": map[string]string{"content": answer}}},
+			"usage":   map[string]int{"prompt_tokens": 1200, "completion_tokens": 80},
+		})
+	}))
+	defer server.Close()
+
+	parser := services.NewOpenAIParser(server.URL+"/v1", "", "llava")
+	files := []*services.ReceiptFile{
+		{Data: []byte("jpeg"), MIMEType: "image/jpeg"},
+		{Data: []byte("%PDF"), MIMEType: "application/pdf"},
+	}
+
+	prompt := &services.Prompt{Version: "test.v1", Instructions: []string{"Response in JSON format"}}
+
+	recorder := &services.UsageRecorder{}
+	ctx := services.WithUsageRecorder(context.Background(), recorder)
+
+	items, summary, err := parser.ParseReceipt(ctx, files, prompt)
+	if err != nil {
+		t.Fatalf("ParseReceipt: %v", err)
+	}
+
+	if len(items) != 1 || items[0].Name != "Corn" || summary.Total != 9 {
+		t.Errorf("unexpected receipt: %+v %+v", items, summary)
+	}
+
+	if calls := recorder.Calls(); len(calls) != 1 || calls[0].Parser != "openai/llava" || calls[0].InputTokens != 1200 || calls[0].OutputTokens != 80 {
+		t.Errorf("expected the call's token usage to be recorded, got %+v", calls)
+	}
+
+	if got.Model != "llava" || len(got.Messages) != 1 {
+		t.Fatalf("unexpected request: %+v", got)
+	}
+
+	content := got.Messages[0].Content
+	if content[0]["type"] != "image_url" || content[1]["type"] != "file" {
+		t.Errorf("expected an image part and a file part, got %v and %v", content[0]["type"], content[1]["type"])
+	}
+
+	if len(content) != 3 || content[2]["text"] != "Response in JSON format" {
+		t.Errorf("expected the prompt's instructions after the files, got %v", content[2:])
+	}
+
+	image, _ := content[0]["image_url"].(map[string]interface{})
+	if url, _ := image["url"].(string); !strings.HasPrefix(url, "data:image/jpeg;base64,") {
+		t.Errorf("expected the image as a data URL, got %q", url)
+	}
+}
@@ -0,0 +1,153 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"strings"
+
+	"github.com/jiaming2012/receipt-bot/src/models"
+)
+
+// ReceiptParser reads the items and summary of a receipt from its files. The
+// files are parts of one receipt, in order, and are sent with the prompt's
+// instructions.
+type ReceiptParser interface {
+	ParseReceipt(ctx context.Context, files []*ReceiptFile, prompt *Prompt) ([]models.ReceiptItem, models.ReceiptSummary, error)
+	// Name identifies the backend and model, e.g. "gemini/gemini-2.5-flash-lite".
+	Name() string
+}
+
+// StubParser returns canned receipts without calling a model, for tests and
+// for running the pipeline offline. Receipts are looked up by the SHA-256 of
+// the receipt's files (see StubReceiptKey), falling back to the "*" entry.
+type StubParser struct {
+	Receipts map[string]models.Receipt
+	// Err, if set, is returned for every receipt.
+	Err error
+}
+
+// LoadStubParser reads a StubParser's receipts from a JSON file mapping keys
+// to {"items": [...], "summary": {...}}.
+func LoadStubParser(path string) (*StubParser, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("LoadStubParser: %w", err)
+	}
+
+	var receipts map[string]models.Receipt
+	if err := json.Unmarshal(data, &receipts); err != nil {
+		return nil, fmt.Errorf("LoadStubParser: failed to parse %s: %w", path, err)
+	}
+
+	return &StubParser{Receipts: receipts}, nil
+}
+
+func (p *StubParser) Name() string {
+	return "stub"
+}
+
+func (p *StubParser) ParseReceipt(ctx context.Context, files []*ReceiptFile, prompt *Prompt) ([]models.ReceiptItem, models.ReceiptSummary, error) {
+	if p.Err != nil {
+		return nil, models.ReceiptSummary{}, p.Err
+	}
+
+	receipt, ok := p.Receipts[StubReceiptKey(files)]
+	if !ok {
+		receipt, ok = p.Receipts["*"]
+	}
+
+	if !ok {
+		return nil, models.ReceiptSummary{}, fmt.Errorf("StubParser: no receipt for %s", StubReceiptKey(files))
+	}
+
+	return receipt.Items, receipt.Summary, nil
+}
+
+// StubReceiptKey is the hex SHA-256 of the files' contents, in order.
+func StubReceiptKey(files []*ReceiptFile) string {
+	h := sha256.New()
+	for _, file := range files {
+		h.Write(file.Data)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// DedupeOverlappingItems drops lines read twice where two photos of the same
+// receipt overlap: the longest run of items at the end of one image that
+// repeats at the start of the next image is kept only once. A run like that
+// may also be a real repeat purchase, so the lines are only dropped when the
+// items only add up to the summary's total less tax, or to its units and
+// cases, without them. Items must be in receipt order.
+func DedupeOverlappingItems(items []models.ReceiptItem, summary models.ReceiptSummary) []models.ReceiptItem {
+	var out []models.ReceiptItem
+	for start := 0; start < len(items); {
+		end := start
+		for end < len(items) && items[end].Image == items[start].Image {
+			end++
+		}
+
+		next := items[start:end]
+		if len(out) > 0 && out[len(out)-1].Image != next[0].Image {
+			next = next[overlap(out, next):]
+		}
+
+		out = append(out, next...)
+		start = end
+	}
+
+	if len(out) == len(items) || matchesSummary(items, summary) || !matchesSummary(out, summary) {
+		return items
+	}
+
+	return out
+}
+
+// matchesSummary reports whether the items add up to the summary's total
+// less tax, or their quantities to its units and cases, as checked by
+// ValidateReceiptData.
+func matchesSummary(items []models.ReceiptItem, summary models.ReceiptSummary) bool {
+	var total float64
+	var units int
+	for _, item := range items {
+		total += item.Price * float64(item.Quantity)
+		units += item.Quantity
+	}
+
+	return math.Abs(summary.Total-summary.Tax-total) <= 0.01 || units == summary.TotalUnits+summary.TotalCases
+}
+
+// overlap returns the length of the longest suffix of prev, within its last
+// image, that equals a prefix of next.
+func overlap(prev, next []models.ReceiptItem) int {
+	lastImage := prev[len(prev)-1].Image
+	for n := min(len(prev), len(next)); n > 0; n-- {
+		suffix := prev[len(prev)-n:]
+		if suffix[0].Image != lastImage {
+			continue
+		}
+
+		matches := true
+		for i := range suffix {
+			if !sameReceiptLine(suffix[i], next[i]) {
+				matches = false
+				break
+			}
+		}
+
+		if matches {
+			return n
+		}
+	}
+
+	return 0
+}
+
+func sameReceiptLine(a, b models.ReceiptItem) bool {
+	return strings.EqualFold(strings.TrimSpace(a.Name), strings.TrimSpace(b.Name)) &&
+		a.Quantity == b.Quantity && a.Price == b.Price && a.IsCase == b.IsCase
+}
@@ -0,0 +1,74 @@
+package services_test
+
+import (
+	"testing"
+
+	"github.com/jiaming2012/receipt-bot/src/models"
+	"github.com/jiaming2012/receipt-bot/src/services"
+)
+
+func line(image int, name string, qty int, price float64) models.ReceiptItem {
+	return models.ReceiptItem{Image: image, Name: name, Quantity: qty, Price: price}
+}
+
+func TestDedupeOverlappingItems(t *testing.T) {
+	items := []models.ReceiptItem{
+		line(0, "Corn", 2, 10),
+		line(0, "Onions", 1, 5),
+		line(0, "Limes", 3, 2),
+		// the second photo repeats the last two lines of the first
+		line(1, "onions ", 1, 5),
+		line(1, "Limes", 3, 2),
+		line(1, "Cilantro", 1, 1),
+		// a genuine repeat within one photo is kept
+		line(1, "Cilantro", 1, 1),
+		line(2, "Tortillas", 4, 3),
+	}
+
+	// the totals of the receipt without the repeated lines
+	summary := models.ReceiptSummary{Total: 45, TotalUnits: 12}
+
+	got := services.DedupeOverlappingItems(items, summary)
+
+	want := []string{"Corn", "Onions", "Limes", "Cilantro", "Cilantro", "Tortillas"}
+	if len(got) != len(want) {
+		t.Fatalf("expected %d items, got %d: %+v", len(want), len(got), got)
+	}
+
+	for i, name := range want {
+		if got[i].Name != name {
+			t.Errorf("item %d: expected %s, got %s", i, name, got[i].Name)
+		}
+	}
+}
+
+func TestDedupeOverlappingItemsKeepsDifferentLines(t *testing.T) {
+	items := []models.ReceiptItem{
+		line(0, "Onions", 1, 5),
+		line(1, "Onions", 2, 5),
+	}
+
+	if got := services.DedupeOverlappingItems(items, models.ReceiptSummary{Total: 15, TotalUnits: 2}); len(got) != 2 {
+		t.Errorf("expected lines with different quantities to be kept, got %+v", got)
+	}
+}
+
+func TestDedupeOverlappingItemsKeepsRepeatPurchasesAtABoundary(t *testing.T) {
+	// two cases of limes bought separately, the second at the top of the
+	// second photo
+	items := []models.ReceiptItem{
+		line(0, "Corn", 2, 10),
+		line(0, "Limes", 1, 24),
+		line(1, "Limes", 1, 24),
+		line(1, "Onions", 1, 5),
+	}
+
+	got := services.DedupeOverlappingItems(items, models.ReceiptSummary{Total: 73, TotalUnits: 5})
+	if len(got) != 4 {
+		t.Errorf("expected the repeat purchase to be kept when the receipt adds up with it, got %+v", got)
+	}
+
+	if got := services.DedupeOverlappingItems(items, models.ReceiptSummary{Total: 49, TotalUnits: 4}); len(got) != 3 {
+		t.Errorf("expected the overlap to be dropped when the receipt adds up without it, got %+v", got)
+	}
+}
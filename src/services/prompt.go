@@ -0,0 +1,208 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/jiaming2012/receipt-bot/src/models"
+	"github.com/jiaming2012/receipt-bot/src/prompts"
+)
+
+// DefaultPrompt is the template used for receipts without a vendor override.
+const DefaultPrompt = "default"
+
+var promptFileRegex = regexp.MustCompile(`^([a-z0-9-]+)\.v([0-9]+)\.tmpl$`)
+
+// Prompt is the instructions sent to the model with a receipt's files.
+type Prompt struct {
+	// Version names the template, e.g. "sysco.v2", and is recorded on the
+	// purchase event.
+	Version      string
+	Instructions []string
+	// Correction is set when the prompt asks for an earlier answer to be
+	// fixed.
+	Correction *Correction
+}
+
+// Correction is an earlier answer that failed validation, sent back to the
+// model with the reason it was rejected.
+type Correction struct {
+	Previous models.Receipt
+	Problem  string
+}
+
+// PromptTemplates are the receipt prompts, one template per vendor.
+type PromptTemplates struct {
+	templates map[string]*promptTemplate
+}
+
+type promptTemplate struct {
+	name    string
+	version int
+	tmpl    *template.Template
+}
+
+// promptData is what a template is rendered with.
+type promptData struct {
+	// Files is the number of files the receipt is split over.
+	Files int
+	// ItemFields and SummaryFields list the fields of the response schema,
+	// e.g. "Quantity(int),Price(float),IsCase(bool),Name(string)", so
+	// templates ask for the names the answer is decoded with.
+	ItemFields    string
+	SummaryFields string
+}
+
+// DefaultPromptTemplates returns the templates built into the binary.
+func DefaultPromptTemplates() *PromptTemplates {
+	templates, err := LoadPromptTemplates(prompts.FS)
+	if err != nil {
+		panic(fmt.Sprintf("DefaultPromptTemplates: %v", err))
+	}
+	return templates
+}
+
+// LoadPromptTemplates reads the <name>.v<version>.tmpl files of each file
+// system, keeping the highest version of each name. Templates in later file
+// systems replace those of the same name in earlier ones, so a prompts
+// directory can override the built-in templates.
+func LoadPromptTemplates(fsyss ...fs.FS) (*PromptTemplates, error) {
+	t := &PromptTemplates{templates: make(map[string]*promptTemplate)}
+
+	for _, fsys := range fsyss {
+		paths, err := fs.Glob(fsys, "*.tmpl")
+		if err != nil {
+			return nil, fmt.Errorf("LoadPromptTemplates: %w", err)
+		}
+
+		found := make(map[string]*promptTemplate)
+		for _, p := range paths {
+			match := promptFileRegex.FindStringSubmatch(path.Base(p))
+			if match == nil {
+				return nil, fmt.Errorf("LoadPromptTemplates: %s: expected a name like sysco.v1.tmpl", p)
+			}
+
+			version, _ := strconv.Atoi(match[2])
+			if prev, ok := found[match[1]]; ok && prev.version > version {
+				continue
+			}
+
+			data, err := fs.ReadFile(fsys, p)
+			if err != nil {
+				return nil, fmt.Errorf("LoadPromptTemplates: %w", err)
+			}
+
+			tmpl, err := template.New(p).Option("missingkey=error").Parse(string(data))
+			if err != nil {
+				return nil, fmt.Errorf("LoadPromptTemplates: %w", err)
+			}
+
+			found[match[1]] = &promptTemplate{name: match[1], version: version, tmpl: tmpl}
+		}
+
+		for name, pt := range found {
+			t.templates[name] = pt
+		}
+	}
+
+	if _, ok := t.templates[DefaultPrompt]; !ok {
+		return nil, fmt.Errorf("LoadPromptTemplates: no %s template", DefaultPrompt)
+	}
+
+	return t, nil
+}
+
+// Select returns the name of the vendor override matching the first hint that
+// matches one, e.g. the bank description, or DefaultPrompt.
+func (t *PromptTemplates) Select(hints ...string) string {
+	var names []string
+	for name := range t.templates {
+		if name != DefaultPrompt {
+			names = append(names, name)
+		}
+	}
+
+	// prefer the most specific name when several match
+	sort.Slice(names, func(i, j int) bool {
+		if len(names[i]) != len(names[j]) {
+			return len(names[i]) > len(names[j])
+		}
+		return names[i] < names[j]
+	})
+
+	for _, hint := range hints {
+		hint = normalizePromptName(hint)
+		if hint == "" {
+			continue
+		}
+
+		for _, name := range names {
+			if strings.Contains(hint, normalizePromptName(name)) {
+				return name
+			}
+		}
+	}
+
+	return DefaultPrompt
+}
+
+// Render builds the named prompt for a receipt split over files files, adding
+// the correction if there is one.
+func (t *PromptTemplates) Render(name string, files int, correction *Correction) (*Prompt, error) {
+	pt, ok := t.templates[name]
+	if !ok {
+		return nil, fmt.Errorf("Render: unknown prompt %q", name)
+	}
+
+	var buf bytes.Buffer
+	schema := ReceiptResponseSchema()
+	data := promptData{
+		Files:         files,
+		ItemFields:    schemaFieldList(schema.Properties["items"].Items),
+		SummaryFields: schemaFieldList(schema.Properties["summary"]),
+	}
+
+	if err := pt.tmpl.Execute(&buf, data); err != nil {
+		return nil, fmt.Errorf("Render: %s: %w", name, err)
+	}
+
+	prompt := &Prompt{
+		Version:    fmt.Sprintf("%s.v%d", pt.name, pt.version),
+		Correction: correction,
+	}
+
+	for _, line := range strings.Split(buf.String(), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			prompt.Instructions = append(prompt.Instructions, line)
+		}
+	}
+
+	if correction != nil {
+		previous, _ := json.Marshal(correction.Previous)
+		prompt.Instructions = append(prompt.Instructions,
+			fmt.Sprintf("Your previous answer for this receipt was: %s", previous),
+			fmt.Sprintf("It failed validation: %s", correction.Problem),
+			"Read the receipt again and correct the answer; check every quantity and price against the receipt",
+		)
+	}
+
+	return prompt, nil
+}
+
+func normalizePromptName(s string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(s) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,107 @@
+package services_test
+
+import (
+	"io/fs"
+	"regexp"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"google.golang.org/genai"
+
+	"github.com/jiaming2012/receipt-bot/src/prompts"
+	"github.com/jiaming2012/receipt-bot/src/services"
+)
+
+func TestPromptTemplatesSelectVendorOverrides(t *testing.T) {
+	templates := services.DefaultPromptTemplates()
+
+	tests := []struct {
+		hints []string
+		want  string
+	}{
+		{hints: []string{"RESTAURANT DEPOT #0412"}, want: "restaurant-depot"},
+		{hints: []string{"SYSCO BALTIMORE LLC"}, want: "sysco"},
+		{hints: []string{"CORNER STORE"}, want: services.DefaultPrompt},
+		// the vendor read from a first pass is used when the description is
+		// unhelpful
+		{hints: []string{"POS PURCHASE 8812", "Sysco"}, want: "sysco"},
+	}
+
+	for _, tt := range tests {
+		if got := templates.Select(tt.hints...); got != tt.want {
+			t.Errorf("Select(%q): expected %s, got %s", tt.hints, tt.want, got)
+		}
+	}
+}
+
+func TestLoadPromptTemplatesUsesLatestVersionAndOverrides(t *testing.T) {
+	dir := fstest.MapFS{
+		"sysco.v1.tmpl":       {Data: []byte("old sysco prompt")},
+		"sysco.v2.tmpl":       {Data: []byte("{{if gt .Files 1}}{{.Files}} pages{{end}}\nnew sysco prompt")},
+		"corner-mart.v1.tmpl": {Data: []byte("corner mart prompt")},
+	}
+
+	templates, err := services.LoadPromptTemplates(prompts.FS, dir)
+	if err != nil {
+		t.Fatalf("LoadPromptTemplates: %v", err)
+	}
+
+	prompt, err := templates.Render(templates.Select("SYSCO"), 2, nil)
+	if err != nil {
+		t.Fatalf("Render: %v", err)
+	}
+
+	if prompt.Version != "sysco.v2" || strings.Join(prompt.Instructions, "|") != "2 pages|new sysco prompt" {
+		t.Errorf("unexpected prompt: %+v", prompt)
+	}
+
+	if got := templates.Select("CORNER MART 7"); got != "corner-mart" {
+		t.Errorf("expected the added vendor template, got %s", got)
+	}
+
+	if _, err := services.LoadPromptTemplates(fstest.MapFS{"sysco.tmpl": {Data: []byte("x")}}); err == nil {
+		t.Error("expected an unversioned template name to be rejected")
+	}
+}
+
+func TestTemplatesAskForTheResponseSchemaFields(t *testing.T) {
+	schema := services.ReceiptResponseSchema()
+	fields := map[string]genai.Type{}
+	for _, properties := range []map[string]*genai.Schema{schema.Properties["items"].Items.Properties, schema.Properties["summary"].Properties} {
+		for name, property := range properties {
+			fields[name] = property.Type
+		}
+	}
+	typeNames := map[string]genai.Type{"string": genai.TypeString, "int": genai.TypeInteger, "float": genai.TypeNumber, "bool": genai.TypeBoolean}
+	fieldRegex := regexp.MustCompile(`(\w+)\((string|int|float|bool)\)`)
+
+	paths, err := fs.Glob(prompts.FS, "*.tmpl")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	templates := services.DefaultPromptTemplates()
+	for _, p := range paths {
+		name, _, _ := strings.Cut(p, ".v")
+		t.Run(name, func(t *testing.T) {
+			prompt, err := templates.Render(name, 2, nil)
+			if err != nil {
+				t.Fatalf("Render: %v", err)
+			}
+
+			instructions := strings.Join(prompt.Instructions, "\n")
+			for _, want := range []string{"Quantity(int),Price(float),IsCase(bool),Name(string)", "vendor(string),Tax(float),Total(float),total_units(int),total_cases(int)"} {
+				if !strings.Contains(instructions, want) {
+					t.Errorf("expected the prompt to ask for %s, got:\n%s", want, instructions)
+				}
+			}
+
+			for _, match := range fieldRegex.FindAllStringSubmatch(instructions, -1) {
+				if typ, ok := fields[match[1]]; !ok || typ != typeNames[match[2]] {
+					t.Errorf("%s is not a field of the response schema", match[0])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,215 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/jiaming2012/receipt-bot/src/models"
+)
+
+// DefaultMaxParseAttempts is how many times a receipt is parsed before one
+// that keeps failing validation is left for review.
+const DefaultMaxParseAttempts = 3
+
+// ErrParseFailed is the Invalid error of a ReadResult whose first attempt
+// failed without an answer, e.g. because the model's response couldn't be
+// decoded.
+var ErrParseFailed = errors.New("failed to parse receipt")
+
+// ReceiptReader parses the receipt attached to a bank transaction and checks
+// it against the transaction. A receipt that fails validation is sent back to
+// the parser with the error, up to MaxAttempts times, the last attempt going
+// to Escalation if one is set.
+type ReceiptReader struct {
+	Parser      ReceiptParser
+	Escalation  ReceiptParser
+	MaxAttempts int
+	Prompts     *PromptTemplates
+	// HTTPClient downloads the receipt attachments.
+	HTTPClient *http.Client
+}
+
+type ReceiptReaderOption func(*ReceiptReader)
+
+func WithMaxParseAttempts(n int) ReceiptReaderOption {
+	return func(r *ReceiptReader) {
+		r.MaxAttempts = n
+	}
+}
+
+// WithEscalation sets the parser used for the last attempt, typically a
+// stronger and more expensive model.
+func WithEscalation(parser ReceiptParser) ReceiptReaderOption {
+	return func(r *ReceiptReader) {
+		r.Escalation = parser
+	}
+}
+
+func WithPromptTemplates(prompts *PromptTemplates) ReceiptReaderOption {
+	return func(r *ReceiptReader) {
+		r.Prompts = prompts
+	}
+}
+
+func NewReceiptReader(parser ReceiptParser, opts ...ReceiptReaderOption) *ReceiptReader {
+	r := &ReceiptReader{
+		Parser:      parser,
+		MaxAttempts: DefaultMaxParseAttempts,
+		HTTPClient:  &http.Client{Timeout: defaultAttachmentHTTPTimeout},
+	}
+
+	for _, opt := range opts {
+		opt(r)
+	}
+
+	if r.Prompts == nil {
+		r.Prompts = DefaultPromptTemplates()
+	}
+
+	if r.MaxAttempts < 1 {
+		r.MaxAttempts = 1
+	}
+
+	return r
+}
+
+// ParseAttempt records one call to a parser.
+type ParseAttempt struct {
+	Parser        string
+	PromptVersion string
+	// Problem is why the answer was rejected; empty if it passed validation.
+	Problem string
+}
+
+func (a ParseAttempt) String() string {
+	problem := a.Problem
+	if problem == "" {
+		problem = "ok"
+	}
+	return fmt.Sprintf("%s (%s): %s", a.Parser, a.PromptVersion, problem)
+}
+
+// ReadResult is the last answer read from a receipt.
+type ReadResult struct {
+	Items   []models.ReceiptItem
+	Summary models.ReceiptSummary
+	// PromptVersion is the prompt the answer was read with.
+	PromptVersion string
+	Attempts      []ParseAttempt
+	// Invalid is why the answer failed validation; nil if it passed.
+	Invalid error
+}
+
+// AttemptLog lists the attempts one per line, for storing next to the
+// receipt.
+func (r *ReadResult) AttemptLog() string {
+	var lines []string
+	for i, attempt := range r.Attempts {
+		lines = append(lines, fmt.Sprintf("%d. %s", i+1, attempt))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Read parses and validates the receipt attached to tx, which may be split
+// over several photos or PDFs. The prompt is the vendor override matching the
+// bank description, if any; re-prompts fall back to the vendor read from the
+// previous answer. Attachments the model can't read return
+// ErrUnsupportedAttachment, and ones that can't be downloaded or converted
+// ErrAttachmentFailed, before the parser is called. A receipt still
+// invalid after the last attempt is returned with Invalid set, as is one the
+// parser fails to read at all, with Invalid wrapping ErrParseFailed. The
+// error of the context's usage Check (see WithUsageRecorder) is returned if
+// it stops a parse.
+func (r *ReceiptReader) Read(ctx context.Context, tx *models.MercuryTransaction) (*ReadResult, error) {
+	if len(tx.Attachments) == 0 {
+		return nil, fmt.Errorf("ReceiptReader.Read: no receipt attachments")
+	}
+
+	var files []*ReceiptFile
+	for _, attachment := range tx.Attachments {
+		file, err := FetchReceiptFile(ctx, r.HTTPClient, attachment)
+		if errors.Is(err, ErrUnsupportedAttachment) {
+			return nil, fmt.Errorf("ReceiptReader.Read: %w", err)
+		} else if err != nil {
+			return nil, fmt.Errorf("ReceiptReader.Read: %w: %w", ErrAttachmentFailed, err)
+		}
+
+		files = append(files, file)
+	}
+
+	return r.ReadFiles(ctx, tx, files)
+}
+
+// ReadFiles is Read for receipt files that have already been fetched.
+func (r *ReceiptReader) ReadFiles(ctx context.Context, tx *models.MercuryTransaction, files []*ReceiptFile) (*ReadResult, error) {
+	promptName := r.Prompts.Select(tx.BankDescription)
+
+	var result *ReadResult
+	var attempts []ParseAttempt
+	var correction *Correction
+	for attempt := 1; attempt <= r.MaxAttempts; attempt++ {
+		parser := r.Parser
+		if attempt > 1 && attempt == r.MaxAttempts && r.Escalation != nil {
+			parser = r.Escalation
+		}
+
+		if result != nil && promptName == DefaultPrompt {
+			promptName = r.Prompts.Select(result.Summary.Vendor)
+		}
+
+		prompt, err := r.Prompts.Render(promptName, len(files), correction)
+		if err != nil {
+			return nil, fmt.Errorf("ReceiptReader.ReadFiles: %w", err)
+		}
+
+		// a receipt that would go over the AI budget is read again in full
+		// later, so earlier answers are dropped
+		if err := CheckUsage(ctx); err != nil {
+			return nil, fmt.Errorf("ReceiptReader.ReadFiles: %w", err)
+		}
+
+		items, summary, err := parser.ParseReceipt(ctx, files, prompt)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, fmt.Errorf("ReceiptReader.ReadFiles: %s: %w", parser.Name(), err)
+			}
+
+			// keep the earlier answer, if any, for review rather than losing it
+			log.Warnf("Attempt %d to parse receipt for tx ID %s with %s failed: %v", attempt, tx.ID, parser.Name(), err)
+			attempts = append(attempts, ParseAttempt{Parser: parser.Name(), PromptVersion: prompt.Version, Problem: err.Error()})
+			if result == nil {
+				result = &ReadResult{PromptVersion: prompt.Version, Invalid: fmt.Errorf("%w with %s: %w", ErrParseFailed, parser.Name(), err)}
+			}
+			break
+		}
+
+		items = DedupeOverlappingItems(items, summary)
+		invalid := ValidateReceiptData(items, summary, tx)
+
+		attempt := ParseAttempt{Parser: parser.Name(), PromptVersion: prompt.Version}
+		if invalid != nil {
+			attempt.Problem = invalid.Error()
+		}
+		attempts = append(attempts, attempt)
+
+		result = &ReadResult{Items: items, Summary: summary, PromptVersion: prompt.Version, Invalid: invalid}
+		if invalid == nil {
+			break
+		}
+
+		log.Warnf("Receipt for tx ID %s failed validation with %s: %v", tx.ID, parser.Name(), invalid)
+		correction = &Correction{
+			Previous: models.Receipt{Items: items, Summary: summary},
+			Problem:  invalid.Error(),
+		}
+	}
+
+	result.Attempts = attempts
+
+	return result, nil
+}
@@ -0,0 +1,118 @@
+package services_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/jiaming2012/receipt-bot/src/models"
+	"github.com/jiaming2012/receipt-bot/src/services"
+)
+
+// scriptedParser returns its answers in order and records the prompts it was
+// sent.
+type scriptedParser struct {
+	name    string
+	answers []models.Receipt
+	prompts []*services.Prompt
+}
+
+func (p *scriptedParser) Name() string {
+	return p.name
+}
+
+func (p *scriptedParser) ParseReceipt(ctx context.Context, files []*services.ReceiptFile, prompt *services.Prompt) ([]models.ReceiptItem, models.ReceiptSummary, error) {
+	answer := p.answers[len(p.prompts)]
+	p.prompts = append(p.prompts, prompt)
+	return answer.Items, answer.Summary, nil
+}
+
+func receiptTransaction(t *testing.T) *models.MercuryTransaction {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("\xff\xd8\xff\xe0\x00\x10JFIF\x00"))
+	}))
+	t.Cleanup(server.Close)
+
+	return &models.MercuryTransaction{
+		ID:          "tx-1",
+		Amount:      -10,
+		Attachments: []*models.MercuryTransactionAttachment{{URL: server.URL + "/receipt.jpg"}},
+	}
+}
+
+func receipt(price float64) models.Receipt {
+	return models.Receipt{
+		Items:   []models.ReceiptItem{{Name: "Corn", Quantity: 1, Price: price}},
+		Summary: models.ReceiptSummary{Vendor: "Farmers Market", Total: 10, TotalUnits: 1},
+	}
+}
+
+func TestReceiptReaderRepromptsAndEscalates(t *testing.T) {
+	weak := &scriptedParser{name: "weak", answers: []models.Receipt{receipt(9), receipt(8)}}
+	strong := &scriptedParser{name: "strong", answers: []models.Receipt{receipt(10)}}
+
+	reader := services.NewReceiptReader(weak, services.WithMaxParseAttempts(3), services.WithEscalation(strong))
+
+	result, err := reader.Read(context.Background(), receiptTransaction(t))
+	if err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+
+	if result.Invalid != nil || result.Items[0].Price != 10 {
+		t.Fatalf("expected the escalated answer to pass, got %+v", result)
+	}
+
+	if len(weak.prompts) != 2 || weak.prompts[0].Correction != nil {
+		t.Fatalf("expected a first attempt without a correction, got %+v", weak.prompts)
+	}
+
+	correction := weak.prompts[1].Correction
+	if correction.Previous.Items[0].Price != 9 || !strings.Contains(correction.Problem, "mismatch") {
+		t.Errorf("expected the previous answer and its validation error, got %+v", correction)
+	}
+
+	if last := weak.prompts[1].Instructions; !strings.Contains(strings.Join(last, "\n"), "failed validation") {
+		t.Errorf("expected the re-prompt to explain the validation error, got %q", last)
+	}
+
+	if len(strong.prompts) != 1 || strong.prompts[0].Correction.Previous.Items[0].Price != 8 {
+		t.Errorf("expected the escalation to see the second answer, got %+v", strong.prompts)
+	}
+
+	if log := result.AttemptLog(); !strings.HasPrefix(log, "1. weak (default.v1): ") || !strings.HasSuffix(log, "3. strong (default.v1): ok") {
+		t.Errorf("unexpected attempt log:\n%s", log)
+	}
+}
+
+func TestReceiptReaderReturnsInvalidReceiptAfterLastAttempt(t *testing.T) {
+	parser := &scriptedParser{name: "weak", answers: []models.Receipt{receipt(9), receipt(9)}}
+
+	result, err := services.NewReceiptReader(parser, services.WithMaxParseAttempts(2)).Read(context.Background(), receiptTransaction(t))
+	if err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+
+	if result.Invalid == nil || len(result.Attempts) != 2 {
+		t.Errorf("expected an invalid receipt after 2 attempts, got %+v", result)
+	}
+}
+
+func TestReceiptReaderReturnsParseFailuresForReview(t *testing.T) {
+	parser := &services.StubParser{Err: errors.New("response does not match the receipt schema")}
+
+	result, err := services.NewReceiptReader(parser).Read(context.Background(), receiptTransaction(t))
+	if err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+
+	if !errors.Is(result.Invalid, services.ErrParseFailed) || !strings.Contains(result.Invalid.Error(), "receipt schema") {
+		t.Fatalf("expected the parse failure as the receipt's problem, got %+v", result)
+	}
+
+	if log := result.AttemptLog(); log != "1. stub (default.v1): response does not match the receipt schema" {
+		t.Errorf("unexpected attempt log:\n%s", log)
+	}
+}
@@ -0,0 +1,115 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"google.golang.org/genai"
+
+	"github.com/jiaming2012/receipt-bot/src/models"
+)
+
+// ReceiptResponseSchema is the Gemini response schema for models.Receipt,
+// derived from its json and description tags so the two can't drift apart.
+func ReceiptResponseSchema() *genai.Schema {
+	return schemaFor(reflect.TypeOf(models.Receipt{}))
+}
+
+// schemaFieldList lists the required properties of an object schema with their
+// types, e.g. "Quantity(int),Price(float)", for prompts that spell out the
+// fields of the response.
+func schemaFieldList(schema *genai.Schema) string {
+	typeNames := map[genai.Type]string{
+		genai.TypeString:  "string",
+		genai.TypeInteger: "int",
+		genai.TypeNumber:  "float",
+		genai.TypeBoolean: "bool",
+	}
+
+	var fields []string
+	for _, name := range schema.Required {
+		fields = append(fields, fmt.Sprintf("%s(%s)", name, typeNames[schema.Properties[name].Type]))
+	}
+	return strings.Join(fields, ",")
+}
+
+// schemaFor derives a response schema from a Go type. Fields tagged json:"-"
+// are left out and fields tagged omitempty are optional.
+func schemaFor(t reflect.Type) *genai.Schema {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return &genai.Schema{Type: genai.TypeString}
+	case reflect.Bool:
+		return &genai.Schema{Type: genai.TypeBoolean}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &genai.Schema{Type: genai.TypeInteger}
+	case reflect.Float32, reflect.Float64:
+		return &genai.Schema{Type: genai.TypeNumber}
+	case reflect.Slice, reflect.Array:
+		return &genai.Schema{Type: genai.TypeArray, Items: schemaFor(t.Elem())}
+	case reflect.Struct:
+		schema := &genai.Schema{Type: genai.TypeObject, Properties: make(map[string]*genai.Schema)}
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			if !field.IsExported() {
+				continue
+			}
+
+			name, opts, _ := strings.Cut(field.Tag.Get("json"), ",")
+			if name == "-" {
+				continue
+			} else if name == "" {
+				name = field.Name
+			}
+
+			prop := schemaFor(field.Type)
+			prop.Description = field.Tag.Get("description")
+
+			schema.Properties[name] = prop
+			schema.PropertyOrdering = append(schema.PropertyOrdering, name)
+			if !strings.Contains(opts, "omitempty") {
+				schema.Required = append(schema.Required, name)
+			}
+		}
+		return schema
+	default:
+		panic(fmt.Sprintf("schemaFor: unsupported type %s", t))
+	}
+}
+
+// ParseReceiptJSON decodes a response to ReceiptResponseSchema strictly into
+// models.Receipt. A response that doesn't conform to the schema, e.g. with
+// unknown fields or prices written as "$4.99", is an error.
+func ParseReceiptJSON(text string) ([]models.ReceiptItem, models.ReceiptSummary, error) {
+	dec := json.NewDecoder(strings.NewReader(text))
+	dec.DisallowUnknownFields()
+
+	var receipt models.Receipt
+	if err := dec.Decode(&receipt); err != nil {
+		return nil, models.ReceiptSummary{}, fmt.Errorf("response does not match the receipt schema: %w", err)
+	}
+
+	if len(receipt.Items) == 0 {
+		return nil, models.ReceiptSummary{}, fmt.Errorf("failed to parse items from JSON")
+	}
+
+	if receipt.Summary.Total <= 0.0 {
+		return nil, models.ReceiptSummary{}, fmt.Errorf("failed to parse summary from JSON")
+	}
+
+	for i := range receipt.Items {
+		// mirror ReceiptItemsJSON.ToReceiptItem
+		if receipt.Items[i].Quantity <= 0 {
+			receipt.Items[i].Quantity = 1
+		}
+	}
+
+	return receipt.Items, receipt.Summary, nil
+}
@@ -0,0 +1,85 @@
+package services_test
+
+import (
+	"slices"
+	"testing"
+
+	"google.golang.org/genai"
+
+	"github.com/jiaming2012/receipt-bot/src/services"
+)
+
+func TestReceiptResponseSchemaMatchesTheModel(t *testing.T) {
+	schema := services.ReceiptResponseSchema()
+
+	items := schema.Properties["items"]
+	if items == nil || items.Type != genai.TypeArray {
+		t.Fatalf("expected items to be an array, got %+v", items)
+	}
+
+	item := items.Items
+	for name, want := range map[string]genai.Type{
+		"Name":     genai.TypeString,
+		"Quantity": genai.TypeInteger,
+		"Price":    genai.TypeNumber,
+		"IsCase":   genai.TypeBoolean,
+		"Image":    genai.TypeInteger,
+	} {
+		if got := item.Properties[name]; got == nil || got.Type != want {
+			t.Errorf("expected item property %s of type %s, got %+v", name, want, got)
+		}
+	}
+
+	if _, ok := item.Properties["PendingPurchase"]; ok {
+		t.Errorf("expected fields tagged json:\"-\" to be left out")
+	}
+
+	if slices.Contains(item.Required, "Image") || !slices.Contains(item.Required, "Price") {
+		t.Errorf("expected only Image to be optional, got required %v", item.Required)
+	}
+
+	if schema.Properties["summary"].Properties["total_units"].Description == "" {
+		t.Errorf("expected descriptions to be carried over from the model")
+	}
+}
+
+func TestParseReceiptJSON(t *testing.T) {
+	text := `{"items":[{"Name":"Corn","Quantity":2,"Price":4.99,"IsCase":false}],"summary":{"vendor":"Farmers Market","Tax":0,"Total":9.98,"total_units":2,"total_cases":0}}`
+
+	items, summary, err := services.ParseReceiptJSON(text)
+	if err != nil {
+		t.Fatalf("ParseReceiptJSON: %v", err)
+	}
+
+	if len(items) != 1 || items[0].Price != 4.99 || items[0].Quantity != 2 || summary.Total != 9.98 {
+		t.Errorf("unexpected receipt: %+v %+v", items, summary)
+	}
+}
+
+func TestParseReceiptJSONRejectsNonConformingResponses(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+	}{
+		{
+			name: "fenced",
+			text: "```json\n{\"items\":[{\"Name\":\"Corn\",\"Quantity\":2,\"Price\":4.99,\"IsCase\":false}],\"summary\":{\"vendor\":\"Farmers Market\",\"Tax\":0,\"Total\":9.98,\"total_units\":2,\"total_cases\":0}}\n```",
+		},
+		{
+			name: "string prices",
+			text: `{"items":[{"Name":"Corn","Quantity":2,"Price":"$4.99","IsCase":false}],"summary":{"vendor":"Farmers Market","Tax":0,"Total":9.98,"total_units":2,"total_cases":0}}`,
+		},
+		{
+			name: "unknown field",
+			text: `{"items":[{"Name":"Corn","Quantity":2,"Price":4.99,"IsCase":false,"unit_price":2.5}],"summary":{"vendor":"Farmers Market","Tax":0,"Total":9.98,"total_units":2,"total_cases":0}}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if items, summary, err := services.ParseReceiptJSON(tt.text); err == nil {
+				t.Errorf("expected an error, got %+v %+v", items, summary)
+			}
+		})
+	}
+}
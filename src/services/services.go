@@ -67,7 +67,7 @@ func GroupPurchasesByBankTxID(pendingPurchases []*models.BaserowPurchaseTable, p
 		}
 
 		if purchaseEvent.BankTxID == "" {
-			return nil, fmt.Errorf("GroupPurchasesByBankTxID: empty BankTxID for purchase event ID %s", purchaseEvent.ID)
+			return nil, fmt.Errorf("GroupPurchasesByBankTxID: empty BankTxID for purchase event ID %d", purchaseEvent.ID)
 		}
 
 		if _, exists := grouped[purchaseEvent.BankTxID]; !exists {
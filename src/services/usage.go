@@ -0,0 +1,93 @@
+package services
+
+import (
+	"context"
+	"strings"
+	"sync"
+)
+
+// ModelPrice is a model's list price in US dollars per million tokens.
+type ModelPrice struct {
+	InputPerMillion  float64
+	OutputPerMillion float64
+}
+
+// ModelPrices are used to estimate the cost of model calls. Prices can be
+// overridden or added to in the parser config.
+var ModelPrices = map[string]ModelPrice{
+	"gemini-2.5-flash-lite": {InputPerMillion: 0.10, OutputPerMillion: 0.40},
+	"gemini-2.5-flash":      {InputPerMillion: 0.30, OutputPerMillion: 2.50},
+	"gemini-2.5-pro":        {InputPerMillion: 1.25, OutputPerMillion: 10.00},
+	"gpt-4o-mini":           {InputPerMillion: 0.15, OutputPerMillion: 0.60},
+	"gpt-4o":                {InputPerMillion: 2.50, OutputPerMillion: 10.00},
+}
+
+// Usage is the tokens used by one model call.
+type Usage struct {
+	// Parser is the parser's Name, e.g. "gemini/gemini-2.5-flash-lite".
+	Parser        string
+	PromptVersion string
+	InputTokens   int
+	OutputTokens  int
+}
+
+// Cost estimates the call's cost in US dollars from ModelPrices. known is
+// false, and the cost 0, for models without a price.
+func (u Usage) Cost() (cost float64, known bool) {
+	model := u.Parser
+	if i := strings.Index(model, "/"); i >= 0 {
+		model = model[i+1:]
+	}
+
+	price, known := ModelPrices[model]
+	return (float64(u.InputTokens)*price.InputPerMillion + float64(u.OutputTokens)*price.OutputPerMillion) / 1e6, known
+}
+
+// UsageRecorder collects the usage of the model calls made with a context
+// returned by WithUsageRecorder.
+type UsageRecorder struct {
+	// Check, if set, is called with the calls recorded so far before each
+	// model call; an error, e.g. an exhausted budget, stops the call.
+	Check func(calls []Usage) error
+
+	mu    sync.Mutex
+	calls []Usage
+}
+
+func (r *UsageRecorder) Add(u Usage) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.calls = append(r.calls, u)
+}
+
+// Calls returns the recorded calls, in order.
+func (r *UsageRecorder) Calls() []Usage {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return append([]Usage(nil), r.calls...)
+}
+
+type usageRecorderKey struct{}
+
+func WithUsageRecorder(ctx context.Context, r *UsageRecorder) context.Context {
+	return context.WithValue(ctx, usageRecorderKey{}, r)
+}
+
+// CheckUsage runs the context's recorder's Check, if it has one. The
+// ReceiptReader calls it before every parse.
+func CheckUsage(ctx context.Context) error {
+	if r, ok := ctx.Value(usageRecorderKey{}).(*UsageRecorder); ok && r.Check != nil {
+		return r.Check(r.Calls())
+	}
+	return nil
+}
+
+// RecordUsage adds u to the context's recorder, if it has one. Parsers call it
+// after every model call.
+func RecordUsage(ctx context.Context, u Usage) {
+	if r, ok := ctx.Value(usageRecorderKey{}).(*UsageRecorder); ok {
+		r.Add(u)
+	}
+}
@@ -0,0 +1,183 @@
+package syncstate
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/jiaming2012/receipt-bot/src/models"
+)
+
+// DefaultPath is where the sync state is kept when SYNC_STATE_FILE is not set.
+const DefaultPath = "sync_state.json"
+
+// AccountState records how far an account's transactions have been ingested.
+// Every transaction created at or before LastProcessedAt has been written to
+// Baserow, either as a purchase or as a pending purchase.
+type AccountState struct {
+	Name            string    `json:"name,omitempty"`
+	LastProcessedAt time.Time `json:"last_processed_at"`
+	UpdatedAt       time.Time `json:"updated_at"`
+}
+
+// Store keeps the sync state of every tenant's bank accounts in a JSON file.
+type Store struct {
+	path string
+	mu   sync.Mutex
+}
+
+// state is the file layout: tenant name -> account ID -> state.
+type state map[string]map[string]*AccountState
+
+func NewStore(path string) *Store {
+	return &Store{path: path}
+}
+
+// Cursors returns the last processed time of each of the tenant's accounts
+// that has been synced before.
+func (s *Store) Cursors(tenant string) (map[string]time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	st, err := s.load()
+	if err != nil {
+		return nil, fmt.Errorf("syncstate.Cursors: %w", err)
+	}
+
+	cursors := make(map[string]time.Time)
+	for accountID, account := range st[tenant] {
+		cursors[accountID] = account.LastProcessedAt
+	}
+
+	return cursors, nil
+}
+
+// Save records new cursors for the tenant's accounts. Accounts not in cursors
+// are left as they are.
+func (s *Store) Save(tenant string, accounts []*models.MercuryAccount, cursors map[string]time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	st, err := s.load()
+	if err != nil {
+		return fmt.Errorf("syncstate.Save: %w", err)
+	}
+
+	if st[tenant] == nil {
+		st[tenant] = make(map[string]*AccountState)
+	}
+
+	names := make(map[string]string)
+	for _, account := range accounts {
+		names[account.ID] = account.Name
+	}
+
+	now := time.Now().UTC()
+	for accountID, cursor := range cursors {
+		st[tenant][accountID] = &AccountState{
+			Name:            names[accountID],
+			LastProcessedAt: cursor.UTC(),
+			UpdatedAt:       now,
+		}
+	}
+
+	out, err := json.MarshalIndent(st, "", "  ")
+	if err != nil {
+		return fmt.Errorf("syncstate.Save: %w", err)
+	}
+
+	// write to a temporary file first so a crash never leaves a truncated state
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, out, 0o644); err != nil {
+		return fmt.Errorf("syncstate.Save: %w", err)
+	}
+
+	if err := os.Rename(tmp, s.path); err != nil {
+		return fmt.Errorf("syncstate.Save: %w", err)
+	}
+
+	return nil
+}
+
+func (s *Store) load() (state, error) {
+	data, err := os.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return make(state), nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", s.path, err)
+	}
+
+	st := make(state)
+	if err := json.Unmarshal(data, &st); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", filepath.Base(s.path), err)
+	}
+
+	return st, nil
+}
+
+// Start returns the date to fetch transactions from: the earliest cursor of
+// the accounts, or fallback for accounts that have never been synced.
+func Start(accounts []*models.MercuryAccount, cursors map[string]time.Time, fallback time.Time) time.Time {
+	start := time.Time{}
+	for _, account := range accounts {
+		cursor, ok := cursors[account.ID]
+		if !ok {
+			cursor = fallback
+		}
+
+		if start.IsZero() || cursor.Before(start) {
+			start = cursor
+		}
+	}
+
+	if start.IsZero() {
+		return fallback
+	}
+
+	return start
+}
+
+// Advance returns the cursors after a successful ingest of the valid and
+// invalid transactions. An account's cursor moves to its newest valid
+// transaction, but never past its oldest invalid one, so transactions still
+// missing a receipt are fetched again on the next run. Cursors never move
+// backwards.
+func Advance(cursors map[string]time.Time, valid, invalid []*models.MercuryTransaction) (map[string]time.Time, error) {
+	oldestInvalid := make(map[string]time.Time)
+	for _, tx := range invalid {
+		createdAt, err := time.Parse(time.RFC3339, tx.CreatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("syncstate.Advance: transaction %s: %w", tx.ID, err)
+		}
+
+		if t, ok := oldestInvalid[tx.AccountID]; !ok || createdAt.Before(t) {
+			oldestInvalid[tx.AccountID] = createdAt
+		}
+	}
+
+	next := make(map[string]time.Time)
+	for accountID, cursor := range cursors {
+		next[accountID] = cursor
+	}
+
+	for _, tx := range valid {
+		createdAt, err := time.Parse(time.RFC3339, tx.CreatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("syncstate.Advance: transaction %s: %w", tx.ID, err)
+		}
+
+		if limit, ok := oldestInvalid[tx.AccountID]; ok && !createdAt.Before(limit) {
+			continue
+		}
+
+		if createdAt.After(next[tx.AccountID]) {
+			next[tx.AccountID] = createdAt
+		}
+	}
+
+	return next, nil
+}
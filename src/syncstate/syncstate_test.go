@@ -0,0 +1,95 @@
+package syncstate_test
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jiaming2012/receipt-bot/src/models"
+	"github.com/jiaming2012/receipt-bot/src/syncstate"
+)
+
+func tx(id, accountID, createdAt string) *models.MercuryTransaction {
+	return &models.MercuryTransaction{ID: id, AccountID: accountID, CreatedAt: createdAt}
+}
+
+func TestAdvanceStopsBeforeTheOldestInvalidTransaction(t *testing.T) {
+	old := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	cursors := map[string]time.Time{"checking": old, "savings": old}
+
+	valid := []*models.MercuryTransaction{
+		tx("tx-4", "checking", "2024-05-04T10:00:00Z"),
+		tx("tx-2", "checking", "2024-05-02T10:00:00Z"),
+		tx("tx-5", "savings", "2024-05-05T10:00:00Z"),
+		tx("tx-6", "card", "2024-05-06T10:00:00Z"),
+	}
+	invalid := []*models.MercuryTransaction{
+		tx("tx-3", "checking", "2024-05-03T10:00:00Z"),
+	}
+
+	next, err := syncstate.Advance(cursors, valid, invalid)
+	if err != nil {
+		t.Fatalf("Advance: %v", err)
+	}
+
+	want := map[string]time.Time{
+		"checking": time.Date(2024, 5, 2, 10, 0, 0, 0, time.UTC),
+		"savings":  time.Date(2024, 5, 5, 10, 0, 0, 0, time.UTC),
+		"card":     time.Date(2024, 5, 6, 10, 0, 0, 0, time.UTC),
+	}
+
+	for accountID, w := range want {
+		if !next[accountID].Equal(w) {
+			t.Errorf("expected %s cursor %s, got %s", accountID, w, next[accountID])
+		}
+	}
+}
+
+func TestAdvanceNeverMovesBackwards(t *testing.T) {
+	latest := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+
+	next, err := syncstate.Advance(map[string]time.Time{"checking": latest}, []*models.MercuryTransaction{
+		tx("tx-1", "checking", "2024-05-01T10:00:00Z"),
+	}, nil)
+	if err != nil {
+		t.Fatalf("Advance: %v", err)
+	}
+
+	if !next["checking"].Equal(latest) {
+		t.Errorf("expected a backfill to keep the cursor at %s, got %s", latest, next["checking"])
+	}
+}
+
+func TestStoreKeepsCursorsPerTenant(t *testing.T) {
+	store := syncstate.NewStore(filepath.Join(t.TempDir(), "sync_state.json"))
+	accounts := []*models.MercuryAccount{{ID: "checking", Name: "Checking"}}
+	cursor := time.Date(2024, 5, 2, 10, 0, 0, 0, time.UTC)
+
+	if err := store.Save("main", accounts, map[string]time.Time{"checking": cursor}); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+
+	cursors, err := store.Cursors("main")
+	if err != nil {
+		t.Fatalf("Cursors: %v", err)
+	}
+
+	if !cursors["checking"].Equal(cursor) {
+		t.Errorf("expected the saved cursor %s, got %s", cursor, cursors["checking"])
+	}
+
+	other, err := store.Cursors("staging")
+	if err != nil {
+		t.Fatalf("Cursors: %v", err)
+	}
+
+	if len(other) != 0 {
+		t.Errorf("expected no cursors for another tenant, got %v", other)
+	}
+
+	fallback := time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC)
+	accounts = append(accounts, &models.MercuryAccount{ID: "savings", Name: "Savings"})
+	if start := syncstate.Start(accounts, cursors, fallback); !start.Equal(fallback) {
+		t.Errorf("expected a never-synced account to start from %s, got %s", fallback, start)
+	}
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/jiaming2012/receipt-bot/src/models"
+	"github.com/jiaming2012/receipt-bot/src/services"
+)
+
+const (
+	webhookQueueSize   = 100
+	maxWebhookBodySize = 1 << 20
+)
+
+// webhookJob is a transaction to ingest after a Mercury webhook event.
+type webhookJob struct {
+	Tenant        string
+	AccountID     string
+	TransactionID string
+}
+
+// handleMercuryWebhook verifies a Mercury webhook event and queues its
+// transaction for ingestion. Events are acknowledged before the receipt is
+// parsed; transactions that fail here are picked up by the next ingest run.
+func (s *Server) handleMercuryWebhook(w http.ResponseWriter, r *http.Request) {
+	tenant, err := s.tenant(r)
+	if err != nil {
+		writeJSON(w, http.StatusNotFound, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxWebhookBodySize))
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "failed to read body"})
+		return
+	}
+
+	if err := services.VerifyMercuryWebhook(tenant.WebhookSecret, r.Header.Get(services.MercurySignatureHeader), body, time.Now()); err != nil {
+		log.Warnf("tenant %s: rejected Mercury webhook: %v", tenant.Name, err)
+		writeJSON(w, http.StatusUnauthorized, ErrorResponse{Error: "invalid signature"})
+		return
+	}
+
+	var event models.MercuryWebhookEvent
+	if err := json.Unmarshal(body, &event); err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: fmt.Sprintf("invalid event: %v", err)})
+		return
+	}
+
+	if event.ResourceType != "transaction" || event.ResourceID == "" {
+		writeJSON(w, http.StatusOK, map[string]string{"status": "ignored"})
+		return
+	}
+
+	if !s.enqueueWebhookJob(webhookJob{Tenant: tenant.Name, AccountID: event.AccountID(), TransactionID: event.ResourceID}) {
+		// Mercury retries events that aren't acknowledged
+		writeJSON(w, http.StatusServiceUnavailable, ErrorResponse{Error: "webhook queue is full"})
+		return
+	}
+
+	writeJSON(w, http.StatusAccepted, map[string]string{"status": "queued"})
+}
+
+// enqueueWebhookJob queues job unless the same transaction is already queued.
+// It returns false if the queue is full.
+func (s *Server) enqueueWebhookJob(job webhookJob) bool {
+	s.webhookMu.Lock()
+	defer s.webhookMu.Unlock()
+
+	if s.webhookQueued[job] {
+		return true
+	}
+
+	select {
+	case s.webhookJobs <- job:
+		s.webhookQueued[job] = true
+		return true
+	default:
+		return false
+	}
+}
+
+// runWebhookWorker ingests queued webhook transactions one at a time until ctx
+// is cancelled.
+func (s *Server) runWebhookWorker(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case job := <-s.webhookJobs:
+			s.webhookMu.Lock()
+			delete(s.webhookQueued, job)
+			s.webhookMu.Unlock()
+
+			if err := s.processWebhookJob(ctx, job); err != nil {
+				log.Errorf("tenant %s: failed to ingest transaction %s from webhook: %v", job.Tenant, job.TransactionID, err)
+			}
+		}
+	}
+}
+
+func (s *Server) processWebhookJob(ctx context.Context, job webhookJob) error {
+	tenant, ok := s.tenants[job.Tenant]
+	if !ok {
+		return fmt.Errorf("unknown tenant %q", job.Tenant)
+	}
+
+	// share the lock with /demo so the two never create duplicate rows
+	s.ingestMu.Lock()
+	defer s.ingestMu.Unlock()
+
+	result, err := run_ingest_transaction(ctx, s.reader, tenant, job.AccountID, job.TransactionID)
+	if err != nil {
+		return err
+	}
+
+	log.Infof("tenant %s: ingested transaction %s from webhook: %+v", tenant.Name, job.TransactionID, *result)
+
+	return nil
+}
+
+// run_ingest_transaction runs the ingestion pipeline for a single bank
+// transaction. Transactions that are ignored, still missing a receipt, or
+// already in Baserow are skipped.
+func run_ingest_transaction(ctx context.Context, reader *services.ReceiptReader, tenant *TenantClients, accountID, transactionID string) (*IngestResult, error) {
+	result := &IngestResult{}
+
+	mercuryTx, err := tenant.BankClient.Transaction(ctx, accountID, transactionID)
+	if err != nil {
+		return nil, fmt.Errorf("run_ingest_transaction: %w", err)
+	}
+
+	if services.IsIgnoredTransaction(mercuryTx) {
+		return result, nil
+	}
+
+	if !services.HasReceipt(mercuryTx) {
+		// Mercury sends another event once the receipt is attached
+		result.InvalidTransactions = append(result.InvalidTransactions, mercuryTx)
+		return result, nil
+	}
+
+	result.ValidTransactions = append(result.ValidTransactions, mercuryTx)
+
+	processed, err := is_transaction_ingested(ctx, tenant.BaserowClient, mercuryTx.ID)
+	if err != nil {
+		return nil, fmt.Errorf("run_ingest_transaction: %w", err)
+	}
+
+	if processed {
+		return result, nil
+	}
+
+	req, pendingPurchases, err := parse_transaction(ctx, reader, tenant.AIUsage, mercuryTx)
+	if err != nil {
+		return nil, fmt.Errorf("run_ingest_transaction: %w", err)
+	}
+
+	if err := tenant.BaserowClient.CreateRows(ctx, pendingPurchases); err != nil {
+		return result, fmt.Errorf("run_ingest_transaction: failed to create pending purchase rows: %w", err)
+	}
+	result.PendingPurchasesCreated = len(pendingPurchases)
+
+	if req != nil {
+		requests := []models.CreateBaserowPurchaseRequest{*req}
+		if err := write_purchase_requests(ctx, tenant.BaserowClient, requests, make(map[string]*models.BaserowPurchaseEventTable), result); err != nil {
+			return result, fmt.Errorf("run_ingest_transaction: %w", err)
+		}
+	}
+
+	return result, nil
+}
+
+// is_transaction_ingested reports whether a bank transaction already has a
+// purchase event or pending purchases in Baserow.
+func is_transaction_ingested(ctx context.Context, baserowClient *models.BaserowClient, bankTxID string) (bool, error) {
+	purchaseEvents, err := models.ListRows[*models.BaserowPurchaseEventTable](ctx, baserowClient,
+		models.WithFilter("Bank Tx ID", "equal", bankTxID),
+		models.WithInclude("Bank Tx ID"),
+	)
+	if err != nil {
+		return false, fmt.Errorf("failed to list purchase events: %w", err)
+	}
+
+	if len(purchaseEvents) > 0 {
+		return true, nil
+	}
+
+	pendingPurchases, err := models.ListRows[*models.BaserowPendingPurchase](ctx, baserowClient,
+		models.WithFilter("Bank Tx ID", "equal", bankTxID),
+		models.WithInclude("Bank Tx ID"),
+	)
+	if err != nil {
+		return false, fmt.Errorf("failed to list pending purchases: %w", err)
+	}
+
+	return len(pendingPurchases) > 0, nil
+}